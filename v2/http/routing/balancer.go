@@ -0,0 +1,183 @@
+package gmrouting
+
+import (
+	"hash/crc32"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Balancer decides which upstream of an UpstreamPool will receive a request.
+type Balancer interface {
+	// Pick selects one of the available upstreams for input request.
+	//
+	// available is never empty and keeps the registration order of pool upstreams.
+	// routeParams contains route parameters extracted from the matching ProxyRouteRule.
+	Pick(r *http.Request, routeParams map[string]string, available []*Upstream) *Upstream
+}
+
+type roundRobinBalancer struct {
+	counter uint64
+}
+
+// NewRoundRobinBalancer creates a balancer which picks available upstreams in turns.
+func NewRoundRobinBalancer() Balancer {
+	return &roundRobinBalancer{}
+}
+
+func (b *roundRobinBalancer) Pick(r *http.Request, routeParams map[string]string, available []*Upstream) *Upstream {
+	next := atomic.AddUint64(&b.counter, 1) - 1
+	return available[next%uint64(len(available))]
+}
+
+type weightedBalancer struct {
+	mutex *sync.Mutex
+	// Contains current weights of smooth weighted round-robin algorithm.
+	currentWeights map[*Upstream]int
+}
+
+// NewWeightedBalancer creates a balancer which distributes requests proportional to upstream weights.
+//
+// Smooth weighted round-robin is used, so an upstream with a high weight does not receive its requests in bursts.
+func NewWeightedBalancer() Balancer {
+	return &weightedBalancer{
+		mutex:          &sync.Mutex{},
+		currentWeights: make(map[*Upstream]int),
+	}
+}
+
+func (b *weightedBalancer) Pick(r *http.Request, routeParams map[string]string, available []*Upstream) *Upstream {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	var best *Upstream
+	total := 0
+	for _, u := range available {
+		b.currentWeights[u] += u.weight
+		total += u.weight
+
+		if best == nil || b.currentWeights[u] > b.currentWeights[best] {
+			best = u
+		}
+	}
+
+	b.currentWeights[best] -= total
+
+	/* Upstreams which are ejected or removed by a reload are forgotten, so that replaced pools do not pile up. */
+	if len(b.currentWeights) > len(available) {
+		kept := make(map[*Upstream]int, len(available))
+		for _, u := range available {
+			kept[u] = b.currentWeights[u]
+		}
+		b.currentWeights = kept
+	}
+	return best
+}
+
+type leastInFlightBalancer struct {
+	counter uint64
+}
+
+// NewLeastInFlightBalancer creates a balancer which picks the upstream with the fewest requests in progress.
+//
+// Ties are broken in round-robin fashion.
+func NewLeastInFlightBalancer() Balancer {
+	return &leastInFlightBalancer{}
+}
+
+func (b *leastInFlightBalancer) Pick(r *http.Request, routeParams map[string]string, available []*Upstream) *Upstream {
+	offset := int((atomic.AddUint64(&b.counter, 1) - 1) % uint64(len(available)))
+
+	var best *Upstream
+	for i := range available {
+		u := available[(offset+i)%len(available)]
+		if best == nil || u.InFlight() < best.InFlight() {
+			best = u
+		}
+	}
+	return best
+}
+
+// hashRingReplicas is the number of virtual nodes placed on hash ring per unit of upstream weight.
+const hashRingReplicas = 100
+
+type hashRingNode struct {
+	hash     uint32
+	upstream *Upstream
+}
+
+type consistentHashBalancer struct {
+	keyFunc  RequestKeyFunc
+	fallback Balancer
+
+	mutex *sync.Mutex
+	// ring is rebuilt only when the set of available upstreams changes.
+	ring    []hashRingNode
+	ringKey string
+}
+
+// NewConsistentHashBalancer creates a balancer which sends requests with the same key to the same upstream
+// as long as the upstream stays available.
+// When an upstream is ejected, only the keys which were assigned to it move to other upstreams.
+//
+// Requests with an empty key are balanced in round-robin fashion.
+func NewConsistentHashBalancer(keyFunc RequestKeyFunc) Balancer {
+	return &consistentHashBalancer{
+		keyFunc:  keyFunc,
+		fallback: NewRoundRobinBalancer(),
+		mutex:    &sync.Mutex{},
+	}
+}
+
+func (b *consistentHashBalancer) Pick(r *http.Request, routeParams map[string]string, available []*Upstream) *Upstream {
+	key := b.keyFunc(r, routeParams)
+	if key == "" {
+		return b.fallback.Pick(r, routeParams, available)
+	}
+
+	ring := b.getRing(available)
+	hash := crc32.ChecksumIEEE([]byte(key))
+
+	i := sort.Search(len(ring), func(i int) bool {
+		return ring[i].hash >= hash
+	})
+	if i == len(ring) {
+		i = 0
+	}
+	return ring[i].upstream
+}
+
+func (b *consistentHashBalancer) getRing(available []*Upstream) []hashRingNode {
+	urls := make([]string, len(available))
+	for i, u := range available {
+		urls[i] = u.url
+	}
+	ringKey := strings.Join(urls, "\n")
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.ringKey == ringKey && b.ring != nil {
+		return b.ring
+	}
+
+	ring := make([]hashRingNode, 0, len(available)*hashRingReplicas)
+	for _, u := range available {
+		for i := 0; i < u.weight*hashRingReplicas; i++ {
+			ring = append(ring, hashRingNode{
+				hash:     crc32.ChecksumIEEE([]byte(u.url + "#" + strconv.Itoa(i))),
+				upstream: u,
+			})
+		}
+	}
+	sort.Slice(ring, func(i, j int) bool {
+		return ring[i].hash < ring[j].hash
+	})
+
+	b.ring = ring
+	b.ringKey = ringKey
+	return ring
+}
@@ -0,0 +1,73 @@
+package gmrouting
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Weighted_Balancer(t *testing.T) {
+	upstreams := []*Upstream{
+		NewUpstream("http://a", 5),
+		NewUpstream("http://b", 1),
+		NewUpstream("http://c", 1),
+	}
+	balancer := NewWeightedBalancer()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	picked := make(map[string]int)
+	for i := 0; i < 70; i++ {
+		picked[balancer.Pick(req, nil, upstreams).URL()]++
+	}
+
+	assert.Equal(t, 50, picked["http://a"])
+	assert.Equal(t, 10, picked["http://b"])
+	assert.Equal(t, 10, picked["http://c"])
+
+	/* Weights of upstreams which are no longer available are dropped. */
+	replaced := []*Upstream{NewUpstream("http://d", 1)}
+	assert.Equal(t, replaced[0], balancer.Pick(req, nil, replaced))
+	assert.Len(t, balancer.(*weightedBalancer).currentWeights, 1)
+}
+
+func Test_Least_In_Flight_Balancer(t *testing.T) {
+	upstreams := []*Upstream{
+		NewUpstream("http://a", 1),
+		NewUpstream("http://b", 1),
+	}
+	upstreams[0].begin()
+	balancer := NewLeastInFlightBalancer()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, upstreams[1], balancer.Pick(req, nil, upstreams))
+	}
+}
+
+func Test_Consistent_Hash_Balancer(t *testing.T) {
+	upstreams := []*Upstream{
+		NewUpstream("http://a", 1),
+		NewUpstream("http://b", 1),
+		NewUpstream("http://c", 1),
+	}
+	balancer := NewConsistentHashBalancer(RouteParamKey("id"))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	assigned := make(map[string]*Upstream)
+	for i := 0; i < 300; i++ {
+		id := strconv.Itoa(i)
+		assigned[id] = balancer.Pick(req, map[string]string{"id": id}, upstreams)
+		assert.Equal(t, assigned[id], balancer.Pick(req, map[string]string{"id": id}, upstreams))
+	}
+
+	// Removing an upstream must only move the keys which were assigned to it.
+	for id, u := range assigned {
+		picked := balancer.Pick(req, map[string]string{"id": id}, upstreams[:2])
+		if u != upstreams[2] {
+			assert.Equal(t, u, picked)
+		}
+	}
+}
@@ -0,0 +1,301 @@
+package gmrouting
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CachedResponse is an upstream response kept by a CacheStore.
+//
+// Stores must treat it as immutable. ResponseCache never modifies a response after passing it to a store.
+type CachedResponse struct {
+	StatusCode int         `json:"statusCode"`
+	Header     http.Header `json:"header"`
+	Body       []byte      `json:"body"`
+	// StoredAt is the time response is received from upstream or revalidated.
+	StoredAt time.Time `json:"storedAt"`
+	// ExpiresAt is the time response stops being fresh. Stale responses are revalidated before they are served.
+	ExpiresAt time.Time `json:"expiresAt"`
+	// Vary contains header names which select a variant of the response.
+	// Entries with Vary and without StatusCode only record the names, variants are stored under their own keys.
+	Vary []string `json:"vary,omitempty"`
+}
+
+// size returns approximate number of bytes response occupies in memory.
+func (c *CachedResponse) size() int64 {
+	size := int64(len(c.Body))
+	for k, v := range c.Header {
+		size += int64(len(k))
+		for _, e := range v {
+			size += int64(len(e))
+		}
+	}
+	for _, v := range c.Vary {
+		size += int64(len(v))
+	}
+	return size
+}
+
+// CacheStore keeps responses of ResponseCache. Implementations must be safe for concurrent use.
+type CacheStore interface {
+	// Get returns response stored under input key.
+	Get(key string) (*CachedResponse, bool)
+	// Set stores response under input key, replacing the existing one. Store may drop it, e.g. if it is too large.
+	Set(key string, res *CachedResponse)
+	// DeleteFunc removes responses whose keys satisfy match and returns the number of removed responses.
+	DeleteFunc(match func(key string) bool) int
+}
+
+// MemoryCacheStore keeps responses in memory, evicting least recently used ones to stay within its limits.
+type MemoryCacheStore struct {
+	mutex      *sync.Mutex
+	maxBytes   int64
+	maxEntries int
+	size       int64
+	entries    map[string]*list.Element
+	// order contains *memoryCacheEntry values. Front is the most recently used one.
+	order *list.List
+}
+
+type memoryCacheEntry struct {
+	key  string
+	res  *CachedResponse
+	size int64
+}
+
+// NewMemoryCacheStore creates an in-memory LRU store.
+//
+// maxBytes: Total size of stored responses. Responses larger than it are not stored.
+//
+// maxEntries: Maximum number of stored responses. Zero means no limit other than maxBytes.
+func NewMemoryCacheStore(maxBytes int64, maxEntries int) *MemoryCacheStore {
+	return &MemoryCacheStore{
+		mutex:      &sync.Mutex{},
+		maxBytes:   maxBytes,
+		maxEntries: maxEntries,
+		entries:    make(map[string]*list.Element),
+		order:      list.New(),
+	}
+}
+
+func (s *MemoryCacheStore) Get(key string) (*CachedResponse, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	element := s.entries[key]
+	if element == nil {
+		return nil, false
+	}
+	s.order.MoveToFront(element)
+	return element.Value.(*memoryCacheEntry).res, true
+}
+
+func (s *MemoryCacheStore) Set(key string, res *CachedResponse) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	element := s.entries[key]
+	if element != nil {
+		s.remove(element)
+	}
+
+	entry := &memoryCacheEntry{
+		key:  key,
+		res:  res,
+		size: int64(len(key)) + res.size(),
+	}
+	if entry.size > s.maxBytes {
+		return
+	}
+
+	s.entries[key] = s.order.PushFront(entry)
+	s.size += entry.size
+
+	for s.size > s.maxBytes || s.maxEntries > 0 && s.order.Len() > s.maxEntries {
+		s.remove(s.order.Back())
+	}
+}
+
+func (s *MemoryCacheStore) DeleteFunc(match func(key string) bool) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	deleted := 0
+	for key, element := range s.entries {
+		if match(key) {
+			s.remove(element)
+			deleted++
+		}
+	}
+	return deleted
+}
+
+// Len returns the number of stored responses.
+func (s *MemoryCacheStore) Len() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.order.Len()
+}
+
+// Size returns approximate total size of stored responses in bytes.
+func (s *MemoryCacheStore) Size() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.size
+}
+
+func (s *MemoryCacheStore) remove(element *list.Element) {
+	entry := element.Value.(*memoryCacheEntry)
+	s.order.Remove(element)
+	delete(s.entries, entry.key)
+	s.size -= entry.size
+}
+
+// DiskCacheStore keeps each response in a separate file of a directory, so that cache survives restarts.
+//
+// It has no size limit. Stale responses are replaced as they are revalidated, Purge can be used for clean up.
+type DiskCacheStore struct {
+	dir   string
+	mutex *sync.Mutex
+	onErr func(error)
+}
+
+type diskCacheEntry struct {
+	Key      string          `json:"key"`
+	Response *CachedResponse `json:"response"`
+}
+
+// NewDiskCacheStore creates a store which keeps responses under input directory. Directory is created if it does not exist.
+//
+// onErr: Can be registered to get notified about file errors. Such responses are treated as not stored.
+func NewDiskCacheStore(dir string, onErr func(error)) (*DiskCacheStore, error) {
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create cache directory: '%s': %s", dir, err.Error())
+	}
+	return &DiskCacheStore{
+		dir:   dir,
+		mutex: &sync.Mutex{},
+		onErr: onErr,
+	}, nil
+}
+
+func (s *DiskCacheStore) Get(key string) (*CachedResponse, bool) {
+	entry, err := s.read(s.path(key))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			s.reportErr(err)
+		}
+		return nil, false
+	}
+	/* File names are hashes. Key is compared to rule out collisions. */
+	if entry.Key != key {
+		return nil, false
+	}
+	return entry.Response, true
+}
+
+func (s *DiskCacheStore) Set(key string, res *CachedResponse) {
+	content, err := json.Marshal(diskCacheEntry{Key: key, Response: res})
+	if err != nil {
+		s.reportErr(err)
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	/* Written to a temporary file first, so that readers never see a partially written response. */
+	file, err := os.CreateTemp(s.dir, "*.tmp")
+	if err != nil {
+		s.reportErr(err)
+		return
+	}
+	_, err = file.Write(content)
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), s.path(key))
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		s.reportErr(err)
+	}
+}
+
+func (s *DiskCacheStore) DeleteFunc(match func(key string) bool) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	files, err := os.ReadDir(s.dir)
+	if err != nil {
+		s.reportErr(err)
+		return 0
+	}
+
+	deleted := 0
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), ".json") {
+			continue
+		}
+
+		path := filepath.Join(s.dir, f.Name())
+		entry, err := s.read(path)
+		if err != nil {
+			s.reportErr(err)
+			continue
+		}
+		if !match(entry.Key) {
+			continue
+		}
+
+		err = os.Remove(path)
+		if err != nil {
+			s.reportErr(err)
+			continue
+		}
+		deleted++
+	}
+	return deleted
+}
+
+func (s *DiskCacheStore) read(path string) (*diskCacheEntry, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	entry := &diskCacheEntry{}
+	err = json.Unmarshal(content, entry)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cache file: '%s': %s", path, err.Error())
+	}
+	if entry.Response == nil {
+		return nil, fmt.Errorf("invalid cache file: '%s': response is missing", path)
+	}
+	return entry, nil
+}
+
+func (s *DiskCacheStore) path(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return filepath.Join(s.dir, hex.EncodeToString(hash[:])+".json")
+}
+
+func (s *DiskCacheStore) reportErr(err error) {
+	if s.onErr != nil {
+		s.onErr(err)
+	}
+}
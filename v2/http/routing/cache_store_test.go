@@ -0,0 +1,88 @@
+package gmrouting
+
+import (
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Memory_Cache_Store(t *testing.T) {
+	store := NewMemoryCacheStore(30, 2)
+	res := func(body string) *CachedResponse {
+		return &CachedResponse{StatusCode: http.StatusOK, Body: []byte(body)}
+	}
+
+	store.Set("a", res("1234"))
+	store.Set("b", res("1234"))
+	_, ok := store.Get("a")
+	assert.True(t, ok)
+
+	/* Entry limit evicts the least recently used one. */
+	store.Set("c", res("1234"))
+	_, ok = store.Get("b")
+	assert.False(t, ok)
+	assert.Equal(t, 2, store.Len())
+	assert.Equal(t, int64(10), store.Size())
+
+	/* Size limit evicts as many as needed. */
+	store.Set("d", res(strings.Repeat("x", 25)))
+	assert.Equal(t, 1, store.Len())
+	found, ok := store.Get("d")
+	assert.True(t, ok)
+	assert.Equal(t, 25, len(found.Body))
+
+	/* Responses larger than the store are dropped, replacing the existing one. */
+	store.Set("d", res(strings.Repeat("x", 30)))
+	assert.Equal(t, 0, store.Len())
+	assert.Equal(t, int64(0), store.Size())
+
+	store.Set("a", res("1"))
+	store.Set("b", res("2"))
+	assert.Equal(t, 1, store.DeleteFunc(func(key string) bool { return key == "a" }))
+	assert.Equal(t, 1, store.Len())
+}
+
+func Test_Disk_Cache_Store(t *testing.T) {
+	dir := t.TempDir()
+	var errs []error
+	store, err := NewDiskCacheStore(dir, func(err error) { errs = append(errs, err) })
+	assert.NoError(t, err)
+
+	storedAt := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	res := &CachedResponse{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Etag": []string{`"v1"`}},
+		Body:       []byte("accounts"),
+		StoredAt:   storedAt,
+		ExpiresAt:  storedAt.Add(time.Minute),
+	}
+	store.Set("GET\nexample.com\n/api/accounts", res)
+	store.Set("GET\nexample.com\n/api/transfers", res)
+
+	/* Responses survive a new store instance. */
+	store, err = NewDiskCacheStore(dir, func(err error) { errs = append(errs, err) })
+	assert.NoError(t, err)
+	found, ok := store.Get("GET\nexample.com\n/api/accounts")
+	assert.True(t, ok)
+	assert.Equal(t, res, found)
+
+	_, ok = store.Get("GET\nexample.com\n/api/unknown")
+	assert.False(t, ok)
+
+	/* Corrupt files are reported and treated as not stored. */
+	assert.NoError(t, os.WriteFile(store.path("corrupt"), []byte("{"), 0600))
+	_, ok = store.Get("corrupt")
+	assert.False(t, ok)
+	assert.Len(t, errs, 1)
+
+	deleted := store.DeleteFunc(func(key string) bool { return strings.HasSuffix(key, "/api/transfers") })
+	assert.Equal(t, 1, deleted)
+	_, ok = store.Get("GET\nexample.com\n/api/transfers")
+	assert.False(t, ok)
+	_, ok = store.Get("GET\nexample.com\n/api/accounts")
+	assert.True(t, ok)
+}
@@ -0,0 +1,212 @@
+package gmrouting
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned for requests which are rejected without contacting upstream because its circuit is open.
+var ErrCircuitOpen = errors.New("circuit is open")
+
+type CircuitState int
+
+const (
+	// CircuitClosed lets all requests pass through.
+	CircuitClosed CircuitState = iota
+	// CircuitOpen rejects all requests until open timeout elapses.
+	CircuitOpen
+	// CircuitHalfOpen lets a limited number of trial requests pass through to decide whether circuit should be closed again.
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// CircuitBreakerConfig contains settings of CircuitBreaker.
+type CircuitBreakerConfig struct {
+	// FailureThreshold is the number of consecutive failures which opens a closed circuit.
+	FailureThreshold int
+	// OpenTimeout is the duration an open circuit waits before letting trial requests through.
+	OpenTimeout time.Duration
+	// HalfOpenRequests is the number of trial requests allowed in half-open state.
+	// Circuit is closed when all of them succeed and opened again as soon as one of them fails.
+	HalfOpenRequests int
+}
+
+// CircuitTransition describes a state change of an upstream circuit.
+type CircuitTransition struct {
+	UpstreamUrl string
+	From        CircuitState
+	To          CircuitState
+}
+
+type circuit struct {
+	state    CircuitState
+	failures int
+	openedAt time.Time
+	// Number of trial requests let through and succeeded in half-open state.
+	trials    int
+	successes int
+}
+
+// CircuitBreaker keeps a separate circuit per upstream url.
+// Transport errors and 5xx responses are counted as failures.
+type CircuitBreaker struct {
+	config CircuitBreakerConfig
+
+	mutex    *sync.Mutex
+	circuits map[string]*circuit
+
+	onTransition func(CircuitTransition)
+}
+
+// NewCircuitBreaker creates a circuit breaker to be registered via ProxyClient.SetCircuitBreaker.
+//
+// onTransition: Can be registered to get notified about circuit state changes.
+func NewCircuitBreaker(config CircuitBreakerConfig, onTransition func(CircuitTransition)) *CircuitBreaker {
+	if config.FailureThreshold < 1 {
+		config.FailureThreshold = 5
+	}
+	if config.OpenTimeout <= 0 {
+		config.OpenTimeout = 30 * time.Second
+	}
+	if config.HalfOpenRequests < 1 {
+		config.HalfOpenRequests = 1
+	}
+
+	return &CircuitBreaker{
+		config:       config,
+		mutex:        &sync.Mutex{},
+		circuits:     make(map[string]*circuit),
+		onTransition: onTransition,
+	}
+}
+
+// State returns current circuit state of upstream.
+func (cb *CircuitBreaker) State(upstreamUrl string) CircuitState {
+	cb.mutex.Lock()
+	c, transition := cb.getCircuit(strings.TrimSuffix(upstreamUrl, "/"))
+	state := c.state
+	cb.mutex.Unlock()
+
+	cb.notify(transition)
+	return state
+}
+
+// allow reports whether a request can be sent to upstream.
+// In half-open state every allowed request is counted as a trial.
+func (cb *CircuitBreaker) allow(upstreamUrl string) bool {
+	cb.mutex.Lock()
+	c, transition := cb.getCircuit(upstreamUrl)
+
+	allowed := true
+	switch c.state {
+	case CircuitOpen:
+		allowed = false
+	case CircuitHalfOpen:
+		if c.trials >= cb.config.HalfOpenRequests {
+			allowed = false
+		} else {
+			c.trials++
+		}
+	}
+	cb.mutex.Unlock()
+
+	cb.notify(transition)
+	return allowed
+}
+
+// release gives back the trial slot of an allowed request whose outcome is unknown, e.g. it is cancelled by client.
+// Otherwise half-open circuit would keep rejecting requests without ever getting an outcome.
+func (cb *CircuitBreaker) release(upstreamUrl string) {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	c := cb.circuits[upstreamUrl]
+	if c != nil && c.state == CircuitHalfOpen && c.trials > c.successes {
+		c.trials--
+	}
+}
+
+// record updates upstream circuit with the outcome of an allowed request.
+func (cb *CircuitBreaker) record(upstreamUrl string, success bool) {
+	cb.mutex.Lock()
+	c, halfOpened := cb.getCircuit(upstreamUrl)
+
+	var transition *CircuitTransition
+	switch c.state {
+	case CircuitClosed:
+		if success {
+			c.failures = 0
+			break
+		}
+		c.failures++
+		if c.failures >= cb.config.FailureThreshold {
+			transition = cb.setState(upstreamUrl, c, CircuitOpen)
+		}
+	case CircuitHalfOpen:
+		if !success {
+			transition = cb.setState(upstreamUrl, c, CircuitOpen)
+			break
+		}
+		c.successes++
+		if c.successes >= cb.config.HalfOpenRequests {
+			transition = cb.setState(upstreamUrl, c, CircuitClosed)
+		}
+	}
+	cb.mutex.Unlock()
+
+	cb.notify(halfOpened)
+	cb.notify(transition)
+}
+
+// getCircuit returns circuit of upstream and moves it to half-open state if open timeout has elapsed.
+// Must be called while holding the mutex.
+func (cb *CircuitBreaker) getCircuit(upstreamUrl string) (*circuit, *CircuitTransition) {
+	c := cb.circuits[upstreamUrl]
+	if c == nil {
+		c = &circuit{state: CircuitClosed}
+		cb.circuits[upstreamUrl] = c
+	}
+
+	if c.state == CircuitOpen && time.Since(c.openedAt) >= cb.config.OpenTimeout {
+		return c, cb.setState(upstreamUrl, c, CircuitHalfOpen)
+	}
+	return c, nil
+}
+
+// setState must be called while holding the mutex.
+func (cb *CircuitBreaker) setState(upstreamUrl string, c *circuit, state CircuitState) *CircuitTransition {
+	transition := &CircuitTransition{
+		UpstreamUrl: upstreamUrl,
+		From:        c.state,
+		To:          state,
+	}
+
+	c.state = state
+	c.failures = 0
+	c.trials = 0
+	c.successes = 0
+	if state == CircuitOpen {
+		c.openedAt = time.Now()
+	}
+	return transition
+}
+
+func (cb *CircuitBreaker) notify(transition *CircuitTransition) {
+	if transition != nil && cb.onTransition != nil {
+		cb.onTransition(*transition)
+	}
+}
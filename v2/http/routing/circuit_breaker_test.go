@@ -0,0 +1,127 @@
+package gmrouting
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	gmhttp "github.com/onuryurdupak/gomod/v2/http"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Circuit_Breaker_Transitions(t *testing.T) {
+	var transitions []CircuitTransition
+	cb := NewCircuitBreaker(CircuitBreakerConfig{
+		FailureThreshold: 2,
+		OpenTimeout:      20 * time.Millisecond,
+		HalfOpenRequests: 1,
+	}, func(ct CircuitTransition) { transitions = append(transitions, ct) })
+
+	const upstreamUrl = "http://upstream"
+
+	for i := 0; i < 2; i++ {
+		assert.True(t, cb.allow(upstreamUrl))
+		cb.record(upstreamUrl, false)
+	}
+	assert.Equal(t, CircuitOpen, cb.State(upstreamUrl))
+	assert.False(t, cb.allow(upstreamUrl))
+
+	time.Sleep(30 * time.Millisecond)
+	assert.True(t, cb.allow(upstreamUrl))
+	assert.Equal(t, CircuitHalfOpen, cb.State(upstreamUrl))
+	// Only a single trial request is allowed in half-open state.
+	assert.False(t, cb.allow(upstreamUrl))
+
+	cb.record(upstreamUrl, true)
+	assert.Equal(t, CircuitClosed, cb.State(upstreamUrl))
+
+	assert.Equal(t, []CircuitTransition{
+		{UpstreamUrl: upstreamUrl, From: CircuitClosed, To: CircuitOpen},
+		{UpstreamUrl: upstreamUrl, From: CircuitOpen, To: CircuitHalfOpen},
+		{UpstreamUrl: upstreamUrl, From: CircuitHalfOpen, To: CircuitClosed},
+	}, transitions)
+}
+
+func Test_Proxy_Retry_And_Circuit_Breaker(t *testing.T) {
+	var hits int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&hits, 1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer upstream.Close()
+
+	table, err := NewProxyRouteTable([]*ProxyRouteRule{
+		NewProxyRouteRule(http.MethodGet, `/api/accounts`),
+		NewProxyRouteRule(http.MethodPost, `/api/accounts`),
+	})
+	assert.NoError(t, err)
+
+	pc := NewProxyClient(table, upstream.URL, upstream.Client(), gmhttp.NewResponseWriter(), nil, nil, nil, nil)
+	pc.SetRetryPolicy(&RetryPolicy{
+		MaxAttempts: 3,
+		StatusCodes: []int{http.StatusServiceUnavailable},
+		BaseBackoff: time.Millisecond,
+		Jitter:      true,
+	})
+
+	rec := httptest.NewRecorder()
+	pc.HandleRequestAndRedirect(rec, httptest.NewRequest(http.MethodGet, `/api/accounts`, nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&hits))
+
+	// POST is not idempotent, therefore it is not retried by default.
+	atomic.StoreInt32(&hits, 0)
+	rec = httptest.NewRecorder()
+	pc.HandleRequestAndRedirect(rec, httptest.NewRequest(http.MethodPost, `/api/accounts`, nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&hits))
+
+	atomic.StoreInt32(&hits, 0)
+	pc.SetCircuitBreaker(NewCircuitBreaker(CircuitBreakerConfig{FailureThreshold: 2}, nil))
+	for i := 0; i < 2; i++ {
+		pc.HandleRequestAndRedirect(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, `/api/accounts`, nil))
+	}
+
+	rec = httptest.NewRecorder()
+	pc.HandleRequestAndRedirect(rec, httptest.NewRequest(http.MethodGet, `/api/accounts`, nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.JSONEq(t, `{"message":"circuit open"}`, rec.Body.String())
+	assert.Equal(t, int32(2), atomic.LoadInt32(&hits))
+}
+
+func Test_Proxy_Circuit_Breaker_Cancelled_Trial(t *testing.T) {
+	var hits int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&hits, 1) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer upstream.Close()
+
+	table, err := NewProxyRouteTable([]*ProxyRouteRule{NewProxyRouteRule(http.MethodGet, `/api/accounts`)})
+	assert.NoError(t, err)
+
+	cb := NewCircuitBreaker(CircuitBreakerConfig{FailureThreshold: 1, OpenTimeout: 20 * time.Millisecond}, nil)
+	pc := NewProxyClient(table, upstream.URL, upstream.Client(), gmhttp.NewResponseWriter(), nil, nil, nil, nil)
+	pc.SetCircuitBreaker(cb)
+
+	pc.HandleRequestAndRedirect(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, `/api/accounts`, nil))
+	assert.Equal(t, CircuitOpen, cb.State(upstream.URL))
+	time.Sleep(30 * time.Millisecond)
+
+	/* Trial request is cancelled by client before upstream responds. */
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	pc.HandleRequestAndRedirect(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, `/api/accounts`, nil).WithContext(ctx))
+	assert.Equal(t, CircuitHalfOpen, cb.State(upstream.URL))
+
+	/* Its trial slot is given back, so that the next request can close the circuit. */
+	rec := httptest.NewRecorder()
+	pc.HandleRequestAndRedirect(rec, httptest.NewRequest(http.MethodGet, `/api/accounts`, nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, CircuitClosed, cb.State(upstream.URL))
+}
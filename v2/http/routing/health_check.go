@@ -0,0 +1,241 @@
+package gmrouting
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HealthCheckConfig contains probing settings of HealthChecker.
+type HealthCheckConfig struct {
+	// Interval between two consecutive probes of the same upstream.
+	Interval time.Duration
+	// Timeout of a single probe.
+	Timeout time.Duration
+	// HealthyThreshold is the number of consecutive successful probes required to mark a down upstream as up.
+	HealthyThreshold int
+	// UnhealthyThreshold is the number of consecutive failed probes required to mark an up upstream as down.
+	UnhealthyThreshold int
+}
+
+// UpstreamHealth is a snapshot of health state of a watched upstream.
+type UpstreamHealth struct {
+	Url                  string    `json:"url"`
+	HealthUrl            string    `json:"healthUrl"`
+	Healthy              bool      `json:"healthy"`
+	ConsecutiveSuccesses int       `json:"consecutiveSuccesses"`
+	ConsecutiveFailures  int       `json:"consecutiveFailures"`
+	LastCheck            time.Time `json:"lastCheck"`
+	LastError            string    `json:"lastError,omitempty"`
+}
+
+// HealthChecker periodically probes health endpoints of upstreams.
+//
+// Upstreams start as healthy and change state only after the configured number of consecutive
+// probe results, so a single flaky probe does not flip the state back and forth.
+type HealthChecker struct {
+	httpCli        *http.Client
+	responseWriter responseWriter
+	config         HealthCheckConfig
+
+	mutex   *sync.Mutex
+	targets map[string]*UpstreamHealth
+
+	onChange func(UpstreamHealth)
+}
+
+// NewHealthChecker creates a health checker. Upstreams to be probed must be registered via Watch.
+//
+// onChange: Can be registered to get notified when an upstream goes up or down.
+func NewHealthChecker(httpCli *http.Client, responseWriter responseWriter, config HealthCheckConfig, onChange func(UpstreamHealth)) *HealthChecker {
+	if config.Interval <= 0 {
+		config.Interval = 10 * time.Second
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 2 * time.Second
+	}
+	if config.HealthyThreshold < 1 {
+		config.HealthyThreshold = 1
+	}
+	if config.UnhealthyThreshold < 1 {
+		config.UnhealthyThreshold = 1
+	}
+
+	return &HealthChecker{
+		httpCli:        httpCli,
+		responseWriter: responseWriter,
+		config:         config,
+		mutex:          &sync.Mutex{},
+		targets:        make(map[string]*UpstreamHealth),
+		onChange:       onChange,
+	}
+}
+
+// Watch registers an upstream to be probed. Its health endpoint is upstreamUrl + healthPath.
+//
+// upstreamUrl must be the same value used for routeUrl, Upstream or ProxyTarget.
+// E.g: Watch("http://10.0.0.1:8080", "/health")
+func (hc *HealthChecker) Watch(upstreamUrl, healthPath string) {
+	upstreamUrl = strings.TrimSuffix(upstreamUrl, "/")
+
+	hc.mutex.Lock()
+	defer hc.mutex.Unlock()
+
+	hc.targets[upstreamUrl] = &UpstreamHealth{
+		Url:       upstreamUrl,
+		HealthUrl: upstreamUrl + healthPath,
+		Healthy:   true,
+	}
+}
+
+// WatchPool registers all upstreams of input pool with the same health path.
+func (hc *HealthChecker) WatchPool(pool *UpstreamPool, healthPath string) {
+	for _, u := range pool.upstreams {
+		hc.Watch(u.url, healthPath)
+	}
+}
+
+// Start probes watched upstreams every interval in background until ctx is cancelled.
+func (hc *HealthChecker) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(hc.config.Interval)
+		defer ticker.Stop()
+
+		hc.CheckNow(ctx)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				hc.CheckNow(ctx)
+			}
+		}
+	}()
+}
+
+// CheckNow probes all watched upstreams concurrently and returns after every probe is completed.
+func (hc *HealthChecker) CheckNow(ctx context.Context) {
+	hc.mutex.Lock()
+	healthUrls := make(map[string]string, len(hc.targets))
+	for k, v := range hc.targets {
+		healthUrls[k] = v.HealthUrl
+	}
+	hc.mutex.Unlock()
+
+	wg := &sync.WaitGroup{}
+	for upstreamUrl, healthUrl := range healthUrls {
+		wg.Add(1)
+		go func(upstreamUrl, healthUrl string) {
+			defer wg.Done()
+			hc.record(upstreamUrl, hc.probe(ctx, healthUrl))
+		}(upstreamUrl, healthUrl)
+	}
+	wg.Wait()
+}
+
+// IsHealthy returns false if upstream is known to be down.
+// Upstreams which are not watched are always considered healthy.
+func (hc *HealthChecker) IsHealthy(upstreamUrl string) bool {
+	hc.mutex.Lock()
+	defer hc.mutex.Unlock()
+
+	target, ok := hc.targets[strings.TrimSuffix(upstreamUrl, "/")]
+	return !ok || target.Healthy
+}
+
+// States returns health snapshots of all watched upstreams ordered by url.
+func (hc *HealthChecker) States() []UpstreamHealth {
+	hc.mutex.Lock()
+	defer hc.mutex.Unlock()
+
+	states := make([]UpstreamHealth, 0, len(hc.targets))
+	for _, v := range hc.targets {
+		states = append(states, *v)
+	}
+	sort.Slice(states, func(i, j int) bool {
+		return states[i].Url < states[j].Url
+	})
+	return states
+}
+
+// HandleStatus can be registered to http.Handle() for exposing health states as JSON.
+//
+// Responds with 200 if all watched upstreams are healthy, 503 otherwise.
+func (hc *HealthChecker) HandleStatus(w http.ResponseWriter, r *http.Request) {
+	states := hc.States()
+
+	statusCode := http.StatusOK
+	for _, s := range states {
+		if !s.Healthy {
+			statusCode = http.StatusServiceUnavailable
+			break
+		}
+	}
+
+	hc.responseWriter.WriteCustomJsonResponse(w, statusCode, map[string]interface{}{
+		"upstreams": states,
+	})
+}
+
+func (hc *HealthChecker) probe(ctx context.Context, healthUrl string) error {
+	ctx, cancel := context.WithTimeout(ctx, hc.config.Timeout)
+	defer cancel()
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, healthUrl, nil)
+	if err != nil {
+		return fmt.Errorf("could not create new request: %s", err.Error())
+	}
+
+	httpRes, err := hc.httpCli.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("error executing request: %s", err.Error())
+	}
+	defer httpRes.Body.Close()
+	io.Copy(io.Discard, httpRes.Body)
+
+	if httpRes.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("unexpected status code: %d", httpRes.StatusCode)
+	}
+	return nil
+}
+
+func (hc *HealthChecker) record(upstreamUrl string, probeErr error) {
+	hc.mutex.Lock()
+
+	target, ok := hc.targets[upstreamUrl]
+	if !ok {
+		hc.mutex.Unlock()
+		return
+	}
+
+	target.LastCheck = time.Now()
+	if probeErr == nil {
+		target.LastError = ""
+		target.ConsecutiveFailures = 0
+		target.ConsecutiveSuccesses++
+	} else {
+		target.LastError = probeErr.Error()
+		target.ConsecutiveSuccesses = 0
+		target.ConsecutiveFailures++
+	}
+
+	changed := false
+	if !target.Healthy && target.ConsecutiveSuccesses >= hc.config.HealthyThreshold {
+		target.Healthy = true
+		changed = true
+	} else if target.Healthy && target.ConsecutiveFailures >= hc.config.UnhealthyThreshold {
+		target.Healthy = false
+		changed = true
+	}
+	snapshot := *target
+	hc.mutex.Unlock()
+
+	if changed && hc.onChange != nil {
+		hc.onChange(snapshot)
+	}
+}
@@ -0,0 +1,76 @@
+package gmrouting
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	gmhttp "github.com/onuryurdupak/gomod/v2/http"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Health_Check_Hysteresis(t *testing.T) {
+	var failing atomic.Bool
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer upstream.Close()
+
+	var changes []UpstreamHealth
+	hc := NewHealthChecker(upstream.Client(), gmhttp.NewResponseWriter(), HealthCheckConfig{
+		HealthyThreshold:   2,
+		UnhealthyThreshold: 3,
+	}, func(h UpstreamHealth) { changes = append(changes, h) })
+	hc.Watch(upstream.URL, "/health")
+
+	ctx := context.Background()
+	failing.Store(true)
+	for i := 0; i < 2; i++ {
+		hc.CheckNow(ctx)
+		assert.True(t, hc.IsHealthy(upstream.URL))
+	}
+	hc.CheckNow(ctx)
+	assert.False(t, hc.IsHealthy(upstream.URL))
+
+	failing.Store(false)
+	hc.CheckNow(ctx)
+	assert.False(t, hc.IsHealthy(upstream.URL))
+	hc.CheckNow(ctx)
+	assert.True(t, hc.IsHealthy(upstream.URL))
+
+	assert.Len(t, changes, 2)
+	assert.False(t, changes[0].Healthy)
+	assert.True(t, changes[1].Healthy)
+}
+
+func Test_Proxy_No_Healthy_Upstream(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer upstream.Close()
+
+	hc := NewHealthChecker(upstream.Client(), gmhttp.NewResponseWriter(), HealthCheckConfig{}, nil)
+	hc.Watch(upstream.URL, "/health")
+	hc.CheckNow(context.Background())
+
+	table, err := NewProxyRouteTable([]*ProxyRouteRule{
+		NewProxyRouteRule(http.MethodGet, `/api/accounts`),
+	})
+	assert.NoError(t, err)
+
+	pc := NewProxyClient(table, upstream.URL, upstream.Client(), gmhttp.NewResponseWriter(), nil, nil, nil, nil)
+	pc.SetHealthChecker(hc)
+
+	rec := httptest.NewRecorder()
+	pc.HandleRequestAndRedirect(rec, httptest.NewRequest(http.MethodGet, `/api/accounts`, nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.JSONEq(t, `{"message":"no healthy upstream"}`, rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	hc.HandleStatus(rec, httptest.NewRequest(http.MethodGet, `/status`, nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+}
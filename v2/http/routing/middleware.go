@@ -0,0 +1,40 @@
+package gmrouting
+
+import "net/http"
+
+// Middleware wraps a handler with cross-cutting behavior like logging, auth or metrics.
+//
+// A middleware can short-circuit the chain by writing a response without calling next.
+// Matched rule and route parameters are available to middlewares via RouteMatchFromContext.
+type Middleware func(next http.Handler) http.Handler
+
+// Use registers router level middlewares. They wrap every request handled by ServeHTTP including
+// 404 and 405 responses, for which RouteMatchFromContext returns nil.
+//
+// Middlewares run in the following order, each group in registration order:
+// router level, then RouteRule.Middlewares, then rate limiter, AuthWith and RouteTo.
+func (sr *Router) Use(middlewares ...Middleware) {
+	sr.middlewares = append(sr.middlewares, middlewares...)
+}
+
+// ApplyMiddlewares prepends input middlewares to RouteRule.Middlewares of each rule,
+// so a group of rules can share middlewares which run before their own ones.
+//
+// It returns input routeRules for convenience.
+func ApplyMiddlewares(routeRules []*RouteRule, middlewares ...Middleware) []*RouteRule {
+	for _, r := range routeRules {
+		combined := make([]Middleware, 0, len(middlewares)+len(r.Middlewares))
+		combined = append(combined, middlewares...)
+		combined = append(combined, r.Middlewares...)
+		r.Middlewares = combined
+	}
+	return routeRules
+}
+
+// chain wraps handler with middlewares so that the first middleware runs first.
+func chain(handler http.Handler, middlewares []Middleware) http.Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
@@ -0,0 +1,69 @@
+package gmrouting
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Middleware_Order(t *testing.T) {
+	var calls []string
+	record := func(name string) Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				match := RouteMatchFromContext(r.Context())
+				if match != nil {
+					calls = append(calls, name+":"+match.Param("id"))
+				} else {
+					calls = append(calls, name+":no-match")
+				}
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+	block := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls = append(calls, "block")
+			w.WriteHeader(http.StatusTeapot)
+		})
+	}
+
+	routeRules := ApplyMiddlewares([]*RouteRule{
+		{
+			Method: `GET`, Path: `/api/transfers/{id}`, DynamicPath: true,
+			Middlewares: []Middleware{record("rule")},
+			AuthWith: func(w http.ResponseWriter, r *http.Request) error {
+				calls = append(calls, "auth")
+				return nil
+			},
+			RouteTo: func(w http.ResponseWriter, r *http.Request, routeParams map[string]string) {
+				calls = append(calls, "routeTo")
+			},
+		},
+		{
+			Method: `DELETE`, Path: `/api/transfers/{id}`, DynamicPath: true,
+			Middlewares: []Middleware{block, record("unreachable")},
+		},
+	}, record("group"))
+
+	router, err := NewRouter(routeRules)
+	assert.NoError(t, err)
+	router.Use(record("router1"), record("router2"))
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(`GET`, `/api/transfers/3`, nil))
+	assert.Equal(t, []string{"router1:3", "router2:3", "group:3", "rule:3", "auth", "routeTo"}, calls)
+
+	calls = nil
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(`DELETE`, `/api/transfers/3`, nil))
+	assert.Equal(t, http.StatusTeapot, rec.Code)
+	assert.Equal(t, []string{"router1:3", "router2:3", "group:3", "block"}, calls)
+
+	calls = nil
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(`GET`, `/api/accounts`, nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Equal(t, []string{"router1:no-match", "router2:no-match"}, calls)
+}
@@ -0,0 +1,216 @@
+package gmrouting
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	gmhttp "github.com/onuryurdupak/gomod/v2/http"
+)
+
+// RouteDoc describes a rule in OpenAPI documents. All fields are optional.
+type RouteDoc struct {
+	Summary     string
+	Description string
+	Tags        []string
+	// Request is a sample value whose type describes the JSON request body. E.g: CreateTransferRequest{}
+	Request interface{}
+	// Responses maps status codes to sample values whose types describe JSON response bodies.
+	// A nil value means the response has no body. A single 200 response without body is documented if left empty.
+	Responses map[int]interface{}
+}
+
+// OpenAPIDocument is an OpenAPI 3 document built from Router and RouteTable definitions.
+//
+// E.g:
+//
+//	doc := NewOpenAPIDocument(OpenAPIInfo{Title: "Transfers", Version: "1.0.0"})
+//	doc.AddRouter(router)
+//	doc.AddRouteTable(table)
+//	http.HandleFunc("/openapi.json", doc.HandleDocument)
+type OpenAPIDocument struct {
+	OpenAPI    string                                  `json:"openapi"`
+	Info       OpenAPIInfo                             `json:"info"`
+	Paths      map[string]map[string]*OpenAPIOperation `json:"paths"`
+	Components *OpenAPIComponents                      `json:"components,omitempty"`
+
+	responseWriter responseWriter
+}
+
+type OpenAPIInfo struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+type OpenAPIComponents struct {
+	Schemas map[string]*OpenAPISchema `json:"schemas,omitempty"`
+}
+
+type OpenAPIOperation struct {
+	OperationID string                      `json:"operationId,omitempty"`
+	Summary     string                      `json:"summary,omitempty"`
+	Description string                      `json:"description,omitempty"`
+	Tags        []string                    `json:"tags,omitempty"`
+	Parameters  []*OpenAPIParameter         `json:"parameters,omitempty"`
+	RequestBody *OpenAPIRequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*OpenAPIResponse `json:"responses"`
+}
+
+type OpenAPIParameter struct {
+	Name        string         `json:"name"`
+	In          string         `json:"in"`
+	Required    bool           `json:"required"`
+	Description string         `json:"description,omitempty"`
+	Schema      *OpenAPISchema `json:"schema"`
+}
+
+type OpenAPIRequestBody struct {
+	Required bool                        `json:"required"`
+	Content  map[string]OpenAPIMediaType `json:"content"`
+}
+
+type OpenAPIResponse struct {
+	Description string                      `json:"description"`
+	Content     map[string]OpenAPIMediaType `json:"content,omitempty"`
+}
+
+type OpenAPIMediaType struct {
+	Schema *OpenAPISchema `json:"schema"`
+}
+
+// NewOpenAPIDocument creates an empty document. Rules are added via AddRouter and AddRouteTable.
+func NewOpenAPIDocument(info OpenAPIInfo) *OpenAPIDocument {
+	return &OpenAPIDocument{
+		OpenAPI: "3.0.3",
+		Info:    info,
+		Paths:   make(map[string]map[string]*OpenAPIOperation),
+
+		responseWriter: gmhttp.NewResponseWriter(),
+	}
+}
+
+// AddRouter adds all rules of router to the document. Operations which already exist for the same path and method are kept.
+//
+// Rule names are used as operation IDs.
+func (d *OpenAPIDocument) AddRouter(router *Router) {
+	for _, r := range router.routeRules {
+		path := r.Path
+		var params []*OpenAPIParameter
+		if r.DynamicPath {
+			path, params = openAPIPath(r.Path)
+		}
+		d.addOperation(path, r.Method, r.Name, params, r.Doc)
+	}
+}
+
+// AddRouteTable adds all rules of table to the document. Operations which already exist for the same path and method are kept.
+//
+// Rules are documented with their client facing paths. (Not the rewritten ones.)
+func (d *OpenAPIDocument) AddRouteTable(table *RouteTable) {
+	for _, r := range table.routeRules {
+		path, params := openAPIPath(r.path)
+		d.addOperation(path, r.method, "", params, r.doc)
+	}
+}
+
+// HandleDocument can be registered to http.Handle() for serving the document as JSON.
+func (d *OpenAPIDocument) HandleDocument(w http.ResponseWriter, r *http.Request) {
+	d.responseWriter.WriteCustomJsonResponse(w, http.StatusOK, d)
+}
+
+func (d *OpenAPIDocument) addOperation(path, method, operationID string, params []*OpenAPIParameter, doc *RouteDoc) {
+	method = strings.ToLower(method)
+	if d.Paths[path] == nil {
+		d.Paths[path] = make(map[string]*OpenAPIOperation)
+	}
+	if d.Paths[path][method] != nil {
+		return
+	}
+
+	operation := &OpenAPIOperation{
+		OperationID: operationID,
+		Parameters:  params,
+		Responses:   make(map[string]*OpenAPIResponse),
+	}
+
+	if doc == nil {
+		doc = &RouteDoc{}
+	}
+	operation.Summary = doc.Summary
+	operation.Description = doc.Description
+	operation.Tags = doc.Tags
+
+	if doc.Request != nil {
+		operation.RequestBody = &OpenAPIRequestBody{
+			Required: true,
+			Content: map[string]OpenAPIMediaType{
+				"application/json": {Schema: d.schemaOf(doc.Request)},
+			},
+		}
+	}
+
+	for statusCode, sample := range doc.Responses {
+		response := &OpenAPIResponse{
+			Description: http.StatusText(statusCode),
+		}
+		if sample != nil {
+			response.Content = map[string]OpenAPIMediaType{
+				"application/json": {Schema: d.schemaOf(sample)},
+			}
+		}
+		operation.Responses[strconv.Itoa(statusCode)] = response
+	}
+	if len(operation.Responses) == 0 {
+		operation.Responses["200"] = &OpenAPIResponse{Description: http.StatusText(http.StatusOK)}
+	}
+
+	d.Paths[path][method] = operation
+}
+
+// openAPIPath converts route path to OpenAPI path template and builds its path parameters.
+//
+// E.g: `/Transfer/{id:int}` will convert to `/Transfer/{id}` with an integer parameter.
+func openAPIPath(path string) (string, []*OpenAPIParameter) {
+	parts, err := parseRoute(path)
+	if err != nil {
+		return path, nil
+	}
+
+	result := strings.Builder{}
+	params := make([]*OpenAPIParameter, 0)
+	for _, p := range parts {
+		if p.param == nil {
+			result.WriteString(p.literal)
+			continue
+		}
+
+		result.WriteString("{" + p.param.name + "}")
+		param := &OpenAPIParameter{
+			Name:     p.param.name,
+			In:       "path",
+			Required: true,
+			Schema:   paramSchema(p.param),
+		}
+		if p.param.wildcard {
+			param.Description = "Rest of the path. Can contain slashes."
+		}
+		params = append(params, param)
+	}
+	return result.String(), params
+}
+
+func paramSchema(param *routeParam) *OpenAPISchema {
+	switch param.constraint {
+	case "":
+		return &OpenAPISchema{Type: "string"}
+	case "int":
+		return &OpenAPISchema{Type: "integer", Format: "int64"}
+	case "uint":
+		minimum := 0.0
+		return &OpenAPISchema{Type: "integer", Format: "int64", Minimum: &minimum}
+	case "uuid":
+		return &OpenAPISchema{Type: "string", Format: "uuid"}
+	}
+	return &OpenAPISchema{Type: "string", Pattern: "^(?:" + param.expression + ")$"}
+}
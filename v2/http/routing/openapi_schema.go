@@ -0,0 +1,143 @@
+package gmrouting
+
+import (
+	"reflect"
+	"strings"
+	"time"
+)
+
+// OpenAPISchema is the subset of OpenAPI schema object which is generated from Go types and checked by RequestValidator.
+type OpenAPISchema struct {
+	Ref                  string                    `json:"$ref,omitempty"`
+	Type                 string                    `json:"type,omitempty"`
+	Format               string                    `json:"format,omitempty"`
+	Pattern              string                    `json:"pattern,omitempty"`
+	Enum                 []interface{}             `json:"enum,omitempty"`
+	Minimum              *float64                  `json:"minimum,omitempty"`
+	Maximum              *float64                  `json:"maximum,omitempty"`
+	MinLength            *int                      `json:"minLength,omitempty"`
+	MaxLength            *int                      `json:"maxLength,omitempty"`
+	Nullable             bool                      `json:"nullable,omitempty"`
+	Items                *OpenAPISchema            `json:"items,omitempty"`
+	Properties           map[string]*OpenAPISchema `json:"properties,omitempty"`
+	Required             []string                  `json:"required,omitempty"`
+	AdditionalProperties *OpenAPISchema            `json:"additionalProperties,omitempty"`
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schemaOf builds schema of the type of input sample value.
+// Named struct types are registered to components and referenced via $ref.
+func (d *OpenAPIDocument) schemaOf(sample interface{}) *OpenAPISchema {
+	return d.schemaOfType(reflect.TypeOf(sample))
+}
+
+func (d *OpenAPIDocument) schemaOfType(t reflect.Type) *OpenAPISchema {
+	if t.Kind() == reflect.Pointer {
+		schema := d.schemaOfType(t.Elem())
+		if schema.Ref == "" {
+			schema.Nullable = true
+		}
+		return schema
+	}
+
+	if t == timeType {
+		return &OpenAPISchema{Type: "string", Format: "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &OpenAPISchema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &OpenAPISchema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return &OpenAPISchema{Type: "integer", Format: "int64"}
+	case reflect.Float32:
+		return &OpenAPISchema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &OpenAPISchema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &OpenAPISchema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &OpenAPISchema{Type: "string", Format: "byte"}
+		}
+		return &OpenAPISchema{Type: "array", Items: d.schemaOfType(t.Elem())}
+	case reflect.Map:
+		return &OpenAPISchema{Type: "object", AdditionalProperties: d.schemaOfType(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return d.structSchema(t)
+		}
+		return d.componentRef(t)
+	}
+
+	/* Interfaces and other kinds can hold any value. */
+	return &OpenAPISchema{}
+}
+
+// componentRef registers schema of named struct type to components once and returns a reference to it.
+func (d *OpenAPIDocument) componentRef(t reflect.Type) *OpenAPISchema {
+	if d.Components == nil {
+		d.Components = &OpenAPIComponents{}
+	}
+	if d.Components.Schemas == nil {
+		d.Components.Schemas = make(map[string]*OpenAPISchema)
+	}
+
+	ref := &OpenAPISchema{Ref: "#/components/schemas/" + t.Name()}
+	if d.Components.Schemas[t.Name()] != nil {
+		return ref
+	}
+
+	/* Placeholder is registered first so recursive types reference themselves instead of looping. */
+	schema := &OpenAPISchema{}
+	d.Components.Schemas[t.Name()] = schema
+	*schema = *d.structSchema(t)
+	return ref
+}
+
+// structSchema builds an object schema from exported fields of t, following encoding/json naming rules.
+// Fields without omitempty are required.
+func (d *OpenAPIDocument) structSchema(t reflect.Type) *OpenAPISchema {
+	schema := &OpenAPISchema{
+		Type:       "object",
+		Properties: make(map[string]*OpenAPISchema),
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name := field.Name
+		omitEmpty := false
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		if tag != "" {
+			tagName, options, _ := strings.Cut(tag, ",")
+			if tagName != "" {
+				name = tagName
+			}
+			omitEmpty = strings.Contains(","+options+",", ",omitempty,")
+		}
+
+		if field.Anonymous && tag == "" && field.Type.Kind() == reflect.Struct {
+			embedded := d.structSchema(field.Type)
+			for k, v := range embedded.Properties {
+				schema.Properties[k] = v
+			}
+			schema.Required = append(schema.Required, embedded.Required...)
+			continue
+		}
+
+		schema.Properties[name] = d.schemaOfType(field.Type)
+		if !omitEmpty {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+	return schema
+}
@@ -0,0 +1,110 @@
+package gmrouting
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testTransfer struct {
+	ID        int64          `json:"id"`
+	Amount    float64        `json:"amount"`
+	Note      *string        `json:"note,omitempty"`
+	CreatedAt time.Time      `json:"createdAt"`
+	Tags      []string       `json:"tags,omitempty"`
+	Parent    *testTransfer  `json:"parent,omitempty"`
+	Meta      map[string]int `json:"meta,omitempty"`
+	internal  string
+}
+
+type testCreateTransfer struct {
+	Amount float64 `json:"amount"`
+}
+
+func Test_OpenAPI_Document(t *testing.T) {
+	router, err := NewRouter([]*RouteRule{
+		{
+			Name:        "getTransfer",
+			Method:      `GET`,
+			Path:        `/api/transfers/{id:int}`,
+			DynamicPath: true,
+			Doc: &RouteDoc{
+				Summary:   "Get transfer",
+				Tags:      []string{"transfers"},
+				Responses: map[int]interface{}{http.StatusOK: testTransfer{}, http.StatusNotFound: nil},
+			},
+		},
+		{
+			Method: `POST`,
+			Path:   `/api/transfers`,
+			Doc: &RouteDoc{
+				Request:   testCreateTransfer{},
+				Responses: map[int]interface{}{http.StatusCreated: &testTransfer{}},
+			},
+		},
+		{Method: `GET`, Path: `/static/{path...}`, DynamicPath: true},
+	})
+	assert.NoError(t, err)
+
+	rule := NewProxyRouteRule(`GET`, `/api/accounts/{guid:uuid}/{slug:[a-z]+}`)
+	rule.SetDoc(&RouteDoc{Summary: "Get account"})
+	table, err := NewProxyRouteTable([]*ProxyRouteRule{rule})
+	assert.NoError(t, err)
+
+	doc := NewOpenAPIDocument(OpenAPIInfo{Title: "Transfers", Version: "1.0.0"})
+	doc.AddRouter(router)
+	doc.AddRouteTable(table)
+
+	getTransfer := doc.Paths["/api/transfers/{id}"]["get"]
+	if assert.NotNil(t, getTransfer) {
+		assert.Equal(t, "getTransfer", getTransfer.OperationID)
+		assert.Equal(t, "Get transfer", getTransfer.Summary)
+		assert.Equal(t, []*OpenAPIParameter{
+			{Name: "id", In: "path", Required: true, Schema: &OpenAPISchema{Type: "integer", Format: "int64"}},
+		}, getTransfer.Parameters)
+		assert.Equal(t, "#/components/schemas/testTransfer", getTransfer.Responses["200"].Content["application/json"].Schema.Ref)
+		assert.Nil(t, getTransfer.Responses["404"].Content)
+	}
+
+	createTransfer := doc.Paths["/api/transfers"]["post"]
+	if assert.NotNil(t, createTransfer) {
+		assert.Equal(t, "#/components/schemas/testCreateTransfer", createTransfer.RequestBody.Content["application/json"].Schema.Ref)
+		assert.Equal(t, "Created", createTransfer.Responses["201"].Description)
+	}
+
+	static := doc.Paths["/static/{path}"]["get"]
+	if assert.NotNil(t, static) {
+		assert.NotEmpty(t, static.Parameters[0].Description)
+		assert.Equal(t, "OK", static.Responses["200"].Description)
+	}
+
+	account := doc.Paths["/api/accounts/{guid}/{slug}"]["get"]
+	if assert.NotNil(t, account) {
+		assert.Equal(t, "Get account", account.Summary)
+		assert.Equal(t, "uuid", account.Parameters[0].Schema.Format)
+		assert.Equal(t, "^(?:[a-z]+)$", account.Parameters[1].Schema.Pattern)
+	}
+
+	transferSchema := doc.Components.Schemas["testTransfer"]
+	if assert.NotNil(t, transferSchema) {
+		assert.Equal(t, []string{"id", "amount", "createdAt"}, transferSchema.Required)
+		assert.Equal(t, &OpenAPISchema{Type: "string", Nullable: true}, transferSchema.Properties["note"])
+		assert.Equal(t, &OpenAPISchema{Type: "string", Format: "date-time"}, transferSchema.Properties["createdAt"])
+		assert.Equal(t, "#/components/schemas/testTransfer", transferSchema.Properties["parent"].Ref)
+		assert.Equal(t, "integer", transferSchema.Properties["meta"].AdditionalProperties.Type)
+		assert.NotContains(t, transferSchema.Properties, "internal")
+	}
+
+	rec := httptest.NewRecorder()
+	doc.HandleDocument(rec, httptest.NewRequest(`GET`, `/openapi.json`, nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	served := map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &served))
+	assert.Equal(t, "3.0.3", served["openapi"])
+	assert.Contains(t, served["paths"], "/api/transfers/{id}")
+}
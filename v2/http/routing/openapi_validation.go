@@ -0,0 +1,575 @@
+package gmrouting
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"gopkg.in/yaml.v3"
+)
+
+// maxRefDepth limits $ref hops while resolving a single schema.
+const maxRefDepth = 32
+
+// LoadOpenAPIDocument reads an OpenAPI 3 document from input file. Format is decided by file extension: .yaml, .yml or .json
+//
+// Only the subset of schema keywords which is covered by OpenAPISchema is read.
+func LoadOpenAPIDocument(path string) (*OpenAPIDocument, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		var raw interface{}
+		err = yaml.Unmarshal(data, &raw)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse OpenAPI document: %s", err.Error())
+		}
+		data, err = json.Marshal(stringKeys(raw))
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse OpenAPI document: %s", err.Error())
+		}
+	case ".json":
+	default:
+		return nil, fmt.Errorf("unsupported OpenAPI document file extension: '%s'", filepath.Ext(path))
+	}
+
+	doc := NewOpenAPIDocument(OpenAPIInfo{})
+	err = json.Unmarshal(data, doc)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse OpenAPI document: %s", err.Error())
+	}
+	return doc, nil
+}
+
+// stringKeys converts YAML maps with non-string keys (E.g: status codes) to JSON compatible maps.
+func stringKeys(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for k, e := range v {
+			v[k] = stringKeys(e)
+		}
+		return v
+	case map[interface{}]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			result[fmt.Sprint(k)] = stringKeys(e)
+		}
+		return result
+	case []interface{}:
+		for i, e := range v {
+			v[i] = stringKeys(e)
+		}
+		return v
+	}
+	return value
+}
+
+// SchemaViolation describes a single part of a request which does not match the OpenAPI document.
+type SchemaViolation struct {
+	// In is one of: path, query, header, body
+	In string `json:"in"`
+	// Name is the parameter name, or JSON pointer of the invalid value for body violations. E.g: /items/0/amount
+	Name    string `json:"name,omitempty"`
+	Message string `json:"message"`
+}
+
+// RequestValidator checks requests against operations of an OpenAPI document.
+//
+// Path, query and header parameters and JSON request bodies are validated.
+// Requests which do not match any operation of the document are not validated.
+type RequestValidator struct {
+	doc          *OpenAPIDocument
+	maxBodyBytes int64
+	operations   []*validatedOperation
+	patterns     map[string]*regexp.Regexp
+}
+
+type validatedOperation struct {
+	method string
+	regexp *regexp.Regexp
+	// paramNames are in the order of capturing groups of regexp.
+	paramNames []string
+	operation  *OpenAPIOperation
+}
+
+// NewRequestValidator prepares input document for validating requests.
+//
+// JSON request bodies larger than maxBodyBytes are rejected. maxBodyBytes defaults to 1 MiB if not positive.
+//
+// It will return error if a path template or a schema pattern of the document is invalid.
+func NewRequestValidator(doc *OpenAPIDocument, maxBodyBytes int64) (*RequestValidator, error) {
+	if maxBodyBytes <= 0 {
+		maxBodyBytes = 1 << 20
+	}
+	v := &RequestValidator{
+		doc:          doc,
+		maxBodyBytes: maxBodyBytes,
+		operations:   make([]*validatedOperation, 0),
+		patterns:     make(map[string]*regexp.Regexp),
+	}
+
+	/* Concrete paths are matched before templated ones. */
+	paths := make([]string, 0, len(doc.Paths))
+	for path := range doc.Paths {
+		paths = append(paths, path)
+	}
+	sort.SliceStable(paths, func(i, j int) bool {
+		iTemplated, jTemplated := strings.Contains(paths[i], "{"), strings.Contains(paths[j], "{")
+		if iTemplated != jTemplated {
+			return jTemplated
+		}
+		return paths[i] < paths[j]
+	})
+
+	for _, path := range paths {
+		compiled, paramNames, err := compileOpenAPIPath(path)
+		if err != nil {
+			return nil, fmt.Errorf("invalid OpenAPI path: '%s': %s", path, err.Error())
+		}
+
+		for method, operation := range doc.Paths[path] {
+			v.operations = append(v.operations, &validatedOperation{
+				method:     strings.ToUpper(method),
+				regexp:     compiled,
+				paramNames: paramNames,
+				operation:  operation,
+			})
+
+			for _, p := range operation.Parameters {
+				err = v.compilePatterns(p.Schema)
+				if err != nil {
+					return nil, err
+				}
+			}
+			if operation.RequestBody != nil {
+				for _, c := range operation.RequestBody.Content {
+					err = v.compilePatterns(c.Schema)
+					if err != nil {
+						return nil, err
+					}
+				}
+			}
+		}
+	}
+
+	if doc.Components != nil {
+		for _, s := range doc.Components.Schemas {
+			err := v.compilePatterns(s)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return v, nil
+}
+
+func (v *RequestValidator) compilePatterns(schema *OpenAPISchema) error {
+	if schema == nil {
+		return nil
+	}
+
+	if schema.Pattern != "" && v.patterns[schema.Pattern] == nil {
+		compiled, err := regexp.Compile(schema.Pattern)
+		if err != nil {
+			return fmt.Errorf("invalid schema pattern: '%s': %s", schema.Pattern, err.Error())
+		}
+		v.patterns[schema.Pattern] = compiled
+	}
+
+	children := []*OpenAPISchema{schema.Items, schema.AdditionalProperties}
+	for _, p := range schema.Properties {
+		children = append(children, p)
+	}
+	for _, c := range children {
+		err := v.compilePatterns(c)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Validate checks input request against the matching operation of the document and returns all violations.
+//
+// Operations are matched against escaped path of the request like ProxyClient does, so that an escaped slash
+// can not split a path parameter. Path parameters are validated after they are unescaped.
+//
+// If the request has a JSON body with a schema, body is read and r.Body is replaced so it can still be sent to upstream.
+// Other bodies are not read, only their content type is checked.
+// Returned error is only set if request body can not be read.
+func (v *RequestValidator) Validate(r *http.Request) ([]SchemaViolation, error) {
+	operation, pathParams := v.findOperation(r.Method, r.URL.EscapedPath())
+	if operation == nil {
+		return nil, nil
+	}
+
+	violations := make([]SchemaViolation, 0)
+	query := r.URL.Query()
+
+	for _, p := range operation.Parameters {
+		var values []string
+		switch p.In {
+		case "path":
+			if value, ok := pathParams[p.Name]; ok {
+				values = []string{value}
+			}
+		case "query":
+			values = query[p.Name]
+		case "header":
+			values = r.Header.Values(p.Name)
+		default:
+			continue
+		}
+
+		if len(values) == 0 {
+			if p.Required {
+				violations = append(violations, SchemaViolation{In: p.In, Name: p.Name, Message: "parameter is required"})
+			}
+			continue
+		}
+		violations = v.validateParam(violations, p, values)
+	}
+
+	if operation.RequestBody != nil {
+		var err error
+		violations, err = v.validateBody(violations, r, operation.RequestBody)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return violations, nil
+}
+
+// findOperation returns the operation matching input method and escaped path along with its unescaped path parameters.
+func (v *RequestValidator) findOperation(method, escapedPath string) (*OpenAPIOperation, map[string]string) {
+	for _, o := range v.operations {
+		if o.method != method {
+			continue
+		}
+		match := o.regexp.FindStringSubmatch(escapedPath)
+		if match == nil {
+			continue
+		}
+
+		params := make(map[string]string, len(o.paramNames))
+		for i, name := range o.paramNames {
+			value, err := url.PathUnescape(match[i+1])
+			if err != nil {
+				value = match[i+1]
+			}
+			params[name] = value
+		}
+		return o.operation, params
+	}
+	return nil, nil
+}
+
+// compileOpenAPIPath builds an anchored regular expression which matches escaped request paths against
+// input OpenAPI path template, along with names of its parameters in order of their capturing groups.
+//
+// Unlike route paths, parameter names can contain any character except curly brackets and slashes. E.g: {user-id}
+// Each parameter matches a single non-empty path segment.
+func compileOpenAPIPath(template string) (*regexp.Regexp, []string, error) {
+	regex := strings.Builder{}
+	regex.WriteString("^")
+	names := make([]string, 0)
+
+	rest := template
+	for rest != "" {
+		start := strings.IndexAny(rest, "{}")
+		if start == -1 {
+			regex.WriteString(regexp.QuoteMeta(escapeSegments(rest)))
+			break
+		}
+		if rest[start] == '}' {
+			return nil, nil, fmt.Errorf("unexpected '}'")
+		}
+		regex.WriteString(regexp.QuoteMeta(escapeSegments(rest[:start])))
+
+		end := strings.IndexAny(rest[start+1:], "{}/")
+		if end == -1 || rest[start+1+end] != '}' {
+			return nil, nil, fmt.Errorf("unclosed '{'")
+		}
+		name := rest[start+1 : start+1+end]
+		if name == "" {
+			return nil, nil, fmt.Errorf("empty path parameter name")
+		}
+		names = append(names, name)
+		regex.WriteString(`([^/]+)`)
+		rest = rest[start+1+end+1:]
+	}
+	regex.WriteString("$")
+
+	compiled, err := regexp.Compile(regex.String())
+	if err != nil {
+		return nil, nil, err
+	}
+	return compiled, names, nil
+}
+
+// validateParam converts string values of a parameter according to its schema type and validates them.
+func (v *RequestValidator) validateParam(violations []SchemaViolation, p *OpenAPIParameter, values []string) []SchemaViolation {
+	schema := v.resolve(p.Schema)
+	if schema == nil {
+		return violations
+	}
+
+	if schema.Type == "array" {
+		items := make([]interface{}, 0, len(values))
+		for _, value := range values {
+			converted, ok := convertParam(v.resolve(schema.Items), value)
+			if !ok {
+				return append(violations, SchemaViolation{In: p.In, Name: p.Name, Message: fmt.Sprintf("invalid value: '%s'", value)})
+			}
+			items = append(items, converted)
+		}
+		return v.validateValue(violations, schema, items, p.In, p.Name)
+	}
+
+	converted, ok := convertParam(schema, values[0])
+	if !ok {
+		return append(violations, SchemaViolation{In: p.In, Name: p.Name, Message: fmt.Sprintf("must be of type %s", schema.Type)})
+	}
+	return v.validateValue(violations, schema, converted, p.In, p.Name)
+}
+
+func convertParam(schema *OpenAPISchema, value string) (interface{}, bool) {
+	if schema == nil {
+		return value, true
+	}
+
+	switch schema.Type {
+	case "integer":
+		_, err := strconv.ParseInt(value, 10, 64)
+		return json.Number(value), err == nil
+	case "number":
+		_, err := strconv.ParseFloat(value, 64)
+		return json.Number(value), err == nil
+	case "boolean":
+		parsed, err := strconv.ParseBool(value)
+		return parsed, err == nil
+	}
+	return value, true
+}
+
+// validateBody checks content type of the body and validates JSON bodies against their schema.
+// Only JSON bodies which have a schema are read into memory, other bodies are left to be streamed.
+func (v *RequestValidator) validateBody(violations []SchemaViolation, r *http.Request, requestBody *OpenAPIRequestBody) ([]SchemaViolation, error) {
+	if r.Body == nil || r.Body == http.NoBody || r.ContentLength == 0 {
+		if requestBody.Required {
+			violations = append(violations, SchemaViolation{In: "body", Message: "request body is required"})
+		}
+		return violations, nil
+	}
+
+	contentType := r.Header.Get("Content-Type")
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = contentType
+	}
+	media, ok := requestBody.Content[mediaType]
+	if !ok {
+		return append(violations, SchemaViolation{In: "header", Name: "Content-Type", Message: fmt.Sprintf("unsupported content type: '%s'", contentType)}), nil
+	}
+	if media.Schema == nil || !strings.HasSuffix(mediaType, "json") {
+		return violations, nil
+	}
+
+	if r.ContentLength > v.maxBodyBytes {
+		return append(violations, SchemaViolation{In: "body", Message: fmt.Sprintf("body exceeds %d bytes", v.maxBodyBytes)}), nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, v.maxBodyBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("error reading request body: %s", err.Error())
+	}
+	r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	if int64(len(body)) > v.maxBodyBytes {
+		return append(violations, SchemaViolation{In: "body", Message: fmt.Sprintf("body exceeds %d bytes", v.maxBodyBytes)}), nil
+	}
+	if len(body) == 0 {
+		if requestBody.Required {
+			violations = append(violations, SchemaViolation{In: "body", Message: "request body is required"})
+		}
+		return violations, nil
+	}
+
+	var value interface{}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	err = decoder.Decode(&value)
+	if err != nil {
+		return append(violations, SchemaViolation{In: "body", Message: "invalid JSON: " + err.Error()}), nil
+	}
+
+	return v.validateValue(violations, media.Schema, value, "body", ""), nil
+}
+
+// resolve follows $ref of input schema to components. It returns nil for unknown references.
+func (v *RequestValidator) resolve(schema *OpenAPISchema) *OpenAPISchema {
+	for i := 0; schema != nil && schema.Ref != "" && i < maxRefDepth; i++ {
+		if v.doc.Components == nil {
+			return nil
+		}
+		schema = v.doc.Components.Schemas[strings.TrimPrefix(schema.Ref, "#/components/schemas/")]
+	}
+	if schema != nil && schema.Ref != "" {
+		return nil
+	}
+	return schema
+}
+
+func (v *RequestValidator) validateValue(violations []SchemaViolation, schema *OpenAPISchema, value interface{}, in, name string) []SchemaViolation {
+	schema = v.resolve(schema)
+	if schema == nil {
+		return violations
+	}
+
+	violation := func(format string, args ...interface{}) []SchemaViolation {
+		return append(violations, SchemaViolation{In: in, Name: name, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if value == nil {
+		if schema.Nullable || schema.Type == "" {
+			return violations
+		}
+		return violation("must not be null")
+	}
+
+	if len(schema.Enum) > 0 {
+		found := false
+		for _, e := range schema.Enum {
+			if fmt.Sprint(e) == fmt.Sprint(value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return violation("must be one of: %v", schema.Enum)
+		}
+	}
+
+	switch schema.Type {
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return violation("must be of type object")
+		}
+		for _, required := range schema.Required {
+			if _, ok := object[required]; !ok {
+				violations = append(violations, SchemaViolation{In: in, Name: name + "/" + required, Message: "property is required"})
+			}
+		}
+
+		keys := make([]string, 0, len(object))
+		for k := range object {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			property := schema.Properties[k]
+			if property == nil {
+				property = schema.AdditionalProperties
+			}
+			if property != nil {
+				violations = v.validateValue(violations, property, object[k], in, name+"/"+k)
+			}
+		}
+		return violations
+
+	case "array":
+		array, ok := value.([]interface{})
+		if !ok {
+			return violation("must be of type array")
+		}
+		if schema.Items != nil {
+			for i, e := range array {
+				violations = v.validateValue(violations, schema.Items, e, in, name+"/"+strconv.Itoa(i))
+			}
+		}
+		return violations
+
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			return violation("must be of type string")
+		}
+		length := utf8.RuneCountInString(s)
+		if schema.MinLength != nil && length < *schema.MinLength {
+			return violation("must be at least %d characters", *schema.MinLength)
+		}
+		if schema.MaxLength != nil && length > *schema.MaxLength {
+			return violation("must be at most %d characters", *schema.MaxLength)
+		}
+		if schema.Pattern != "" && !v.patterns[schema.Pattern].MatchString(s) {
+			return violation("must match pattern: '%s'", schema.Pattern)
+		}
+		if !validFormat(schema.Format, s) {
+			return violation("must be in %s format", schema.Format)
+		}
+		return violations
+
+	case "integer", "number":
+		number, ok := value.(json.Number)
+		if !ok {
+			return violation("must be of type %s", schema.Type)
+		}
+		if schema.Type == "integer" {
+			if _, err := number.Int64(); err != nil {
+				return violation("must be of type integer")
+			}
+		}
+		f, err := number.Float64()
+		if err != nil {
+			return violation("must be of type %s", schema.Type)
+		}
+		if schema.Minimum != nil && f < *schema.Minimum {
+			return violation("must be greater than or equal to %v", *schema.Minimum)
+		}
+		if schema.Maximum != nil && f > *schema.Maximum {
+			return violation("must be less than or equal to %v", *schema.Maximum)
+		}
+		return violations
+
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return violation("must be of type boolean")
+		}
+	}
+	return violations
+}
+
+// validFormat checks string formats which are generated by OpenAPIDocument. Unknown formats are accepted.
+func validFormat(format, value string) bool {
+	switch format {
+	case "uuid":
+		_, err := uuid.Parse(value)
+		return err == nil
+	case "date-time":
+		_, err := time.Parse(time.RFC3339, value)
+		return err == nil
+	case "date":
+		_, err := time.Parse(time.DateOnly, value)
+		return err == nil
+	}
+	return true
+}
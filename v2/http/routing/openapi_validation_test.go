@@ -0,0 +1,274 @@
+package gmrouting
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	gmhttp "github.com/onuryurdupak/gomod/v2/http"
+	"github.com/stretchr/testify/assert"
+)
+
+const testOpenAPIDocument = `
+openapi: 3.0.3
+info: {title: Transfers, version: 1.0.0}
+paths:
+  /api/transfers:
+    post:
+      parameters:
+        - {name: dryRun, in: query, required: false, schema: {type: boolean}}
+        - {name: X-Tenant, in: header, required: true, schema: {type: string, pattern: "^[a-z]+$"}}
+      requestBody:
+        required: true
+        content:
+          application/json:
+            schema: {$ref: "#/components/schemas/CreateTransfer"}
+      responses:
+        201: {description: Created}
+  /api/transfers/{id}/attachments:
+    post:
+      requestBody:
+        content:
+          application/octet-stream:
+            schema: {type: string, format: binary}
+      responses:
+        201: {description: Created}
+  /api/users/{user-id}:
+    get:
+      parameters:
+        - {name: user-id, in: path, required: true, schema: {type: integer}}
+      responses:
+        200: {description: OK}
+  /api/transfers/{id}:
+    get:
+      parameters:
+        - {name: id, in: path, required: true, schema: {type: integer, minimum: 1}}
+        - {name: fields, in: query, schema: {type: array, items: {type: string, enum: [amount, currency]}}}
+      responses:
+        200: {description: OK}
+components:
+  schemas:
+    CreateTransfer:
+      type: object
+      required: [amount, currency]
+      properties:
+        amount: {type: number, minimum: 0.01}
+        currency: {type: string, minLength: 3, maxLength: 3}
+        reference: {type: string, format: uuid}
+        items:
+          type: array
+          items: {type: object, required: [sku], properties: {sku: {type: string}}}
+`
+
+func Test_Request_Validator(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "openapi.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte(testOpenAPIDocument), 0600))
+
+	doc, err := LoadOpenAPIDocument(path)
+	assert.NoError(t, err)
+
+	validator, err := NewRequestValidator(doc, 1024)
+	assert.NoError(t, err)
+
+	type testData struct {
+		method     string
+		target     string
+		header     map[string]string
+		body       string
+		violations []SchemaViolation
+	}
+
+	data := []testData{
+		{method: `GET`, target: `/api/transfers/42?fields=amount&fields=currency`},
+		{method: `GET`, target: `/api/transfers/0`, violations: []SchemaViolation{
+			{In: "path", Name: "id", Message: "must be greater than or equal to 1"},
+		}},
+		{method: `GET`, target: `/api/transfers/abc?fields=fee`, violations: []SchemaViolation{
+			{In: "path", Name: "id", Message: "must be of type integer"},
+			{In: "query", Name: "fields/0", Message: "must be one of: [amount currency]"},
+		}},
+		{method: `GET`, target: `/api/users/7`},
+		{method: `GET`, target: `/api/users/me`, violations: []SchemaViolation{
+			{In: "path", Name: "user-id", Message: "must be of type integer"},
+		}},
+		// Escaped slash does not split a path parameter, as in ProxyClient. Parameter is validated unescaped.
+		{method: `GET`, target: `/api/transfers/42%2F1`, violations: []SchemaViolation{
+			{In: "path", Name: "id", Message: "must be of type integer"},
+		}},
+		// Operations which are not in the document are not validated.
+		{method: `DELETE`, target: `/api/transfers/abc`},
+		{
+			method: `POST`, target: `/api/transfers?dryRun=true`,
+			header: map[string]string{"X-Tenant": "acme", "Content-Type": "application/json; charset=utf-8"},
+			body:   `{"amount": 10.5, "currency": "EUR", "reference": "6ba7b810-9dad-11d1-80b4-00c04fd430c8", "items": [{"sku": "a"}]}`,
+		},
+		{
+			method: `POST`, target: `/api/transfers?dryRun=maybe`,
+			header: map[string]string{"X-Tenant": "ACME", "Content-Type": "application/json"},
+			body:   `{"amount": 0, "currency": "EURO", "reference": "abc", "items": [{}]}`,
+			violations: []SchemaViolation{
+				{In: "query", Name: "dryRun", Message: "must be of type boolean"},
+				{In: "header", Name: "X-Tenant", Message: "must match pattern: '^[a-z]+$'"},
+				{In: "body", Name: "/amount", Message: "must be greater than or equal to 0.01"},
+				{In: "body", Name: "/currency", Message: "must be at most 3 characters"},
+				{In: "body", Name: "/items/0/sku", Message: "property is required"},
+				{In: "body", Name: "/reference", Message: "must be in uuid format"},
+			},
+		},
+		{
+			method: `POST`, target: `/api/transfers`,
+			header: map[string]string{"X-Tenant": "acme", "Content-Type": "application/json"},
+			body:   `{"amount": "10"}`,
+			violations: []SchemaViolation{
+				{In: "body", Name: "/currency", Message: "property is required"},
+				{In: "body", Name: "/amount", Message: "must be of type number"},
+			},
+		},
+		{
+			method: `POST`, target: `/api/transfers`,
+			header: map[string]string{"X-Tenant": "acme", "Content-Type": "text/plain"},
+			body:   `amount=10`,
+			violations: []SchemaViolation{
+				{In: "header", Name: "Content-Type", Message: "unsupported content type: 'text/plain'"},
+			},
+		},
+		{
+			method: `POST`, target: `/api/transfers`,
+			violations: []SchemaViolation{
+				{In: "header", Name: "X-Tenant", Message: "parameter is required"},
+				{In: "body", Message: "request body is required"},
+			},
+		},
+	}
+
+	for _, td := range data {
+		req := httptest.NewRequest(td.method, td.target, bytes.NewReader([]byte(td.body)))
+		if td.body == "" {
+			req.Body = http.NoBody
+		}
+		for k, v := range td.header {
+			req.Header.Set(k, v)
+		}
+
+		violations, err := validator.Validate(req)
+		assert.NoError(t, err, td.target)
+		if td.violations == nil {
+			assert.Empty(t, violations, td.target)
+		} else {
+			assert.Equal(t, td.violations, violations, td.target)
+		}
+
+		/* Body is still readable after validation. */
+		body, err := io.ReadAll(req.Body)
+		assert.NoError(t, err)
+		assert.Equal(t, td.body, string(body))
+	}
+
+	req := httptest.NewRequest(`POST`, `/api/transfers`, bytes.NewReader(bytes.Repeat([]byte(" "), 2048)))
+	req.Header.Set("X-Tenant", "acme")
+	req.Header.Set("Content-Type", "application/json")
+	violations, err := validator.Validate(req)
+	assert.NoError(t, err)
+	assert.Equal(t, []SchemaViolation{{In: "body", Message: "body exceeds 1024 bytes"}}, violations)
+
+	/* Body of unknown length is read up to the limit. */
+	req = httptest.NewRequest(`POST`, `/api/transfers`, bytes.NewReader(bytes.Repeat([]byte(" "), 2048)))
+	req.ContentLength = -1
+	req.Header.Set("X-Tenant", "acme")
+	req.Header.Set("Content-Type", "application/json")
+	violations, err = validator.Validate(req)
+	assert.NoError(t, err)
+	assert.Equal(t, []SchemaViolation{{In: "body", Message: "body exceeds 1024 bytes"}}, violations)
+
+	/* Bodies which are not JSON are never read, regardless of their size. */
+	upload := &countingReader{Reader: bytes.NewReader(bytes.Repeat([]byte("x"), 4096))}
+	req = httptest.NewRequest(`POST`, `/api/transfers/1/attachments`, upload)
+	req.Header.Set("Content-Type", "application/octet-stream")
+	violations, err = validator.Validate(req)
+	assert.NoError(t, err)
+	assert.Empty(t, violations)
+	assert.Equal(t, 0, upload.read)
+
+	_, err = NewRequestValidator(&OpenAPIDocument{Paths: map[string]map[string]*OpenAPIOperation{
+		"/api": {"get": {Parameters: []*OpenAPIParameter{{Name: "q", In: "query", Schema: &OpenAPISchema{Type: "string", Pattern: "[a-"}}}}},
+	}}, 0)
+	assert.Error(t, err)
+
+	for _, path := range []string{`/api/{id`, `/api/{}`, `/api/id}`, `/api/{a/b}`} {
+		_, err = NewRequestValidator(&OpenAPIDocument{Paths: map[string]map[string]*OpenAPIOperation{
+			path: {"get": {}},
+		}}, 0)
+		assert.Error(t, err, path)
+	}
+}
+
+func Test_Proxy_Request_Validation(t *testing.T) {
+	hits := 0
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		io.Copy(w, r.Body)
+	}))
+	defer upstream.Close()
+
+	rule := NewProxyRouteRule(`POST`, `/api/transfers`)
+	rule.SetDoc(&RouteDoc{Request: testCreateTransfer{}})
+	table, err := NewProxyRouteTable([]*ProxyRouteRule{rule})
+	assert.NoError(t, err)
+
+	doc := NewOpenAPIDocument(OpenAPIInfo{Title: "Transfers", Version: "1.0.0"})
+	doc.AddRouteTable(table)
+	validator, err := NewRequestValidator(doc, 0)
+	assert.NoError(t, err)
+
+	var errs []error
+	pc := NewProxyClient(table, upstream.URL, upstream.Client(), gmhttp.NewResponseWriter(), nil,
+		func(ctx context.Context, err error) { errs = append(errs, err) }, nil, nil)
+	pc.SetRequestValidator(validator)
+
+	for _, streaming := range []bool{false, true} {
+		pc.SetStreaming(streaming, 1024)
+
+		req := httptest.NewRequest(`POST`, `/api/transfers`, bytes.NewReader([]byte(`{"amount": "ten"}`)))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		pc.HandleRequestAndRedirect(rec, req)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		res := struct {
+			Message    string            `json:"message"`
+			Violations []SchemaViolation `json:"violations"`
+		}{}
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+		assert.Equal(t, "invalid request", res.Message)
+		assert.Equal(t, []SchemaViolation{{In: "body", Name: "/amount", Message: "must be of type number"}}, res.Violations)
+
+		req = httptest.NewRequest(`POST`, `/api/transfers`, bytes.NewReader([]byte(`{"amount": 10}`)))
+		req.Header.Set("Content-Type", "application/json")
+		rec = httptest.NewRecorder()
+		pc.HandleRequestAndRedirect(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, `{"amount": 10}`, rec.Body.String())
+	}
+
+	assert.Equal(t, 2, hits)
+	assert.Len(t, errs, 2)
+}
+
+// countingReader records the number of bytes read from it.
+type countingReader struct {
+	io.Reader
+	read int
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.read += n
+	return n, err
+}
@@ -0,0 +1,162 @@
+package gmrouting
+
+import (
+	"net/http"
+	"path"
+	"strings"
+)
+
+type TrailingSlashPolicy int
+
+const (
+	// TrailingSlashStrict treats `/accounts/` and `/accounts` as different paths.
+	TrailingSlashStrict TrailingSlashPolicy = iota
+	// TrailingSlashTrim removes the trailing slash before matching, so `/accounts/` matches `/accounts`.
+	TrailingSlashTrim
+	// TrailingSlashRedirect redirects `/accounts/` to `/accounts` if the latter has a matching rule.
+	// GET and HEAD requests are redirected with 301, others with 308 so method and body are kept.
+	TrailingSlashRedirect
+)
+
+// PathNormalizer converts escaped request paths to a canonical form before they are matched against rules.
+//
+// E.g: With all options enabled, `/api//%61ccounts/./42/` will be matched as `/api/accounts/42`.
+type PathNormalizer struct {
+	// CleanPath removes duplicate slashes and resolves dot segments. E.g: `/api//x/../accounts` => `/api/accounts`
+	CleanPath bool
+	// DecodeUnreserved decodes percent-encoded unreserved characters (letters, digits, `-`, `.`, `_`, `~`)
+	// and upper cases hex digits of the other escapes. E.g: `/api/%61ccounts%2f` => `/api/accounts%2F`
+	// Escaped slashes are kept, so they never split a segment.
+	DecodeUnreserved bool
+	TrailingSlash    TrailingSlashPolicy
+	// CaseInsensitive makes static parts of rule paths match regardless of case. Route parameter values keep their case.
+	CaseInsensitive bool
+}
+
+// DefaultPathNormalizer cleans paths and decodes unreserved escapes. Trailing slashes and case are significant.
+//
+// It is used by Router and ProxyClient unless another one is set.
+func DefaultPathNormalizer() *PathNormalizer {
+	return &PathNormalizer{
+		CleanPath:        true,
+		DecodeUnreserved: true,
+		TrailingSlash:    TrailingSlashStrict,
+	}
+}
+
+// Normalize returns canonical form of input escaped path. Nil normalizer returns input as is.
+func (n *PathNormalizer) Normalize(escapedPath string) string {
+	if n == nil {
+		return escapedPath
+	}
+
+	result := escapedPath
+	if n.DecodeUnreserved {
+		result = decodeUnreserved(result)
+	}
+	if n.CleanPath {
+		result = cleanPath(result)
+	}
+	if n.TrailingSlash == TrailingSlashTrim {
+		result = trimTrailingSlash(result)
+	}
+	return result
+}
+
+// normalizeRule applies trailing slash policy to a rule path, so rules registered with a trailing slash still match.
+func (n *PathNormalizer) normalizeRule(rulePath string) string {
+	if n != nil && n.TrailingSlash == TrailingSlashTrim {
+		return trimTrailingSlash(rulePath)
+	}
+	return rulePath
+}
+
+func (n *PathNormalizer) foldCase() bool {
+	return n != nil && n.CaseInsensitive
+}
+
+// redirectTarget returns where a request with input normalized path should be redirected to due to trailing slash policy.
+// It returns false if no redirect is needed.
+func (n *PathNormalizer) redirectTarget(normalizedPath string) (string, bool) {
+	if n == nil || n.TrailingSlash != TrailingSlashRedirect || normalizedPath == "/" || !strings.HasSuffix(normalizedPath, "/") {
+		return "", false
+	}
+	return trimTrailingSlash(normalizedPath), true
+}
+
+// writeRedirect redirects r to input path keeping its query.
+func writeRedirect(w http.ResponseWriter, r *http.Request, target string) {
+	if r.URL.RawQuery != "" {
+		target += "?" + r.URL.RawQuery
+	}
+
+	statusCode := http.StatusPermanentRedirect
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		statusCode = http.StatusMovedPermanently
+	}
+	http.Redirect(w, r, target, statusCode)
+}
+
+func cleanPath(p string) string {
+	if p == "" {
+		return "/"
+	}
+
+	trailing := strings.HasSuffix(p, "/") || strings.HasSuffix(p, "/.") || strings.HasSuffix(p, "/..")
+	cleaned := path.Clean("/" + p)
+	if trailing && cleaned != "/" {
+		cleaned += "/"
+	}
+	return cleaned
+}
+
+func trimTrailingSlash(p string) string {
+	trimmed := strings.TrimRight(p, "/")
+	if trimmed == "" {
+		return "/"
+	}
+	return trimmed
+}
+
+func decodeUnreserved(p string) string {
+	if !strings.Contains(p, "%") {
+		return p
+	}
+
+	result := strings.Builder{}
+	result.Grow(len(p))
+	for i := 0; i < len(p); i++ {
+		if p[i] != '%' || i+2 >= len(p) || !isHex(p[i+1]) || !isHex(p[i+2]) {
+			result.WriteByte(p[i])
+			continue
+		}
+
+		c := unhex(p[i+1])<<4 | unhex(p[i+2])
+		if isUnreserved(c) {
+			result.WriteByte(c)
+		} else {
+			result.WriteByte('%')
+			result.WriteString(strings.ToUpper(p[i+1 : i+3]))
+		}
+		i += 2
+	}
+	return result.String()
+}
+
+func isUnreserved(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '-' || c == '.' || c == '_' || c == '~'
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	}
+	return c - 'A' + 10
+}
@@ -0,0 +1,207 @@
+package gmrouting
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	gmhttp "github.com/onuryurdupak/gomod/v2/http"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Path_Normalizer(t *testing.T) {
+	type testData struct {
+		normalizer *PathNormalizer
+		input      string
+		expected   string
+	}
+
+	all := &PathNormalizer{CleanPath: true, DecodeUnreserved: true, TrailingSlash: TrailingSlashTrim, CaseInsensitive: true}
+
+	data := []testData{
+		{normalizer: DefaultPathNormalizer(), input: `/api//accounts`, expected: `/api/accounts`},
+		{normalizer: DefaultPathNormalizer(), input: `/api/%61ccounts`, expected: `/api/accounts`},
+		{normalizer: DefaultPathNormalizer(), input: `/api/./x/../accounts`, expected: `/api/accounts`},
+		{normalizer: DefaultPathNormalizer(), input: `/api/%2e%2e/admin`, expected: `/admin`},
+		{normalizer: DefaultPathNormalizer(), input: `/api/accounts/`, expected: `/api/accounts/`},
+		{normalizer: DefaultPathNormalizer(), input: `/api/a%2fb%20c%zz`, expected: `/api/a%2Fb%20c%zz`},
+		{normalizer: DefaultPathNormalizer(), input: `/../..`, expected: `/`},
+		{normalizer: DefaultPathNormalizer(), input: ``, expected: `/`},
+		{normalizer: all, input: `/api//%61ccounts/./42/`, expected: `/api/accounts/42`},
+		{normalizer: all, input: `/`, expected: `/`},
+		{normalizer: &PathNormalizer{}, input: `/api//accounts/`, expected: `/api//accounts/`},
+		{normalizer: nil, input: `/api/%61ccounts`, expected: `/api/%61ccounts`},
+	}
+
+	for _, td := range data {
+		assert.Equal(t, td.expected, td.normalizer.Normalize(td.input), td.input)
+	}
+}
+
+func Test_Router_Path_Normalization(t *testing.T) {
+	router, err := NewRouter([]*RouteRule{
+		{Method: `GET`, Path: `/api/accounts`},
+		{Method: `GET`, Path: `/api/Accounts/{id:int}`, DynamicPath: true},
+		{Method: `GET`, Path: `/files/{name}.json`, DynamicPath: true},
+		{Method: `POST`, Path: `/api/transfers/`},
+	})
+	assert.NoError(t, err)
+
+	type testData struct {
+		method string
+		target string
+		match  bool
+	}
+
+	data := []testData{
+		{method: `GET`, target: `/api//accounts`, match: true},
+		{method: `GET`, target: `/api/%61ccounts?x=1`, match: true},
+		{method: `GET`, target: `/api/x/../accounts`, match: true},
+		{method: `GET`, target: `/api/accounts/`, match: false},
+		{method: `GET`, target: `/API/accounts`, match: false},
+		{method: `GET`, target: `/api/accounts/42`, match: false},
+		{method: `GET`, target: `/api/Accounts/42`, match: true},
+		{method: `GET`, target: `/files/a.json`, match: true},
+		{method: `GET`, target: `/FILES/a.JSON`, match: false},
+		{method: `POST`, target: `/api/transfers/`, match: true},
+		{method: `POST`, target: `/api/transfers`, match: false},
+	}
+
+	for _, td := range data {
+		assert.Equal(t, td.match, router.HasMatch(httptest.NewRequest(td.method, td.target, nil)), td.target)
+	}
+
+	err = router.SetPathNormalizer(&PathNormalizer{CleanPath: true, DecodeUnreserved: true, TrailingSlash: TrailingSlashTrim, CaseInsensitive: true})
+	assert.NoError(t, err)
+
+	data = []testData{
+		{method: `GET`, target: `/api/accounts/`, match: true},
+		{method: `GET`, target: `/API/accounts`, match: true},
+		{method: `GET`, target: `/api/accounts/42`, match: true},
+		{method: `GET`, target: `/api/accounts/x`, match: false},
+		{method: `GET`, target: `/FILES/a.JSON`, match: true},
+		{method: `POST`, target: `/api/transfers`, match: true},
+		{method: `POST`, target: `/api/Transfers/`, match: true},
+	}
+
+	for _, td := range data {
+		assert.Equal(t, td.match, router.HasMatch(httptest.NewRequest(td.method, td.target, nil)), td.target)
+	}
+
+	match := router.FindMatch(httptest.NewRequest(`GET`, `/files/MyFile.json`, nil))
+	assert.Equal(t, "MyFile", match.RouteParams["name"])
+
+	explanation := router.Explain(`GET`, `/API//accounts/`)
+	assert.Equal(t, `/API/accounts`, explanation.Path)
+	assert.Equal(t, OutcomeMatched, explanation.Outcome)
+	assert.True(t, explanation.Candidates[0].Selected)
+
+	/* Rules which only differ by trailing slash conflict once it is trimmed. Previous normalizer is kept. */
+	conflicting, err := NewRouter([]*RouteRule{
+		{Method: `GET`, Path: `/api/accounts`},
+		{Method: `GET`, Path: `/api/accounts/`},
+	})
+	assert.NoError(t, err)
+	err = conflicting.SetPathNormalizer(&PathNormalizer{TrailingSlash: TrailingSlashTrim})
+	assert.Error(t, err)
+	assert.True(t, conflicting.HasMatch(httptest.NewRequest(`GET`, `/api/accounts/`, nil)))
+}
+
+func Test_Router_Trailing_Slash_Redirect(t *testing.T) {
+	router, err := NewRouter([]*RouteRule{
+		{Method: `GET`, Path: `/api/accounts`, RouteTo: func(w http.ResponseWriter, r *http.Request, routeParams map[string]string) {}},
+		{Method: `POST`, Path: `/api/transfers`, RouteTo: func(w http.ResponseWriter, r *http.Request, routeParams map[string]string) {}},
+	})
+	assert.NoError(t, err)
+
+	normalizer := DefaultPathNormalizer()
+	normalizer.TrailingSlash = TrailingSlashRedirect
+	assert.NoError(t, router.SetPathNormalizer(normalizer))
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(`GET`, `/api//accounts/?page=2`, nil))
+	assert.Equal(t, http.StatusMovedPermanently, rec.Code)
+	assert.Equal(t, `/api/accounts?page=2`, rec.Header().Get("Location"))
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(`POST`, `/api/transfers/`, nil))
+	assert.Equal(t, http.StatusPermanentRedirect, rec.Code)
+	assert.Equal(t, `/api/transfers`, rec.Header().Get("Location"))
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(`GET`, `/api/transfers/`, nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(`GET`, `/api/accounts`, nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func Test_Proxy_Path_Normalization(t *testing.T) {
+	var received []string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = append(received, r.URL.RequestURI())
+	}))
+	defer upstream.Close()
+
+	table, err := NewProxyRouteTable([]*ProxyRouteRule{
+		NewProxyRouteRule(`GET`, `/api/accounts`),
+		NewProxyRouteRuleWithTarget(`GET`, `/api/files/{name}`, &ProxyTarget{PathRewrite: `/files/{name}`}),
+	})
+	assert.NoError(t, err)
+
+	pc := NewProxyClient(table, upstream.URL, upstream.Client(), gmhttp.NewResponseWriter(), []string{`/health`}, nil, nil, nil)
+
+	type testData struct {
+		target   string
+		status   int
+		received string
+	}
+
+	data := []testData{
+		{target: `/api//accounts?x=1`, status: http.StatusOK, received: `/api/accounts?x=1`},
+		{target: `/api/%61ccounts`, status: http.StatusOK, received: `/api/accounts`},
+		{target: `/api/admin/../accounts`, status: http.StatusOK, received: `/api/accounts`},
+		{target: `/api/files/a%2Fb`, status: http.StatusOK, received: `/files/a%2Fb`},
+		{target: `/api/files/a/b`, status: http.StatusUnauthorized},
+		/* Escaped slashes never split a segment, so upstream receives a single segment. */
+		{target: `/api/files/..%2f..%2fadmin`, status: http.StatusOK, received: `/files/..%2F..%2Fadmin`},
+		{target: `/API/accounts`, status: http.StatusUnauthorized},
+		{target: `/api/accounts/`, status: http.StatusUnauthorized},
+		{target: `//health`, status: http.StatusOK},
+	}
+
+	for _, td := range data {
+		received = nil
+		rec := httptest.NewRecorder()
+		pc.HandleRequestAndRedirect(rec, httptest.NewRequest(`GET`, td.target, nil))
+		assert.Equal(t, td.status, rec.Code, td.target)
+		if td.received != "" {
+			assert.Equal(t, []string{td.received}, received, td.target)
+		} else {
+			assert.Empty(t, received, td.target)
+		}
+	}
+
+	pc.SetPathNormalizer(&PathNormalizer{CleanPath: true, TrailingSlash: TrailingSlashRedirect, CaseInsensitive: true})
+
+	rec := httptest.NewRecorder()
+	pc.HandleRequestAndRedirect(rec, httptest.NewRequest(`GET`, `/API/accounts/`, nil))
+	assert.Equal(t, http.StatusMovedPermanently, rec.Code)
+	assert.Equal(t, `/API/accounts`, rec.Header().Get("Location"))
+
+	received = nil
+	rec = httptest.NewRecorder()
+	pc.HandleRequestAndRedirect(rec, httptest.NewRequest(`GET`, `/API/accounts`, nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, []string{`/API/accounts`}, received)
+
+	explanation := pc.Explain(`GET`, `/Api//Accounts`)
+	assert.Equal(t, OutcomeAllowed, explanation.Outcome)
+	assert.Equal(t, `/Api/Accounts`, explanation.Path)
+
+	pc.SetPathNormalizer(nil)
+	rec = httptest.NewRecorder()
+	pc.HandleRequestAndRedirect(rec, httptest.NewRequest(`GET`, `/api//accounts`, nil))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
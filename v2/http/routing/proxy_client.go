@@ -4,10 +4,18 @@ import (
 	"bytes"
 	"compress/gzip"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
 	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	gmsession "github.com/onuryurdupak/gomod/v2/session"
 )
 
 type responseWriter interface {
@@ -15,20 +23,55 @@ type responseWriter interface {
 }
 
 type ProxyClient struct {
-	routeTable     *RouteTable
+	// routeTable is swapped atomically on reload. Each request uses the table which is loaded when it is received.
+	routeTable     atomic.Pointer[RouteTable]
 	routeUrl       string
 	httpCli        *http.Client
 	responseWriter responseWriter
 	ignoredPaths   map[string]bool
+	// upstreamPool replaces routeUrl with a set of balanced upstreams when set.
+	upstreamPool *UpstreamPool
+	// healthChecker makes proxy client skip upstreams which fail active health checks.
+	healthChecker *HealthChecker
+	// retryPolicy decides whether failed upstream requests are sent again.
+	retryPolicy *RetryPolicy
+	// circuitBreaker rejects requests to upstreams which keep failing.
+	circuitBreaker *CircuitBreaker
+	// rateLimiter rejects clients which exceed their request rate.
+	rateLimiter *RateLimiter
+	// requestValidator rejects requests which do not match the OpenAPI document.
+	requestValidator *RequestValidator
+	// responseCache serves GET requests from stored upstream responses.
+	responseCache *ResponseCache
+	// requestCoalescer shares a single upstream response among identical requests which are in flight at the same time.
+	requestCoalescer *RequestCoalescer
+	// normalizer is applied to request paths before they are checked against route table.
+	normalizer *PathNormalizer
+	// forwarding sanitizes headers of upstream requests and adds forwarding headers to them.
+	forwarding *forwarding
+
+	// streaming pipes request and response bodies instead of reading them into memory as a whole.
+	streaming bool
+	// maxHookBytes caps body bytes delivered to onReqRead and onResRead hooks in streaming mode.
+	maxHookBytes int
+	// upgradeIdleTimeout closes tunnels of upgraded connections which carry no data for this long.
+	upgradeIdleTimeout time.Duration
 
 	onErr     func(context.Context, error)
 	onReqRead func(context.Context, []byte)
 	onResRead func(context.Context, []byte)
+	// onEvent receives events of text/event-stream responses.
+	onEvent func(context.Context, ServerSentEvent)
+	// observer receives structured events in addition to the hooks above.
+	observer ProxyObserver
 }
 
 // NewProxyClient creates a new proxy client instance.
 // Underlying HandleRequestAndRedirect method can be registered as a handler function.
 // Handler function will redirect incoming request to the routeUrl.
+// (Unless matching ProxyRouteRule has its own target. See NewProxyRouteRuleWithTarget.)
+//
+// routeTable can be replaced at runtime via SetRouteTable or WatchRouteConfig.
 //
 // ignoredPaths will return 200 without any other http content.
 // (ignoredPaths must be exact paths. Regex is not supported.)
@@ -41,20 +84,25 @@ type ProxyClient struct {
 //
 // onResRead: Can be registered to get outgoing response body.
 //
-// Hooks will contain a second string value which represents session ID.
+// Context passed to hooks carries a session ID which can be read via SessionIDFromContext.
 // Events which output the same session ID belong to same http session.
+//
+// See SetObserver for structured events which also contain status codes, timings and the matched rule.
 func NewProxyClient(routeTable *RouteTable, routeUrl string, httpCli *http.Client, responseWriter responseWriter, ignoredPaths []string, onErr func(context.Context, error), onReqRead func(context.Context, []byte), onResRead func(context.Context, []byte)) *ProxyClient {
 	pc := &ProxyClient{
-		routeTable:     routeTable,
 		routeUrl:       routeUrl,
 		httpCli:        httpCli,
 		responseWriter: responseWriter,
+		normalizer:     DefaultPathNormalizer(),
 
 		onErr:     onErr,
 		onReqRead: onReqRead,
 		onResRead: onResRead,
 	}
 
+	pc.routeTable.Store(routeTable)
+	pc.forwarding, _ = newForwarding(DefaultForwardingConfig())
+
 	pc.ignoredPaths = make(map[string]bool, len(ignoredPaths))
 	for _, path := range ignoredPaths {
 		pc.ignoredPaths[path] = true
@@ -62,231 +110,375 @@ func NewProxyClient(routeTable *RouteTable, routeUrl string, httpCli *http.Clien
 	return pc
 }
 
+// SetStreaming enables or disables streaming mode.
+//
+// In streaming mode request and response bodies are piped between client and upstream with bounded memory
+// instead of being read into memory as a whole.
+//
+// onReqRead and onResRead hooks will receive a copy of at most maxHookBytes bytes of the bodies.
+// (Gzip encoded response bodies are decompressed up to the same limit.)
+//
+// Once the upstream response header is written to client, later errors can only be reported via onErr hook.
+func (pc *ProxyClient) SetStreaming(enabled bool, maxHookBytes int) {
+	pc.streaming = enabled
+	pc.maxHookBytes = maxHookBytes
+}
+
+// SetUpstreamPool makes proxy client balance requests among pool upstreams instead of redirecting them to routeUrl.
+//
+// Responds with 503 if pool has no available upstream.
+func (pc *ProxyClient) SetUpstreamPool(pool *UpstreamPool) {
+	pc.upstreamPool = pool
+}
+
+// SetHealthChecker makes proxy client avoid upstreams which are reported as down by healthChecker.
+//
+// Responds with 503 without contacting upstream if no healthy upstream exists for the request.
+// Note that healthChecker must be started separately.
+func (pc *ProxyClient) SetHealthChecker(healthChecker *HealthChecker) {
+	pc.healthChecker = healthChecker
+}
+
+// SetRetryPolicy makes proxy client retry failed upstream requests according to policy.
+//
+// Request bodies can only be replayed in buffered mode. In streaming mode only requests without a body are retried.
+// When an upstream pool is set, every retry picks an upstream from the pool again.
+func (pc *ProxyClient) SetRetryPolicy(policy *RetryPolicy) {
+	pc.retryPolicy = policy
+}
+
+// SetCircuitBreaker makes proxy client stop sending requests to upstreams which keep failing.
+//
+// Responds with 503 without contacting upstream while its circuit is open.
+func (pc *ProxyClient) SetCircuitBreaker(circuitBreaker *CircuitBreaker) {
+	pc.circuitBreaker = circuitBreaker
+}
+
+// SetRateLimiter makes proxy client respond with 429 to requests which exceed their rate limit.
+//
+// ProxyRouteRule.SetRateLimit can be used for rules which need a different limit than the default one.
+func (pc *ProxyClient) SetRateLimiter(rateLimiter *RateLimiter) {
+	pc.rateLimiter = rateLimiter
+}
+
+// SetRequestValidator makes proxy client respond with 400 to requests which do not match the OpenAPI document of validator.
+//
+// Response lists all violations. E.g: {"message": "invalid request", "violations": [{"in": "body", "name": "/amount", "message": "property is required"}]}
+//
+// JSON request bodies which have a schema are read into memory for validation up to the limit of validator,
+// also in streaming mode. Other bodies are streamed as usual.
+func (pc *ProxyClient) SetRequestValidator(validator *RequestValidator) {
+	pc.requestValidator = validator
+}
+
+// SetPathNormalizer replaces the normalizer which is applied to request paths before they are checked against route table.
+// Nil normalizer checks raw escaped paths. DefaultPathNormalizer is used unless another one is set.
+//
+// Upstream receives the normalized path, so it can not interpret a request differently than the route table did.
+//
+// Note that rules are not normalized. With TrailingSlashTrim, rule paths should not end with a slash.
+func (pc *ProxyClient) SetPathNormalizer(normalizer *PathNormalizer) {
+	pc.normalizer = normalizer
+}
+
+// SetForwarding replaces settings of forwarding headers and Host header of upstream requests.
+// DefaultForwardingConfig is used unless another one is set.
+//
+// Hop-by-hop headers (Connection, Keep-Alive, Transfer-Encoding etc.) are never passed along in either direction.
+//
+// It returns error if one of the trusted proxies is not a valid IP or CIDR.
+func (pc *ProxyClient) SetForwarding(config ForwardingConfig) error {
+	f, err := newForwarding(config)
+	if err != nil {
+		return err
+	}
+	pc.forwarding = f
+	return nil
+}
+
 // HandleRequestAndRedirect can be registered to http.Handle() for redirecting requests to desired url.
 func (pc *ProxyClient) HandleRequestAndRedirect(w http.ResponseWriter, r *http.Request) {
-	if pc.ignoredPaths[r.URL.RequestURI()] {
+	path := pc.normalizer.Normalize(r.URL.EscapedPath())
+	normalizedUrl := withPath(r.URL, path)
+
+	if pc.isIgnored(r.URL, normalizedUrl) {
 		w.Write(nil)
 		return
 	}
 
+	routeTable := pc.routeTable.Load()
+	foldCase := pc.normalizer.foldCase()
+
+	target, redirect := pc.normalizer.redirectTarget(path)
+	if redirect {
+		rule, _ := routeTable.findRule(r.Method, target, foldCase)
+		if rule != nil {
+			writeRedirect(w, r, target)
+			return
+		}
+	}
+
 	uri := r.URL.RequestURI()
 
-	isAllowed := false
+	trace := &proxyTrace{
+		start:     time.Now(),
+		sessionID: gmsession.NewID(),
+		method:    r.Method,
+		uri:       uri,
+		writer:    &trackingWriter{ResponseWriter: w},
+	}
+	r = r.WithContext(context.WithValue(r.Context(), proxyTraceKey{}, trace))
+	r.URL = normalizedUrl
+	w = trace.writer
+	defer pc.emit(r.Context(), ProxyPhaseCompleted, nil)
+
+	rule, routeParams := routeTable.findRule(r.Method, path, foldCase)
+	if rule == nil {
+		pc.reportErr(r.Context(), fmt.Errorf("path is not allowed: %s", uri))
+		pc.writeMessage(w, r, http.StatusUnauthorized, "unauthorized call")
+		return
+	}
+
+	trace.rule = rule
 
-	for _, e := range pc.routeTable.routeRules {
-		if e.method != r.Method {
-			continue
+	/* Rules are matched against escaped path, so that an escaped slash can not split a segment. */
+	for name, value := range routeParams {
+		unescaped, err := url.PathUnescape(value)
+		if err == nil {
+			routeParams[name] = unescaped
 		}
+	}
+
+	call := &proxyCall{
+		trace:       trace,
+		rule:        rule,
+		routeParams: routeParams,
+		baseUrl:     pc.routeUrl,
+		requestUri:  r.URL.RequestURI(),
+		header:      r.Header,
+	}
+
+	if pc.rateLimiter != nil && !pc.rateLimiter.checkProxy(w, r, rule, call.routeParams) {
+		pc.reportErr(r.Context(), fmt.Errorf("rate limit exceeded: %s", uri))
+		pc.writeMessage(w, r, http.StatusTooManyRequests, "too many requests")
+		return
+	}
 
-		regexConv, err := RouteToRegExp(uri)
+	if pc.requestValidator != nil {
+		violations, err := pc.requestValidator.Validate(r)
 		if err != nil {
-			if pc.onErr != nil {
-				pc.onErr(r.Context(), err)
-			}
-			writtenRes, err := pc.responseWriter.WriteCustomJsonResponse(w, http.StatusInternalServerError, map[string]interface{}{
-				"message": "internal server error",
+			pc.reportErr(r.Context(), err)
+			pc.writeMessage(w, r, http.StatusInternalServerError, "internal error")
+			return
+		}
+		if len(violations) > 0 {
+			pc.reportErr(r.Context(), fmt.Errorf("request validation failed: %s", uri))
+			pc.writeJson(w, r, http.StatusBadRequest, map[string]interface{}{
+				"message":    "invalid request",
+				"violations": violations,
 			})
-			if err != nil {
-				if pc.onErr != nil {
-					pc.onErr(r.Context(), err)
-				}
-				return
-			}
-			if pc.onResRead != nil {
-				pc.onResRead(r.Context(), writtenRes)
-			}
+			return
 		}
+	}
 
-		if e.regexp.MatchString(regexConv) {
-			isAllowed = true
-			break
+	if rule.target != nil {
+		requestUri, err := rule.target.rewriteUri(r.URL, call.routeParams, rule.wildcards)
+		if err != nil {
+			pc.reportErr(r.Context(), fmt.Errorf("unable to rewrite path: %s error: %s", uri, err.Error()))
+			pc.writeMessage(w, r, http.StatusBadRequest, "invalid path")
+			return
 		}
+		call.requestUri = requestUri
+		call.header = rule.target.rewriteHeader(r.Header, call.routeParams)
 	}
+	call.header = pc.forwarding.upstreamHeader(r, call.header)
+	call.host = pc.forwarding.upstreamHost(r)
 
-	if !isAllowed {
-		if pc.onErr != nil {
-			pc.onErr(r.Context(), fmt.Errorf("path is not allowed: %s", uri))
-		}
-		writtenRes, err := pc.responseWriter.WriteCustomJsonResponse(w, http.StatusUnauthorized, map[string]interface{}{
-			"message": "unauthorized call",
-		})
-		if err != nil {
-			if pc.onErr != nil {
-				pc.onErr(r.Context(), fmt.Errorf("write response error: %s", err.Error()))
-			}
+	if pc.responseCache != nil && r.Method == http.MethodGet && rule.cacheTTL >= 0 && !isUpgradeRequest(r.Header) {
+		if pc.serveFromCache(w, r, call) {
 			return
 		}
-		if pc.onResRead != nil {
-			pc.onResRead(r.Context(), writtenRes)
+	}
+
+	if rule.target != nil && rule.target.UpstreamUrl != "" {
+		call.baseUrl = strings.TrimSuffix(rule.target.UpstreamUrl, "/")
+	} else if pc.upstreamPool != nil {
+		upstream := pc.upstreamPool.pick(r, call.routeParams, pc.isUsable)
+		if upstream == nil {
+			pc.reportErr(r.Context(), fmt.Errorf("no healthy upstream available for: %s", uri))
+			pc.writeMessage(w, r, http.StatusServiceUnavailable, "no healthy upstream")
+			return
 		}
+		call.setUpstream(upstream)
+	}
+
+	if call.upstream == nil && pc.healthChecker != nil && !pc.healthChecker.IsHealthy(call.baseUrl) {
+		pc.reportErr(r.Context(), fmt.Errorf("no healthy upstream available for: %s", uri))
+		pc.writeMessage(w, r, http.StatusServiceUnavailable, "no healthy upstream")
 		return
 	}
 
-	redirectUrl := pc.routeUrl + r.URL.RequestURI()
-	parsedRedirectUrl, err := url.Parse(redirectUrl)
+	redirectUrl := call.url()
+	_, err := url.Parse(redirectUrl)
 	if err != nil {
-		if pc.onErr != nil {
-			pc.onErr(r.Context(), fmt.Errorf("unable to parse URL: '%s' error: %s", redirectUrl, err.Error()))
-		}
-		writtenRes, err := pc.responseWriter.WriteCustomJsonResponse(w, http.StatusInternalServerError, map[string]interface{}{
-			"message": "internal error",
-		})
-		if err != nil {
-			if pc.onErr != nil {
-				pc.onErr(r.Context(), fmt.Errorf("write response error: %s", err.Error()))
-			}
-			return
-		}
-		if pc.onResRead != nil {
-			pc.onResRead(r.Context(), writtenRes)
-		}
+		pc.reportErr(r.Context(), fmt.Errorf("unable to parse URL: '%s' error: %s", redirectUrl, err.Error()))
+		pc.writeMessage(w, r, http.StatusInternalServerError, "internal error")
 		return
 	}
 
+	if isUpgradeRequest(r.Header) {
+		pc.redirectUpgrade(w, r, call)
+		return
+	}
+
+	if pc.requestCoalescer != nil && pc.requestCoalescer.accepts(r) {
+		pc.redirectCoalesced(w, r, call)
+		return
+	}
+
+	pc.redirect(w, r, call)
+}
+
+// redirect sends request of the call to upstream and passes the response to client according to cache and streaming mode.
+func (pc *ProxyClient) redirect(w http.ResponseWriter, r *http.Request, call *proxyCall) {
+	if call.useCache {
+		pc.redirectCached(w, r, call)
+		return
+	}
+
+	if pc.streaming {
+		pc.redirectStreaming(w, r, call)
+		return
+	}
+
+	pc.redirectBuffered(w, r, call)
+}
+
+// isIgnored returns true if request url is one of the ignored paths, either as received or after normalization.
+func (pc *ProxyClient) isIgnored(u, normalizedUrl *url.URL) bool {
+	return pc.ignoredPaths[u.RequestURI()] || pc.ignoredPaths[normalizedUrl.RequestURI()]
+}
+
+// withPath returns a copy of input url with input escaped path. Input url is returned if path is not changed.
+func withPath(u *url.URL, escapedPath string) *url.URL {
+	if escapedPath == u.EscapedPath() {
+		return u
+	}
+
+	path, err := url.PathUnescape(escapedPath)
+	if err != nil {
+		return u
+	}
+
+	result := *u
+	result.Path = path
+	result.RawPath = escapedPath
+	return &result
+}
+
+// proxyCall contains upstream request details resolved for a single incoming request.
+type proxyCall struct {
+	trace       *proxyTrace
+	rule        *ProxyRouteRule
+	routeParams map[string]string
+	// upstream is nil unless it is picked from upstream pool.
+	upstream   *Upstream
+	baseUrl    string
+	requestUri string
+	header     http.Header
+	// host overrides Host header of upstream request unless it is empty.
+	host string
+	// useCache is set if response is looked up in cache and should be stored if it is cacheable.
+	useCache bool
+	cacheKey string
+	// cached is the stale response which will be revalidated. It is nil if nothing is stored or it has no validators.
+	cached *CachedResponse
+}
+
+func (c *proxyCall) setUpstream(upstream *Upstream) {
+	c.upstream = upstream
+	c.baseUrl = upstream.url
+}
+
+func (c *proxyCall) url() string {
+	return c.baseUrl + c.requestUri
+}
+
+// redirectBuffered reads whole request and response bodies into memory before passing them along.
+func (pc *ProxyClient) redirectBuffered(w http.ResponseWriter, r *http.Request, call *proxyCall) {
 	reqBytes, err := io.ReadAll(r.Body)
 	if err != nil {
-		if pc.onErr != nil {
-			pc.onErr(r.Context(), fmt.Errorf("error reading request body: %s", err.Error()))
-		}
-		writtenRes, err := pc.responseWriter.WriteCustomJsonResponse(w, http.StatusInternalServerError, map[string]interface{}{
-			"message": "internal error",
-		})
-		if err != nil {
-			if pc.onErr != nil {
-				pc.onErr(r.Context(), fmt.Errorf("write response error: %s", err.Error()))
-			}
-			return
-		}
-		if pc.onResRead != nil {
-			pc.onResRead(r.Context(), writtenRes)
-		}
+		pc.reportErr(r.Context(), fmt.Errorf("error reading request body: %s", err.Error()))
+		pc.writeMessage(w, r, http.StatusInternalServerError, "internal error")
 		return
 	}
 
+	call.trace.requestBytes = int64(len(reqBytes))
+	pc.emit(r.Context(), ProxyPhaseRequestRead, nil)
 	if pc.onReqRead != nil {
 		pc.onReqRead(r.Context(), reqBytes)
 	}
 
-	buffer := bytes.NewBuffer(reqBytes)
-	nopCloser := io.NopCloser(buffer)
-
-	httpReq := &http.Request{
-		Method: r.Method,
-		URL:    parsedRedirectUrl,
-		Header: r.Header,
-		Body:   nopCloser,
+	newBody := func() io.ReadCloser {
+		if len(reqBytes) == 0 {
+			return http.NoBody
+		}
+		return io.NopCloser(bytes.NewReader(reqBytes))
 	}
 
-	httpRes, err := pc.httpCli.Do(httpReq)
+	httpRes, err := pc.do(r, call, newBody, true, int64(len(reqBytes)))
 	if err != nil {
-		if pc.onErr != nil {
-			pc.onErr(r.Context(), fmt.Errorf("error executing http request: %s", err.Error()))
-		}
-		writtenRes, err := pc.responseWriter.WriteCustomJsonResponse(w, http.StatusInternalServerError, map[string]interface{}{
-			"message": "internal error",
-		})
-		if err != nil {
-			if pc.onErr != nil {
-				pc.onErr(r.Context(), fmt.Errorf("write response error: %s", err.Error()))
-			}
-			return
-		}
-		if pc.onResRead != nil {
-			pc.onResRead(r.Context(), writtenRes)
-		}
+		pc.writeUpstreamErr(w, r, err)
+		return
+	}
+	defer httpRes.Body.Close()
+
+	pc.respondBuffered(w, r, httpRes)
+}
+
+// respondBuffered reads whole upstream response into memory before passing it to client.
+func (pc *ProxyClient) respondBuffered(w http.ResponseWriter, r *http.Request, httpRes *http.Response) {
+	/* Streaming responses may be long-lived, therefore they are passed along as they arrive instead of being read as a whole. */
+	if isStreamingResponse(httpRes) {
+		pc.flushResponse(w, r, httpRes, math.MaxInt)
 		return
 	}
 
 	resBytes, err := io.ReadAll(httpRes.Body)
 	if err != nil {
-		if pc.onErr != nil {
-			pc.onErr(r.Context(), fmt.Errorf("error reading response payload: %s", err.Error()))
-		}
-		writtenRes, err := pc.responseWriter.WriteCustomJsonResponse(w, http.StatusInternalServerError, map[string]interface{}{
-			"message": "internal error",
-		})
-		if err != nil {
-			if pc.onErr != nil {
-				pc.onErr(r.Context(), fmt.Errorf("write response error: %s", err.Error()))
-			}
-			return
-		}
-		if pc.onResRead != nil {
-			pc.onResRead(r.Context(), writtenRes)
-		}
+		pc.reportErr(r.Context(), fmt.Errorf("error reading response payload: %s", err.Error()))
+		pc.writeMessage(w, r, http.StatusInternalServerError, "internal error")
 		return
 	}
-	defer httpRes.Body.Close()
 
-	for k, v := range httpRes.Header {
-		for i := 0; i < len(v); i++ {
-			w.Header().Add(k, v[i])
-		}
-	}
+	pc.writeResponse(w, r, httpRes.StatusCode, httpRes.Header, resBytes)
+}
 
-	if httpRes.StatusCode != http.StatusOK {
-		w.WriteHeader(httpRes.StatusCode)
+// writeResponse writes a response whose body is read as a whole and passes the body to onResRead hook.
+func (pc *ProxyClient) writeResponse(w http.ResponseWriter, r *http.Request, statusCode int, header http.Header, resBytes []byte) {
+	copyResponseHeader(w.Header(), header)
+
+	if statusCode != http.StatusOK {
+		w.WriteHeader(statusCode)
 	}
 
-	_, err = w.Write(resBytes)
+	_, err := w.Write(resBytes)
 	if err != nil {
-		if pc.onErr != nil {
-			pc.onErr(r.Context(), fmt.Errorf("error writing server response for client: %s", err.Error()))
-		}
-		writtenRes, err := pc.responseWriter.WriteCustomJsonResponse(w, http.StatusInternalServerError, map[string]interface{}{
-			"message": "internal error",
-		})
-		if err != nil {
-			if pc.onErr != nil {
-				pc.onErr(r.Context(), fmt.Errorf("write response error: %s", err.Error()))
-			}
-			return
-		}
-		if pc.onResRead != nil {
-			pc.onResRead(r.Context(), writtenRes)
-		}
+		pc.reportErr(r.Context(), fmt.Errorf("error writing server response for client: %s", err.Error()))
 		return
 	}
 
-	if httpRes.Header.Get("Content-Encoding") == "gzip" {
+	if header.Get("Content-Encoding") == "gzip" {
 		reader := bytes.NewReader(resBytes)
 		gzipReader, err := gzip.NewReader(reader)
 		if err != nil {
-			if pc.onErr != nil {
-				pc.onErr(r.Context(), fmt.Errorf("error creating gzip reader: %s", err.Error()))
-			}
-			writtenRes, err := pc.responseWriter.WriteCustomJsonResponse(w, http.StatusInternalServerError, map[string]interface{}{
-				"message": "internal error",
-			})
-			if err != nil {
-				if pc.onErr != nil {
-					pc.onErr(r.Context(), fmt.Errorf("write response error: %s", err.Error()))
-				}
-				return
-			}
-			if pc.onResRead != nil {
-				pc.onResRead(r.Context(), writtenRes)
-			}
+			pc.reportErr(r.Context(), fmt.Errorf("error creating gzip reader: %s", err.Error()))
 			return
 		}
 		/* Modifying resBytes for logging decompressed content AFTER we've written the response body. */
 		resBytes, err = io.ReadAll(gzipReader)
 		if err != nil {
-			if pc.onErr != nil {
-				pc.onErr(r.Context(), fmt.Errorf("error reading from gzip reader: %s", err.Error()))
-			}
-			writtenRes, err := pc.responseWriter.WriteCustomJsonResponse(w, http.StatusInternalServerError, map[string]interface{}{
-				"message": "internal error",
-			})
-			if err != nil {
-				if pc.onErr != nil {
-					pc.onErr(r.Context(), fmt.Errorf("write response error: %s", err.Error()))
-				}
-				return
-			}
-			if pc.onResRead != nil {
-				pc.onResRead(r.Context(), writtenRes)
-			}
+			pc.reportErr(r.Context(), fmt.Errorf("error reading from gzip reader: %s", err.Error()))
 			return
 		}
 	}
@@ -294,3 +486,172 @@ func (pc *ProxyClient) HandleRequestAndRedirect(w http.ResponseWriter, r *http.R
 		pc.onResRead(r.Context(), resBytes)
 	}
 }
+
+// do sends upstream request of the call, retrying it according to retry policy.
+//
+// newBody is called once per attempt and must return a fresh request body unless replayable is false,
+// in which case request is never retried.
+func (pc *ProxyClient) do(r *http.Request, call *proxyCall, newBody func() io.ReadCloser, replayable bool, contentLength int64) (*http.Response, error) {
+	attempts := 1
+	if replayable {
+		attempts = pc.retryPolicy.attemptsFor(r.Method)
+	}
+
+	trace := call.trace
+	start := time.Now()
+
+	for attempt := 1; ; attempt++ {
+		trace.attempts = attempt
+		trace.upstreamUrl = call.baseUrl
+
+		httpRes, err := pc.send(r, call, newBody(), contentLength)
+		if attempt >= attempts || !pc.retryPolicy.shouldRetry(httpRes, err) {
+			trace.upstreamLatency = time.Since(start)
+			if err == nil {
+				trace.upstreamStatus = httpRes.StatusCode
+				pc.emit(r.Context(), ProxyPhaseUpstreamResponse, nil)
+			}
+			return httpRes, err
+		}
+
+		if call.upstream != nil {
+			next := pc.upstreamPool.pick(r, call.routeParams, pc.isUsable)
+			if next == nil {
+				return httpRes, err
+			}
+			call.setUpstream(next)
+		} else if errors.Is(err, ErrCircuitOpen) {
+			return httpRes, err
+		}
+
+		if httpRes != nil {
+			io.Copy(io.Discard, httpRes.Body)
+			httpRes.Body.Close()
+		}
+
+		err = sleep(r.Context(), pc.retryPolicy.backoff(attempt))
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// send executes a single upstream request attempt.
+// Its outcome is recorded for passive health tracking and circuit breaker.
+func (pc *ProxyClient) send(r *http.Request, call *proxyCall, body io.ReadCloser, contentLength int64) (*http.Response, error) {
+	if pc.circuitBreaker != nil && !pc.circuitBreaker.allow(call.baseUrl) {
+		body.Close()
+		return nil, ErrCircuitOpen
+	}
+
+	httpReq, err := http.NewRequestWithContext(r.Context(), r.Method, call.url(), body)
+	if err != nil {
+		body.Close()
+		if pc.circuitBreaker != nil {
+			pc.circuitBreaker.release(call.baseUrl)
+		}
+		return nil, fmt.Errorf("could not create new request: %s", err.Error())
+	}
+	httpReq.Header = call.header
+	httpReq.ContentLength = contentLength
+	if call.host != "" {
+		httpReq.Host = call.host
+	}
+
+	upstream := call.upstream
+	if upstream != nil {
+		upstream.begin()
+	}
+
+	httpRes, err := pc.httpCli.Do(httpReq)
+
+	/* Requests cancelled by client say nothing about upstream health. */
+	if errors.Is(err, context.Canceled) {
+		if pc.circuitBreaker != nil {
+			pc.circuitBreaker.release(call.baseUrl)
+		}
+	} else {
+		success := err == nil && httpRes.StatusCode < http.StatusInternalServerError
+		if upstream != nil {
+			pc.upstreamPool.report(upstream, success)
+		}
+		if pc.circuitBreaker != nil {
+			pc.circuitBreaker.record(call.baseUrl, success)
+		}
+	}
+
+	if err != nil {
+		if upstream != nil {
+			upstream.end()
+		}
+		return nil, err
+	}
+
+	if upstream != nil {
+		httpRes.Body = &inFlightBody{
+			ReadCloser: httpRes.Body,
+			once:       &sync.Once{},
+			upstream:   upstream,
+		}
+	}
+	return httpRes, nil
+}
+
+// isUsable returns false if upstream is down according to health checker or its circuit is open.
+func (pc *ProxyClient) isUsable(upstreamUrl string) bool {
+	if pc.healthChecker != nil && !pc.healthChecker.IsHealthy(upstreamUrl) {
+		return false
+	}
+	if pc.circuitBreaker != nil && pc.circuitBreaker.State(upstreamUrl) == CircuitOpen {
+		return false
+	}
+	return true
+}
+
+// inFlightBody keeps upstream request counted as in-flight until its response body is closed.
+type inFlightBody struct {
+	io.ReadCloser
+	once     *sync.Once
+	upstream *Upstream
+}
+
+func (b *inFlightBody) Close() error {
+	b.once.Do(b.upstream.end)
+	return b.ReadCloser.Close()
+}
+
+// reportErr passes err to onErr hook if it is registered and emits it as an error event.
+func (pc *ProxyClient) reportErr(ctx context.Context, err error) {
+	if pc.onErr != nil {
+		pc.onErr(ctx, err)
+	}
+	pc.emit(ctx, ProxyPhaseError, err)
+}
+
+// writeUpstreamErr reports an upstream request error and writes a matching response.
+func (pc *ProxyClient) writeUpstreamErr(w http.ResponseWriter, r *http.Request, err error) {
+	pc.reportErr(r.Context(), fmt.Errorf("error executing http request: %s", err.Error()))
+	if errors.Is(err, ErrCircuitOpen) {
+		pc.writeMessage(w, r, http.StatusServiceUnavailable, "circuit open")
+		return
+	}
+	pc.writeMessage(w, r, http.StatusInternalServerError, "internal error")
+}
+
+// writeMessage writes a JSON response in {"message": message} format and passes written payload to onResRead hook.
+func (pc *ProxyClient) writeMessage(w http.ResponseWriter, r *http.Request, statusCode int, message string) {
+	pc.writeJson(w, r, statusCode, map[string]interface{}{
+		"message": message,
+	})
+}
+
+func (pc *ProxyClient) writeJson(w http.ResponseWriter, r *http.Request, statusCode int, res interface{}) {
+	writtenRes, err := pc.responseWriter.WriteCustomJsonResponse(w, statusCode, res)
+	if err != nil {
+		pc.reportErr(r.Context(), fmt.Errorf("write response error: %s", err.Error()))
+		return
+	}
+	if pc.onResRead != nil {
+		pc.onResRead(r.Context(), writtenRes)
+	}
+}
@@ -0,0 +1,207 @@
+package gmrouting
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	gmhttp "github.com/onuryurdupak/gomod/v2/http"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Proxy_Streaming(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Upstream", "yes")
+		w.WriteHeader(http.StatusCreated)
+		io.Copy(w, r.Body)
+	}))
+	defer upstream.Close()
+
+	table, err := NewProxyRouteTable([]*ProxyRouteRule{
+		NewProxyRouteRule(http.MethodPost, `/api/upload`),
+	})
+	assert.NoError(t, err)
+
+	var reqRead, resRead []byte
+	pc := NewProxyClient(table, upstream.URL, upstream.Client(), gmhttp.NewResponseWriter(), nil,
+		func(ctx context.Context, err error) { t.Errorf("unexpected error: %s", err.Error()) },
+		func(ctx context.Context, b []byte) { reqRead = b },
+		func(ctx context.Context, b []byte) { resRead = b },
+	)
+	pc.SetStreaming(true, 16)
+
+	payload := bytes.Repeat([]byte("0123456789"), 100000)
+	req := httptest.NewRequest(http.MethodPost, `/api/upload`, bytes.NewReader(payload))
+	rec := httptest.NewRecorder()
+
+	pc.HandleRequestAndRedirect(rec, req)
+
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, "yes", rec.Header().Get("X-Upstream"))
+	assert.Equal(t, payload, rec.Body.Bytes())
+	assert.Equal(t, payload[:16], reqRead)
+	assert.Equal(t, payload[:16], resRead)
+}
+
+func Test_Proxy_Not_Allowed(t *testing.T) {
+	table, err := NewProxyRouteTable([]*ProxyRouteRule{
+		NewProxyRouteRule(http.MethodGet, `/api/accounts`),
+	})
+	assert.NoError(t, err)
+
+	var errs []error
+	pc := NewProxyClient(table, "http://127.0.0.1:0", http.DefaultClient, gmhttp.NewResponseWriter(), nil,
+		func(ctx context.Context, err error) { errs = append(errs, err) }, nil, nil)
+
+	rec := httptest.NewRecorder()
+	pc.HandleRequestAndRedirect(rec, httptest.NewRequest(http.MethodDelete, `/api/accounts`, nil))
+
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.JSONEq(t, `{"message":"unauthorized call"}`, rec.Body.String())
+	assert.Len(t, errs, 1)
+}
+
+func Test_Proxy_Upstream_Pool(t *testing.T) {
+	hits := make([]int, 3)
+	upstreams := make([]*Upstream, 3)
+	for i := range upstreams {
+		index := i
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hits[index]++
+			if index == 2 {
+				w.WriteHeader(http.StatusBadGateway)
+			}
+		}))
+		defer server.Close()
+		upstreams[i] = NewUpstream(server.URL, 1)
+	}
+
+	pool, err := NewUpstreamPool(upstreams, NewRoundRobinBalancer(), 2, time.Minute)
+	assert.NoError(t, err)
+
+	table, err := NewProxyRouteTable([]*ProxyRouteRule{
+		NewProxyRouteRule(http.MethodGet, `/api/accounts`),
+	})
+	assert.NoError(t, err)
+
+	pc := NewProxyClient(table, "", http.DefaultClient, gmhttp.NewResponseWriter(), nil, nil, nil, nil)
+	pc.SetUpstreamPool(pool)
+
+	for i := 0; i < 12; i++ {
+		pc.HandleRequestAndRedirect(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, `/api/accounts`, nil))
+	}
+
+	// Third upstream fails twice and gets ejected, the rest of the requests are shared by healthy ones.
+	assert.Equal(t, 2, hits[2])
+	assert.Equal(t, 10, hits[0]+hits[1])
+	assert.True(t, pool.IsEjected(upstreams[2]))
+}
+
+func Test_Proxy_Rule_Target(t *testing.T) {
+	var gotUri, gotTenant, gotSecret string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotUri = r.URL.RequestURI()
+		gotTenant = r.Header.Get("X-Tenant")
+		gotSecret = r.Header.Get("X-Secret")
+	}))
+	defer upstream.Close()
+
+	table, err := NewProxyRouteTable([]*ProxyRouteRule{
+		NewProxyRouteRuleWithTarget(http.MethodGet, `/api/{tenant}/transfers/{id}`, &ProxyTarget{
+			UpstreamUrl: upstream.URL,
+			PathRewrite: `/v2/transfer/{id}`,
+			HeaderRewrites: []HeaderRewrite{
+				{Action: HeaderSet, Name: "X-Tenant", Value: "{tenant}"},
+				{Action: HeaderRemove, Name: "X-Secret"},
+			},
+		}),
+		NewProxyRouteRuleWithTarget(http.MethodGet, `/api/files/{path...}`, &ProxyTarget{
+			UpstreamUrl: upstream.URL,
+			PathRewrite: `/v2/{path}`,
+		}),
+	})
+	assert.NoError(t, err)
+
+	pc := NewProxyClient(table, "http://127.0.0.1:0", http.DefaultClient, gmhttp.NewResponseWriter(), nil, nil, nil, nil)
+
+	req := httptest.NewRequest(http.MethodGet, `/api/acme/transfers/42?verbose=1`, nil)
+	req.Header.Set("X-Secret", "token")
+	rec := httptest.NewRecorder()
+	pc.HandleRequestAndRedirect(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, `/v2/transfer/42?verbose=1`, gotUri)
+	assert.Equal(t, "acme", gotTenant)
+	assert.Equal(t, "", gotSecret)
+	assert.Equal(t, "token", req.Header.Get("X-Secret"))
+
+	/* Slashes of wildcard parameters are kept as path separators. */
+	rec = httptest.NewRecorder()
+	pc.HandleRequestAndRedirect(rec, httptest.NewRequest(http.MethodGet, `/api/files/reports/2024/q1%20summary.txt`, nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, `/v2/reports/2024/q1%20summary.txt`, gotUri)
+
+	/* Escaped slashes of wildcard parameters can not introduce dot segments which escape the rewritten path. */
+	gotUri = ""
+	for _, target := range []string{`/api/files/a%2F..%2F..%2Fadmin%2Fsecret`, `/api/files/%2E%2E%2Fadmin`, `/api/files/a/.%2Fb`} {
+		rec = httptest.NewRecorder()
+		pc.HandleRequestAndRedirect(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		assert.Equal(t, http.StatusBadRequest, rec.Code, target)
+		assert.Equal(t, "", gotUri, target)
+	}
+}
+
+func Test_Proxy_Rule_Target_Validation(t *testing.T) {
+	_, err := NewProxyRouteTable([]*ProxyRouteRule{
+		NewProxyRouteRuleWithTarget(http.MethodGet, `/api/transfers/{id}`, &ProxyTarget{
+			PathRewrite: `/v2/transfer/{guid}`,
+		}),
+	})
+	assert.Error(t, err)
+}
+
+func Test_Proxy_Events(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte("accepted"))
+	}))
+	defer upstream.Close()
+
+	rule := NewProxyRouteRule(http.MethodPost, `/api/transfers/{id}`)
+	table, err := NewProxyRouteTable([]*ProxyRouteRule{rule})
+	assert.NoError(t, err)
+
+	var hookSessionID string
+	var events []ProxyEvent
+	pc := NewProxyClient(table, upstream.URL, upstream.Client(), gmhttp.NewResponseWriter(), nil, nil,
+		func(ctx context.Context, b []byte) { hookSessionID = SessionIDFromContext(ctx) }, nil)
+	pc.SetObserver(ProxyObserverFunc(func(ctx context.Context, event ProxyEvent) {
+		events = append(events, event)
+	}))
+
+	rec := httptest.NewRecorder()
+	pc.HandleRequestAndRedirect(rec, httptest.NewRequest(http.MethodPost, `/api/transfers/5`, bytes.NewReader([]byte("payload"))))
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+
+	assert.Len(t, events, 3)
+	assert.Equal(t, ProxyPhaseRequestRead, events[0].Phase)
+	assert.Equal(t, int64(7), events[0].RequestBytes)
+	assert.Equal(t, ProxyPhaseUpstreamResponse, events[1].Phase)
+	assert.Equal(t, http.StatusAccepted, events[1].StatusCode)
+	assert.Equal(t, upstream.URL, events[1].UpstreamUrl)
+	assert.Equal(t, 1, events[1].Attempts)
+
+	completed := events[2]
+	assert.Equal(t, ProxyPhaseCompleted, completed.Phase)
+	assert.Equal(t, rule, completed.Rule)
+	assert.Equal(t, `/api/transfers/5`, completed.URI)
+	assert.Equal(t, http.StatusAccepted, completed.StatusCode)
+	assert.Equal(t, int64(8), completed.ResponseBytes)
+	assert.NoError(t, completed.Err)
+	assert.NotEmpty(t, completed.SessionID)
+	assert.Equal(t, completed.SessionID, hookSessionID)
+}
@@ -0,0 +1,139 @@
+package gmrouting
+
+import (
+	"context"
+	"net/http"
+	"sort"
+
+	gmsync "github.com/onuryurdupak/gomod/v2/sync"
+)
+
+// coalescingKeyHeaders can change upstream response of a request by themselves, therefore they are always a part of the key.
+var coalescingKeyHeaders = []string{
+	"Authorization",
+	"Cookie",
+	"Accept-Encoding",
+	"Range",
+	"If-Range",
+	"If-Match",
+	"If-None-Match",
+	"If-Modified-Since",
+	"If-Unmodified-Since",
+	"Cache-Control",
+	"Pragma",
+}
+
+// RequestCoalescer makes identical GET and HEAD requests which are in flight at the same time share a single upstream request.
+// The first request is sent to upstream, the others wait for its response instead of being forwarded.
+//
+// Requests are identical if they have the same method, host, URI and values of key headers. Key headers are Authorization,
+// Cookie, Accept-Encoding, Range, conditional headers and cache directives, along with the headers passed to NewRequestCoalescer.
+//
+// Shared responses are read into memory. Event streams and responses larger than the limit are passed along to the first
+// request only, waiting requests are forwarded separately in that case.
+//
+// A waiting request stops waiting once its client goes away. The shared upstream request is cancelled once every request
+// which shares it is gone.
+type RequestCoalescer struct {
+	group        *gmsync.FlightGroup[string, *fetchedResponse]
+	maxBodyBytes int64
+	// headers are sorted canonical names of key headers.
+	headers []string
+}
+
+// NewRequestCoalescer creates a coalescer to be registered via ProxyClient.SetRequestCoalescer.
+//
+// maxBodyBytes: Responses with larger bodies are not shared. Defaults to 1 MiB if not positive.
+//
+// headers: Additional headers which select the upstream response. E.g: Accept, Accept-Language
+func NewRequestCoalescer(maxBodyBytes int64, headers []string) *RequestCoalescer {
+	if maxBodyBytes <= 0 {
+		maxBodyBytes = 1 << 20
+	}
+
+	names := make(map[string]bool)
+	for _, h := range coalescingKeyHeaders {
+		names[h] = true
+	}
+	for _, h := range headers {
+		names[http.CanonicalHeaderKey(h)] = true
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	return &RequestCoalescer{
+		group:        gmsync.NewFlightGroup[string, *fetchedResponse](),
+		maxBodyBytes: maxBodyBytes,
+		headers:      sorted,
+	}
+}
+
+// SetRequestCoalescer makes proxy client share a single upstream request among identical in-flight requests.
+//
+// Requests which are served with a shared response are reported via Coalesced field of ProxyEvent.
+// They are still delivered to onReqRead and onResRead hooks. When a response cache is also set, coalescing
+// applies to requests which are not served from cache.
+func (pc *ProxyClient) SetRequestCoalescer(coalescer *RequestCoalescer) {
+	pc.requestCoalescer = coalescer
+}
+
+// accepts returns true if r can share upstream response of an identical request.
+func (c *RequestCoalescer) accepts(r *http.Request) bool {
+	safe := r.Method == http.MethodGet || r.Method == http.MethodHead
+	return safe && r.ContentLength == 0 && !isUpgradeRequest(r.Header)
+}
+
+// key returns the key which identical requests of r share. Fields are separated by new lines like keys of ResponseCache.
+func (c *RequestCoalescer) key(r *http.Request) string {
+	return variantKey(r.Method+"\n"+r.Host+"\n"+r.URL.RequestURI(), c.headers, r.Header)
+}
+
+// redirectCoalesced sends request of the call to upstream unless an identical request is in flight,
+// in which case it waits for the response of that request and passes it to client.
+func (pc *ProxyClient) redirectCoalesced(w http.ResponseWriter, r *http.Request, call *proxyCall) {
+	coalescer := pc.requestCoalescer
+
+	cancel := context.CancelFunc(func() {})
+	/* Waiting requests share the outcome, so that upstream request is cancelled only once every request gave up. */
+	fetched, shared, err := coalescer.group.DoContext(r.Context(), coalescer.key(r), func(ctx context.Context) (*fetchedResponse, error) {
+		pc.readEmptyRequest(r)
+		ctx, cancelFetch := context.WithCancel(ctx)
+		cancel = cancelFetch
+		return pc.fetch(r.WithContext(ctx), call, coalescer.maxBodyBytes)
+	})
+
+	if !shared {
+		defer cancel()
+		if err != nil {
+			pc.writeUpstreamErr(w, r, err)
+			return
+		}
+		if fetched.httpRes != nil {
+			/* Response is not shared, it is passed along as it arrives. Upstream request ends along with this request again. */
+			stop := context.AfterFunc(r.Context(), cancel)
+			defer stop()
+		}
+		pc.writeFetched(w, r, fetched)
+		return
+	}
+
+	if err == nil && fetched.httpRes != nil {
+		pc.redirect(w, r, call)
+		return
+	}
+
+	call.trace.coalesced = true
+	pc.readEmptyRequest(r)
+	if err != nil {
+		pc.writeUpstreamErr(w, r, err)
+		return
+	}
+	if call.useCache {
+		call.trace.cacheStatus = fetched.cacheStatus
+		pc.emit(r.Context(), ProxyPhaseCache, nil)
+	}
+	pc.writeResponse(w, r, fetched.statusCode, fetched.header, fetched.body)
+}
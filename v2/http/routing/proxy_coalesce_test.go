@@ -0,0 +1,183 @@
+package gmrouting
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	gmhttp "github.com/onuryurdupak/gomod/v2/http"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Proxy_Request_Coalescing(t *testing.T) {
+	mutex := &sync.Mutex{}
+	hits := make(map[string]int)
+	/* Each upstream request waits for a token, so that identical requests overlap. Tests send one token per upstream request. */
+	gate := make(chan struct{}, 20)
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		hits[r.URL.Path]++
+		mutex.Unlock()
+		<-gate
+
+		switch r.URL.Path {
+		case "/api/rates":
+			w.Write([]byte("rates-" + r.Header.Get("Accept-Language")))
+		case "/api/report":
+			w.Write([]byte(strings.Repeat("x", 2048)))
+		}
+	}))
+	defer upstream.Close()
+
+	table, err := NewProxyRouteTable([]*ProxyRouteRule{
+		NewProxyRouteRule(`GET`, `/api/rates`),
+		NewProxyRouteRule(`GET`, `/api/report`),
+	})
+	assert.NoError(t, err)
+
+	var coalesced atomic.Int32
+	var resRead atomic.Int32
+	pc := NewProxyClient(table, upstream.URL, upstream.Client(), gmhttp.NewResponseWriter(), nil, nil, nil,
+		func(ctx context.Context, b []byte) { resRead.Add(1) })
+	pc.SetObserver(ProxyObserverFunc(func(ctx context.Context, event ProxyEvent) {
+		if event.Phase == ProxyPhaseCompleted && event.Coalesced {
+			coalesced.Add(1)
+		}
+	}))
+	coalescer := NewRequestCoalescer(1024, []string{"accept-language"})
+	pc.SetRequestCoalescer(coalescer)
+
+	/* waiting returns the number of requests which wait for an identical in-flight request. */
+	waiting := func(requests []*http.Request) int {
+		keys := make(map[string]bool)
+		total := 0
+		for _, req := range requests {
+			key := coalescer.key(req)
+			if !keys[key] {
+				keys[key] = true
+				total += coalescer.group.Waiters(key)
+			}
+		}
+		return total
+	}
+
+	sendAll := func(requests []*http.Request, tokens, waiters int) []*httptest.ResponseRecorder {
+		coalesced.Store(0)
+		resRead.Store(0)
+		recs := make([]*httptest.ResponseRecorder, len(requests))
+		wg := &sync.WaitGroup{}
+		for i, req := range requests {
+			wg.Add(1)
+			go func(i int, req *http.Request) {
+				defer wg.Done()
+				rec := httptest.NewRecorder()
+				pc.HandleRequestAndRedirect(rec, req)
+				recs[i] = rec
+			}(i, req)
+		}
+		/* Upstream responds only after the expected requests wait for an identical in-flight request. */
+		assert.Eventually(t, func() bool { return waiting(requests) == waiters }, time.Second, time.Millisecond)
+		for i := 0; i < tokens; i++ {
+			gate <- struct{}{}
+		}
+		wg.Wait()
+		return recs
+	}
+
+	requests := make([]*http.Request, 0)
+	for i := 0; i < 5; i++ {
+		requests = append(requests, httptest.NewRequest(`GET`, `/api/rates`, nil))
+	}
+	for _, rec := range sendAll(requests, 1, 4) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "rates-", rec.Body.String())
+	}
+	assert.Equal(t, 1, hits["/api/rates"])
+	assert.Equal(t, int32(4), coalesced.Load())
+	assert.Equal(t, int32(5), resRead.Load())
+
+	/* Requests which differ in key headers are not coalesced. */
+	requests = make([]*http.Request, 0)
+	for _, language := range []string{"en", "tr", "en"} {
+		req := httptest.NewRequest(`GET`, `/api/rates`, nil)
+		req.Header.Set("Accept-Language", language)
+		requests = append(requests, req)
+	}
+	req := httptest.NewRequest(`GET`, `/api/rates`, nil)
+	req.Header.Set("Authorization", "Bearer abc")
+	requests = append(requests, req)
+
+	recs := sendAll(requests, 3, 1)
+	assert.Equal(t, "rates-en", recs[0].Body.String())
+	assert.Equal(t, "rates-tr", recs[1].Body.String())
+	assert.Equal(t, "rates-en", recs[2].Body.String())
+	assert.Equal(t, 4, hits["/api/rates"])
+	assert.Equal(t, int32(1), coalesced.Load())
+
+	/* Responses larger than the limit are not shared, waiting requests are forwarded separately. */
+	requests = make([]*http.Request, 0)
+	for i := 0; i < 3; i++ {
+		requests = append(requests, httptest.NewRequest(`GET`, `/api/report`, nil))
+	}
+	for _, rec := range sendAll(requests, 3, 2) {
+		assert.Equal(t, 2048, rec.Body.Len())
+	}
+	assert.Equal(t, 3, hits["/api/report"])
+	assert.Equal(t, int32(0), coalesced.Load())
+}
+
+func Test_Proxy_Request_Coalescing_Cancellation(t *testing.T) {
+	arrived := make(chan struct{}, 1)
+	upstreamCancelled := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		arrived <- struct{}{}
+		<-r.Context().Done()
+		close(upstreamCancelled)
+	}))
+	defer upstream.Close()
+
+	table, err := NewProxyRouteTable([]*ProxyRouteRule{NewProxyRouteRule(`GET`, `/api/rates`)})
+	assert.NoError(t, err)
+
+	pc := NewProxyClient(table, upstream.URL, upstream.Client(), gmhttp.NewResponseWriter(), nil, nil, nil, nil)
+	coalescer := NewRequestCoalescer(1024, nil)
+	pc.SetRequestCoalescer(coalescer)
+
+	send := func(ctx context.Context) chan struct{} {
+		done := make(chan struct{})
+		go func() {
+			pc.HandleRequestAndRedirect(httptest.NewRecorder(), httptest.NewRequest(`GET`, `/api/rates`, nil).WithContext(ctx))
+			close(done)
+		}()
+		return done
+	}
+
+	leaderCtx, cancelLeader := context.WithCancel(context.Background())
+	leaderDone := send(leaderCtx)
+	<-arrived
+
+	waiterCtx, cancelWaiter := context.WithCancel(context.Background())
+	waiterDone := send(waiterCtx)
+	key := coalescer.key(httptest.NewRequest(`GET`, `/api/rates`, nil))
+	assert.Eventually(t, func() bool { return coalescer.group.Waiters(key) == 1 }, time.Second, time.Millisecond)
+
+	/* Waiting request returns while upstream still hangs. */
+	cancelWaiter()
+	<-waiterDone
+	select {
+	case <-upstreamCancelled:
+		assert.Fail(t, "upstream request is cancelled while a request shares it")
+	default:
+	}
+
+	/* Upstream request is cancelled once no request is left. */
+	cancelLeader()
+	<-upstreamCancelled
+	<-leaderDone
+}
@@ -0,0 +1,193 @@
+package gmrouting
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+type ProxyPhase string
+
+const (
+	// ProxyPhaseRequestRead is emitted once request body is read (or streamed) to upstream.
+	ProxyPhaseRequestRead ProxyPhase = "request_read"
+	// ProxyPhaseUpstreamResponse is emitted once upstream response header is received.
+	ProxyPhaseUpstreamResponse ProxyPhase = "upstream_response"
+	// ProxyPhaseUpgraded is emitted once client connection is switched to the upstream protocol and tunneling starts.
+	// Bytes tunneled in each direction are reported by completed phase as RequestBytes and ResponseBytes.
+	ProxyPhaseUpgraded ProxyPhase = "upgraded"
+	// ProxyPhaseCache is emitted for GET requests once cache status is known, if proxy client has a response cache.
+	ProxyPhaseCache ProxyPhase = "cache"
+	// ProxyPhaseError is emitted for every error which is also passed to onErr hook.
+	ProxyPhaseError ProxyPhase = "error"
+	// ProxyPhaseCompleted is emitted exactly once per request after response is written to client.
+	ProxyPhaseCompleted ProxyPhase = "completed"
+	// ProxyPhaseReload is emitted when route table is replaced or a reload attempt fails. It does not belong to a request.
+	ProxyPhaseReload ProxyPhase = "reload"
+)
+
+// ProxyEvent describes a single step of a request handled by ProxyClient.
+//
+// Fields which are not known yet at the time of the phase are left with zero values.
+type ProxyEvent struct {
+	Phase     ProxyPhase
+	SessionID string
+	// Rule is nil if request did not match any rule of RouteTable.
+	Rule        *ProxyRouteRule
+	Method      string
+	URI         string
+	UpstreamUrl string
+	// StatusCode is the upstream response status in upstream_response phase and client response status in completed phase.
+	StatusCode int
+	// Attempts is the number of upstream requests sent including retries.
+	Attempts      int
+	RequestBytes  int64
+	ResponseBytes int64
+	// UpstreamLatency is the duration from sending the first upstream request until a response header is received.
+	UpstreamLatency time.Duration
+	// Elapsed is the duration since request was received by proxy client.
+	Elapsed time.Duration
+	// Err is set in error phase. In completed phase it contains the first error of the request if any.
+	// In reload phase it is set if reload failed and previous route table is kept.
+	Err error
+	// Cache is set from cache phase on for requests which are looked up in response cache.
+	Cache CacheStatus
+	// Coalesced is set for requests which are served with the upstream response of an identical in-flight request.
+	// Such requests report no upstream details of their own.
+	Coalesced bool
+	// ConfigPath is the route config file in reload phase. It is empty if route table is set via SetRouteTable.
+	ConfigPath string
+}
+
+// ProxyObserver receives structured events of ProxyClient.
+//
+// Events of the same request are delivered sequentially from the goroutine handling the request.
+type ProxyObserver interface {
+	OnProxyEvent(ctx context.Context, event ProxyEvent)
+}
+
+// ProxyObserverFunc adapts a function to ProxyObserver interface.
+type ProxyObserverFunc func(ctx context.Context, event ProxyEvent)
+
+func (f ProxyObserverFunc) OnProxyEvent(ctx context.Context, event ProxyEvent) {
+	f(ctx, event)
+}
+
+type proxyTraceKey struct{}
+
+// proxyTrace accumulates details of a single request for building ProxyEvents.
+type proxyTrace struct {
+	start     time.Time
+	sessionID string
+	rule      *ProxyRouteRule
+	method    string
+	uri       string
+	writer    *trackingWriter
+	err       error
+
+	upstreamUrl     string
+	upstreamStatus  int
+	attempts        int
+	requestBytes    int64
+	upstreamLatency time.Duration
+	cacheStatus     CacheStatus
+	coalesced       bool
+}
+
+// SessionIDFromContext returns session ID which ProxyClient has assigned to the request of input context.
+//
+// Context passed to ProxyClient hooks always carries a session ID.
+// Events which output the same session ID belong to same http session.
+func SessionIDFromContext(ctx context.Context) string {
+	trace := traceFromContext(ctx)
+	if trace == nil {
+		return ""
+	}
+	return trace.sessionID
+}
+
+func traceFromContext(ctx context.Context) *proxyTrace {
+	trace, _ := ctx.Value(proxyTraceKey{}).(*proxyTrace)
+	return trace
+}
+
+// SetObserver registers observer to receive structured ProxyEvents in addition to the hooks.
+func (pc *ProxyClient) SetObserver(observer ProxyObserver) {
+	pc.observer = observer
+}
+
+// emit delivers event of input phase to observer, built from the request trace of ctx.
+func (pc *ProxyClient) emit(ctx context.Context, phase ProxyPhase, err error) {
+	trace := traceFromContext(ctx)
+	if trace == nil {
+		return
+	}
+	if err != nil && trace.err == nil {
+		trace.err = err
+	}
+	if pc.observer == nil {
+		return
+	}
+
+	event := ProxyEvent{
+		Phase:           phase,
+		SessionID:       trace.sessionID,
+		Rule:            trace.rule,
+		Method:          trace.method,
+		URI:             trace.uri,
+		UpstreamUrl:     trace.upstreamUrl,
+		Attempts:        trace.attempts,
+		RequestBytes:    trace.requestBytes,
+		UpstreamLatency: trace.upstreamLatency,
+		Cache:           trace.cacheStatus,
+		Coalesced:       trace.coalesced,
+		Elapsed:         time.Since(trace.start),
+		Err:             err,
+	}
+
+	switch phase {
+	case ProxyPhaseUpstreamResponse:
+		event.StatusCode = trace.upstreamStatus
+	case ProxyPhaseCompleted:
+		event.StatusCode = trace.writer.status
+		event.ResponseBytes = trace.writer.written
+		event.Err = trace.err
+	}
+
+	pc.observer.OnProxyEvent(ctx, event)
+}
+
+// trackingWriter records status code and number of bytes written to client.
+type trackingWriter struct {
+	http.ResponseWriter
+	status  int
+	written int64
+}
+
+func (tw *trackingWriter) WriteHeader(statusCode int) {
+	if tw.status == 0 {
+		tw.status = statusCode
+	}
+	tw.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (tw *trackingWriter) Write(b []byte) (int, error) {
+	if tw.status == 0 {
+		tw.status = http.StatusOK
+	}
+	n, err := tw.ResponseWriter.Write(b)
+	tw.written += int64(n)
+	return n, err
+}
+
+func (tw *trackingWriter) Flush() {
+	flusher, ok := tw.ResponseWriter.(http.Flusher)
+	if ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach underlying writer.
+func (tw *trackingWriter) Unwrap() http.ResponseWriter {
+	return tw.ResponseWriter
+}
@@ -0,0 +1,259 @@
+package gmrouting
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+type HostPolicy int
+
+const (
+	// HostRewrite sends host of the upstream url as Host header. It is the default.
+	HostRewrite HostPolicy = iota
+	// HostPreserve sends Host header of the incoming request to upstream.
+	HostPreserve
+)
+
+// hopByHopHeaders are meaningful only for a single transport-level connection and must not be forwarded. (RFC 7230 6.1)
+var hopByHopHeaders = []string{
+	"Connection",
+	"Proxy-Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+var forwardingHeaders = []string{
+	"Forwarded",
+	"X-Forwarded-For",
+	"X-Forwarded-Proto",
+	"X-Forwarded-Host",
+}
+
+// ForwardingConfig contains settings of headers which tell upstream about the client and the original request.
+type ForwardingConfig struct {
+	// XForwarded enables X-Forwarded-For, X-Forwarded-Proto and X-Forwarded-Host headers.
+	XForwarded bool
+	// Forwarded enables RFC 7239 Forwarded header. E.g: Forwarded: for=192.0.2.60;proto=https;host=example.com
+	Forwarded bool
+	// TrustedProxies contains IPs or CIDRs of proxies in front of proxy client. E.g: 10.0.0.0/8, 192.168.1.10
+	//
+	// Forwarding headers of requests which are received from a trusted proxy are kept and the proxy is appended to the chain.
+	// Forwarding headers of any other request are discarded, so that clients can not spoof them.
+	TrustedProxies []string
+	// Host decides Host header of upstream requests.
+	Host HostPolicy
+}
+
+// DefaultForwardingConfig enables X-Forwarded-* headers and trusts no proxies. Host header is rewritten.
+//
+// It is used by ProxyClient unless another one is set.
+func DefaultForwardingConfig() ForwardingConfig {
+	return ForwardingConfig{
+		XForwarded: true,
+		Host:       HostRewrite,
+	}
+}
+
+// forwarding is the validated form of ForwardingConfig.
+type forwarding struct {
+	config         ForwardingConfig
+	trustedProxies []*net.IPNet
+}
+
+func newForwarding(config ForwardingConfig) (*forwarding, error) {
+	f := &forwarding{
+		config:         config,
+		trustedProxies: make([]*net.IPNet, 0, len(config.TrustedProxies)),
+	}
+
+	for _, p := range config.TrustedProxies {
+		if !strings.Contains(p, "/") {
+			ip := net.ParseIP(p)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy: '%s'", p)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 8 * net.IPv4len
+			}
+			f.trustedProxies = append(f.trustedProxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, ipNet, err := net.ParseCIDR(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy: '%s'", p)
+		}
+		f.trustedProxies = append(f.trustedProxies, ipNet)
+	}
+	return f, nil
+}
+
+// isTrusted returns true if input ip belongs to one of the trusted proxies.
+func (f *forwarding) isTrusted(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, n := range f.trustedProxies {
+		if n.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// upstreamHeader returns a COPY of input header which is sanitized and extended for the upstream request of r.
+func (f *forwarding) upstreamHeader(r *http.Request, header http.Header) http.Header {
+	result := header.Clone()
+	if result == nil {
+		result = make(http.Header)
+	}
+	removeHopByHopHeaders(result)
+
+	/* Upgrade is hop-by-hop, yet it has to reach upstream for the tunnel to be established. */
+	if isUpgradeRequest(header) {
+		result.Set("Connection", "Upgrade")
+		result.Set("Upgrade", header.Get("Upgrade"))
+	}
+
+	/* Keep trailers support request of the client, as it is end-to-end even though TE header is not. */
+	if headerContainsToken(header, "Te", "trailers") {
+		result.Set("Te", "trailers")
+	}
+
+	peer := remoteIP(r)
+	if !f.isTrusted(peer) {
+		for _, h := range forwardingHeaders {
+			result.Del(h)
+		}
+	}
+
+	proto := "http"
+	if r.TLS != nil {
+		proto = "https"
+	}
+
+	if f.config.XForwarded {
+		prior := strings.Join(result.Values("X-Forwarded-For"), ", ")
+		if prior != "" {
+			result.Set("X-Forwarded-For", prior+", "+peer)
+		} else {
+			result.Set("X-Forwarded-For", peer)
+		}
+		if result.Get("X-Forwarded-Proto") == "" {
+			result.Set("X-Forwarded-Proto", proto)
+		}
+		if result.Get("X-Forwarded-Host") == "" && r.Host != "" {
+			result.Set("X-Forwarded-Host", r.Host)
+		}
+	}
+
+	if f.config.Forwarded {
+		element := "for=" + forwardedNode(peer) + ";proto=" + proto
+		if r.Host != "" {
+			element += ";host=" + forwardedValue(r.Host)
+		}
+		prior := strings.Join(result.Values("Forwarded"), ", ")
+		if prior != "" {
+			element = prior + ", " + element
+		}
+		result.Set("Forwarded", element)
+	}
+	return result
+}
+
+// upstreamHost returns Host header of the upstream request of r. Empty string means host of the upstream url.
+func (f *forwarding) upstreamHost(r *http.Request) string {
+	if f.config.Host == HostPreserve {
+		return r.Host
+	}
+	return ""
+}
+
+// copyResponseHeader copies end-to-end headers of upstream response to client response.
+func copyResponseHeader(dst, src http.Header) {
+	connectionTokens := connectionHeaders(src)
+	for k, v := range src {
+		if isHopByHop(k) || connectionTokens[k] {
+			continue
+		}
+		for i := 0; i < len(v); i++ {
+			dst.Add(k, v[i])
+		}
+	}
+}
+
+// removeHopByHopHeaders removes standard hop-by-hop headers along with the ones listed in Connection header.
+func removeHopByHopHeaders(header http.Header) {
+	for k := range connectionHeaders(header) {
+		header.Del(k)
+	}
+	for _, h := range hopByHopHeaders {
+		header.Del(h)
+	}
+}
+
+// connectionHeaders returns canonical names of headers listed in Connection header.
+func connectionHeaders(header http.Header) map[string]bool {
+	result := make(map[string]bool)
+	for _, v := range header.Values("Connection") {
+		for _, token := range strings.Split(v, ",") {
+			token = strings.TrimSpace(token)
+			if token != "" {
+				result[http.CanonicalHeaderKey(token)] = true
+			}
+		}
+	}
+	return result
+}
+
+func isHopByHop(name string) bool {
+	for _, h := range hopByHopHeaders {
+		if h == name {
+			return true
+		}
+	}
+	return false
+}
+
+func headerContainsToken(header http.Header, name, token string) bool {
+	for _, v := range header.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// forwardedNode formats input ip as a node of Forwarded header. IPv6 addresses are bracketed and quoted. (RFC 7239 6)
+func forwardedNode(ip string) string {
+	if strings.Contains(ip, ":") {
+		return `"[` + ip + `]"`
+	}
+	return forwardedValue(ip)
+}
+
+// forwardedValue quotes input value unless it is a token.
+func forwardedValue(value string) string {
+	for _, c := range value {
+		if !isTokenChar(c) {
+			return `"` + strings.ReplaceAll(strings.ReplaceAll(value, `\`, `\\`), `"`, `\"`) + `"`
+		}
+	}
+	return value
+}
+
+func isTokenChar(c rune) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || strings.ContainsRune("!#$%&'*+-.^_`|~", c)
+}
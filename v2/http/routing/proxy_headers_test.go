@@ -0,0 +1,116 @@
+package gmrouting
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	gmhttp "github.com/onuryurdupak/gomod/v2/http"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Proxy_Hop_By_Hop_Headers(t *testing.T) {
+	var received http.Header
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Clone()
+		w.Header().Set("Connection", "X-Upstream-Hop")
+		w.Header().Set("X-Upstream-Hop", "secret")
+		w.Header().Set("Keep-Alive", "timeout=5")
+		w.Header().Set("X-Upstream", "yes")
+	}))
+	defer upstream.Close()
+
+	table, err := NewProxyRouteTable([]*ProxyRouteRule{NewProxyRouteRule(`GET`, `/api/accounts`)})
+	assert.NoError(t, err)
+
+	for _, streaming := range []bool{false, true} {
+		pc := NewProxyClient(table, upstream.URL, upstream.Client(), gmhttp.NewResponseWriter(), nil, nil, nil, nil)
+		pc.SetStreaming(streaming, 1024)
+
+		req := httptest.NewRequest(`GET`, `/api/accounts`, nil)
+		req.Header.Set("Connection", "keep-alive, X-Client-Hop")
+		req.Header.Set("X-Client-Hop", "1")
+		req.Header.Set("Proxy-Authorization", "Basic abc")
+		req.Header.Set("Te", "trailers, deflate")
+		req.Header.Set("X-Tenant", "acme")
+		rec := httptest.NewRecorder()
+		pc.HandleRequestAndRedirect(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Empty(t, received.Get("X-Client-Hop"))
+		assert.Empty(t, received.Get("Proxy-Authorization"))
+		assert.Equal(t, "trailers", received.Get("Te"))
+		assert.Equal(t, "acme", received.Get("X-Tenant"))
+
+		assert.Empty(t, rec.Header().Get("Connection"))
+		assert.Empty(t, rec.Header().Get("X-Upstream-Hop"))
+		assert.Empty(t, rec.Header().Get("Keep-Alive"))
+		assert.Equal(t, "yes", rec.Header().Get("X-Upstream"))
+
+		/* Incoming request is not modified. */
+		assert.Equal(t, "1", req.Header.Get("X-Client-Hop"))
+	}
+}
+
+func Test_Proxy_Forwarding_Headers(t *testing.T) {
+	var received http.Header
+	var receivedHost string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Clone()
+		receivedHost = r.Host
+	}))
+	defer upstream.Close()
+
+	table, err := NewProxyRouteTable([]*ProxyRouteRule{NewProxyRouteRule(`GET`, `/api/accounts`)})
+	assert.NoError(t, err)
+
+	pc := NewProxyClient(table, upstream.URL, upstream.Client(), gmhttp.NewResponseWriter(), nil, nil, nil, nil)
+
+	send := func(remoteAddr string, header map[string]string) {
+		req := httptest.NewRequest(`GET`, `http://example.com/api/accounts`, nil)
+		req.RemoteAddr = remoteAddr
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		pc.HandleRequestAndRedirect(rec, req)
+		assert.Equal(t, http.StatusOK, rec.Code)
+	}
+
+	/* Spoofed headers of untrusted clients are discarded. */
+	send("203.0.113.7:5000", map[string]string{"X-Forwarded-For": "1.1.1.1", "X-Forwarded-Host": "evil.com", "Forwarded": "for=1.1.1.1"})
+	assert.Equal(t, "203.0.113.7", received.Get("X-Forwarded-For"))
+	assert.Equal(t, "http", received.Get("X-Forwarded-Proto"))
+	assert.Equal(t, "example.com", received.Get("X-Forwarded-Host"))
+	assert.Empty(t, received.Get("Forwarded"))
+	assert.Equal(t, upstream.Listener.Addr().String(), receivedHost)
+
+	err = pc.SetForwarding(ForwardingConfig{
+		XForwarded:     true,
+		Forwarded:      true,
+		TrustedProxies: []string{"10.0.0.0/8", "2001:db8::1"},
+		Host:           HostPreserve,
+	})
+	assert.NoError(t, err)
+
+	send("10.1.2.3:5000", map[string]string{"X-Forwarded-For": "198.51.100.1", "X-Forwarded-Proto": "https", "Forwarded": "for=198.51.100.1;proto=https"})
+	assert.Equal(t, "198.51.100.1, 10.1.2.3", received.Get("X-Forwarded-For"))
+	assert.Equal(t, "https", received.Get("X-Forwarded-Proto"))
+	assert.Equal(t, "for=198.51.100.1;proto=https, for=10.1.2.3;proto=http;host=example.com", received.Get("Forwarded"))
+	assert.Equal(t, "example.com", receivedHost)
+
+	send("[2001:db8::1]:5000", nil)
+	assert.Equal(t, "2001:db8::1", received.Get("X-Forwarded-For"))
+	assert.Equal(t, `for="[2001:db8::1]";proto=http;host=example.com`, received.Get("Forwarded"))
+
+	send("[2001:db8::2]:5000", map[string]string{"X-Forwarded-For": "198.51.100.1"})
+	assert.Equal(t, "2001:db8::2", received.Get("X-Forwarded-For"))
+
+	err = pc.SetForwarding(ForwardingConfig{})
+	assert.NoError(t, err)
+	send("10.1.2.3:5000", map[string]string{"X-Forwarded-For": "198.51.100.1"})
+	assert.Empty(t, received.Get("X-Forwarded-For"))
+
+	assert.Error(t, pc.SetForwarding(ForwardingConfig{TrustedProxies: []string{"10.0.0.0/33"}}))
+	assert.Error(t, pc.SetForwarding(ForwardingConfig{TrustedProxies: []string{"proxy.local"}}))
+}
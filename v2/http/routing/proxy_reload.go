@@ -0,0 +1,113 @@
+package gmrouting
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+)
+
+// RouteTable returns the route table which is currently used by proxy client.
+func (pc *ProxyClient) RouteTable() *RouteTable {
+	return pc.routeTable.Load()
+}
+
+// SetRouteTable replaces route table of proxy client atomically.
+//
+// Requests which are already being handled finish under the previous table. Emits a reload event to observer.
+func (pc *ProxyClient) SetRouteTable(routeTable *RouteTable) {
+	pc.routeTable.Store(routeTable)
+	pc.emitReload("", nil)
+}
+
+// ReloadRouteConfig builds a new route table from proxy routes of input config file and replaces the current one.
+// See LoadRouteConfig for supported formats.
+//
+// Previous table is kept if the file can not be loaded or is invalid. Errors are also passed to onErr hook.
+func (pc *ProxyClient) ReloadRouteConfig(path string) error {
+	table, err := loadProxyRouteTable(path)
+	if err != nil {
+		if pc.onErr != nil {
+			pc.onErr(context.Background(), err)
+		}
+		pc.emitReload(path, err)
+		return err
+	}
+
+	pc.routeTable.Store(table)
+	pc.emitReload(path, nil)
+	return nil
+}
+
+// WatchRouteConfig loads route table from input config file and reloads it whenever the file changes
+// until ctx is cancelled. File is checked for modification time and size changes every interval.
+//
+// It returns error without watching if the initial load fails. Later failures keep the previous table
+// and are reported via onErr hook and reload events.
+func (pc *ProxyClient) WatchRouteConfig(ctx context.Context, path string, interval time.Duration) error {
+	if interval <= 0 {
+		return fmt.Errorf("invalid watch interval: %s", interval)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	err = pc.ReloadRouteConfig(path)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				current, err := os.Stat(path)
+				if err != nil {
+					/* File can be missing for a moment while editors replace it. Previous table stays in use. */
+					continue
+				}
+				if current.ModTime().Equal(info.ModTime()) && current.Size() == info.Size() {
+					continue
+				}
+
+				/* Failed reloads are not retried until the file changes again. */
+				info = current
+				pc.ReloadRouteConfig(path)
+			}
+		}
+	}()
+	return nil
+}
+
+func loadProxyRouteTable(path string) (*RouteTable, error) {
+	config, err := LoadRouteConfig(path)
+	if err != nil {
+		return nil, err
+	}
+
+	table, err := config.NewProxyRouteTable()
+	if err != nil {
+		return nil, fmt.Errorf("unable to reload route config: '%s': %s", path, err.Error())
+	}
+	return table, nil
+}
+
+// emitReload delivers a reload event to observer. Reload events do not belong to a request.
+func (pc *ProxyClient) emitReload(configPath string, err error) {
+	if pc.observer == nil {
+		return
+	}
+
+	pc.observer.OnProxyEvent(context.Background(), ProxyEvent{
+		Phase:      ProxyPhaseReload,
+		Err:        err,
+		ConfigPath: configPath,
+	})
+}
@@ -0,0 +1,131 @@
+package gmrouting
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	gmhttp "github.com/onuryurdupak/gomod/v2/http"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Proxy_Set_Route_Table(t *testing.T) {
+	received := make(chan struct{})
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(received)
+		<-release
+		w.Write([]byte("ok"))
+	}))
+	defer upstream.Close()
+
+	oldTable, err := NewProxyRouteTable([]*ProxyRouteRule{NewProxyRouteRule(http.MethodGet, `/api/accounts`)})
+	assert.NoError(t, err)
+	newTable, err := NewProxyRouteTable([]*ProxyRouteRule{NewProxyRouteRule(http.MethodGet, `/api/transfers`)})
+	assert.NoError(t, err)
+
+	pc := NewProxyClient(oldTable, upstream.URL, upstream.Client(), gmhttp.NewResponseWriter(), nil, nil, nil, nil)
+
+	var events []ProxyEvent
+	mutex := &sync.Mutex{}
+	pc.SetObserver(ProxyObserverFunc(func(ctx context.Context, event ProxyEvent) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if event.Phase == ProxyPhaseReload {
+			events = append(events, event)
+		}
+	}))
+
+	/* In-flight request finishes under the old table. */
+	inFlight := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		pc.HandleRequestAndRedirect(inFlight, httptest.NewRequest(http.MethodGet, `/api/accounts`, nil))
+		close(done)
+	}()
+
+	<-received
+	pc.SetRouteTable(newTable)
+	close(release)
+	<-done
+
+	assert.Equal(t, http.StatusOK, inFlight.Code)
+	assert.Equal(t, newTable, pc.RouteTable())
+
+	rec := httptest.NewRecorder()
+	pc.HandleRequestAndRedirect(rec, httptest.NewRequest(http.MethodGet, `/api/accounts`, nil))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	assert.Len(t, events, 1)
+	assert.NoError(t, events[0].Err)
+}
+
+func Test_Proxy_Watch_Route_Config(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer upstream.Close()
+
+	path := filepath.Join(t.TempDir(), "routes.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte("proxyRoutes:\n  - {method: GET, path: /api/accounts}\n"), 0600))
+
+	var errs []error
+	var events []ProxyEvent
+	mutex := &sync.Mutex{}
+
+	table, err := NewProxyRouteTable(nil)
+	assert.NoError(t, err)
+	pc := NewProxyClient(table, upstream.URL, upstream.Client(), gmhttp.NewResponseWriter(), nil,
+		func(ctx context.Context, err error) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			errs = append(errs, err)
+		}, nil, nil)
+	pc.SetObserver(ProxyObserverFunc(func(ctx context.Context, event ProxyEvent) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if event.Phase == ProxyPhaseReload {
+			events = append(events, event)
+		}
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	assert.NoError(t, pc.WatchRouteConfig(ctx, path, 10*time.Millisecond))
+
+	status := func(path string) int {
+		rec := httptest.NewRecorder()
+		pc.HandleRequestAndRedirect(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec.Code
+	}
+	assert.Equal(t, http.StatusOK, status(`/api/accounts`))
+
+	assert.NoError(t, os.WriteFile(path, []byte("proxyRoutes:\n  - {method: GET, path: /api/transfers/latest}\n"), 0600))
+	assert.Eventually(t, func() bool { return status(`/api/transfers/latest`) == http.StatusOK }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, http.StatusUnauthorized, status(`/api/accounts`))
+
+	/* Invalid config keeps the previous table. */
+	assert.NoError(t, os.WriteFile(path, []byte("proxyRoutes:\n  - {method: GET, path: api}\n"), 0600))
+	assert.Eventually(t, func() bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return len(events) == 3
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, http.StatusOK, status(`/api/transfers/latest`))
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	assert.Equal(t, path, events[2].ConfigPath)
+	assert.Error(t, events[2].Err)
+	/* Rejected requests are also reported via onErr. Reload error is the last one. */
+	assert.Equal(t, events[2].Err, errs[len(errs)-1])
+
+	assert.Error(t, pc.WatchRouteConfig(ctx, filepath.Join(t.TempDir(), "missing.yaml"), time.Second))
+}
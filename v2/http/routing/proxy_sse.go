@@ -0,0 +1,210 @@
+package gmrouting
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxEventLineBytes caps a single line of an event stream which is kept in memory for inspection.
+// Event hook is no longer called for a stream once one of its lines exceeds it. Stream itself is not affected.
+const maxEventLineBytes = 1 << 20
+
+// ServerSentEvent is a single event of a text/event-stream response.
+type ServerSentEvent struct {
+	// ID is the last event ID of the stream. It is kept for following events unless they set another one.
+	ID    string
+	Event string
+	// Data lines are joined with a new line.
+	Data string
+	// Retry is the reconnection time sent along with the event. It is zero if event does not have one.
+	Retry time.Duration
+}
+
+// SetEventHook makes proxy client deliver each event of text/event-stream responses to onEvent as soon as it is passed to client.
+//
+// onResRead hook is not called for event streams since they may never complete. Compressed event streams are not inspected.
+func (pc *ProxyClient) SetEventHook(onEvent func(ctx context.Context, event ServerSentEvent)) {
+	pc.onEvent = onEvent
+}
+
+// isStreamingResponse returns true for event streams and responses of unknown length. (E.g: Chunked transfer encoding.)
+func isStreamingResponse(httpRes *http.Response) bool {
+	return isEventStream(httpRes.Header) || httpRes.ContentLength < 0
+}
+
+func isEventStream(header http.Header) bool {
+	mediaType, _, err := mime.ParseMediaType(header.Get("Content-Type"))
+	return err == nil && mediaType == "text/event-stream"
+}
+
+// flushResponse passes a streaming upstream response to client chunk by chunk, flushing after each one.
+//
+// At most hookLimit bytes of the response are delivered to onResRead hook. Event streams are delivered to event hook instead.
+func (pc *ProxyClient) flushResponse(w http.ResponseWriter, r *http.Request, httpRes *http.Response, hookLimit int) {
+	copyResponseHeader(w.Header(), httpRes.Header)
+	w.WriteHeader(httpRes.StatusCode)
+
+	flusher, _ := w.(http.Flusher)
+	flush := func() {
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	/* Client gets the header before the first chunk arrives. */
+	flush()
+
+	var capture *cappedBuffer
+	var parser *eventParser
+	if !isEventStream(httpRes.Header) {
+		capture = newCappedBuffer(hookLimit)
+	} else if pc.onEvent != nil && httpRes.Header.Get("Content-Encoding") == "" {
+		parser = newEventParser(func(event ServerSentEvent) {
+			pc.onEvent(r.Context(), event)
+		})
+	}
+
+	buf := make([]byte, 32*1024)
+	for {
+		n, readErr := httpRes.Body.Read(buf)
+		if n > 0 {
+			_, err := w.Write(buf[:n])
+			if err != nil {
+				/* Response header is already sent, client can only be notified by the broken stream. */
+				pc.reportErr(r.Context(), fmt.Errorf("error streaming server response for client: %s", err.Error()))
+				return
+			}
+			flush()
+
+			if capture != nil {
+				capture.Write(buf[:n])
+			}
+			if parser != nil {
+				parser.Write(buf[:n])
+			}
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			pc.reportErr(r.Context(), fmt.Errorf("error reading response payload: %s", readErr.Error()))
+			return
+		}
+	}
+
+	if capture == nil || pc.onResRead == nil {
+		return
+	}
+
+	resBytes := capture.Bytes()
+	if httpRes.Header.Get("Content-Encoding") == "gzip" {
+		var err error
+		resBytes, err = gunzipPrefix(resBytes, hookLimit)
+		if err != nil {
+			pc.reportErr(r.Context(), fmt.Errorf("error reading from gzip reader: %s", err.Error()))
+			return
+		}
+	}
+	pc.onResRead(r.Context(), resBytes)
+}
+
+// eventParser splits an event stream into events as its chunks are written. (HTML Living Standard 9.2.6)
+type eventParser struct {
+	// pending contains the incomplete last line.
+	pending []byte
+	event   ServerSentEvent
+	data    []string
+	// overflow is set once a line exceeds maxEventLineBytes. No further events are parsed.
+	overflow bool
+	onEvent  func(ServerSentEvent)
+}
+
+func newEventParser(onEvent func(ServerSentEvent)) *eventParser {
+	return &eventParser{
+		onEvent: onEvent,
+	}
+}
+
+// Write never fails. Events which are completed by input chunk are dispatched before it returns.
+func (p *eventParser) Write(chunk []byte) (int, error) {
+	if p.overflow {
+		return len(chunk), nil
+	}
+
+	p.pending = append(p.pending, chunk...)
+	for {
+		i := bytes.IndexAny(p.pending, "\r\n")
+		if i < 0 {
+			break
+		}
+
+		end := i + 1
+		if p.pending[i] == '\r' {
+			/* CR LF is a single line ending, which may be split across chunks. */
+			if end == len(p.pending) {
+				break
+			}
+			if p.pending[end] == '\n' {
+				end++
+			}
+		}
+
+		line := string(p.pending[:i])
+		p.pending = p.pending[end:]
+		p.line(line)
+	}
+
+	if len(p.pending) > maxEventLineBytes {
+		p.overflow = true
+		p.pending = nil
+	}
+	return len(chunk), nil
+}
+
+func (p *eventParser) line(line string) {
+	if line == "" {
+		p.dispatch()
+		return
+	}
+	if strings.HasPrefix(line, ":") {
+		return
+	}
+
+	field, value, _ := strings.Cut(line, ":")
+	value = strings.TrimPrefix(value, " ")
+
+	switch field {
+	case "event":
+		p.event.Event = value
+	case "data":
+		p.data = append(p.data, value)
+	case "id":
+		if !strings.Contains(value, "\x00") {
+			p.event.ID = value
+		}
+	case "retry":
+		ms, err := strconv.Atoi(value)
+		if err == nil && ms >= 0 {
+			p.event.Retry = time.Duration(ms) * time.Millisecond
+		}
+	}
+}
+
+// dispatch delivers collected event. Events without data are dropped.
+func (p *eventParser) dispatch() {
+	if len(p.data) > 0 {
+		p.event.Data = strings.Join(p.data, "\n")
+		p.onEvent(p.event)
+	}
+
+	p.data = nil
+	p.event = ServerSentEvent{
+		ID: p.event.ID,
+	}
+}
@@ -0,0 +1,144 @@
+package gmrouting
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	gmhttp "github.com/onuryurdupak/gomod/v2/http"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Event_Parser(t *testing.T) {
+	events := make([]ServerSentEvent, 0)
+	parser := newEventParser(func(event ServerSentEvent) {
+		events = append(events, event)
+	})
+
+	chunks := []string{
+		": keep-alive\n\n",
+		"id: 1\nevent: transfer\ndata: {\"amount\":\r",
+		"\ndata: 10}\r\n\r\n",
+		"data:no space\nretry: 3000\n\n",
+		"event: ignored\n\n",
+		"id: 2\ndata: last",
+	}
+	for _, c := range chunks {
+		parser.Write([]byte(c))
+	}
+
+	assert.Equal(t, []ServerSentEvent{
+		{ID: "1", Event: "transfer", Data: "{\"amount\":\n10}"},
+		{ID: "1", Data: "no space", Retry: 3 * time.Second},
+	}, events)
+
+	/* Incomplete event is dispatched once its blank line arrives. */
+	parser.Write([]byte("\n\n"))
+	assert.Equal(t, ServerSentEvent{ID: "2", Data: "last"}, events[2])
+}
+
+func Test_Proxy_Event_Stream(t *testing.T) {
+	next := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-cache")
+		for i, data := range []string{"first", "second"} {
+			if i > 0 {
+				<-next
+			}
+			w.Write([]byte("event: tick\ndata: " + data + "\n\n"))
+			w.(http.Flusher).Flush()
+		}
+	}))
+	defer upstream.Close()
+
+	table, err := NewProxyRouteTable([]*ProxyRouteRule{NewProxyRouteRule(`GET`, `/events`)})
+	assert.NoError(t, err)
+
+	for _, streaming := range []bool{false, true} {
+		resRead := false
+		events := make(chan ServerSentEvent, 2)
+
+		pc := NewProxyClient(table, upstream.URL, upstream.Client(), gmhttp.NewResponseWriter(), nil, nil, nil,
+			func(ctx context.Context, b []byte) { resRead = true })
+		pc.SetStreaming(streaming, 1024)
+		pc.SetEventHook(func(ctx context.Context, event ServerSentEvent) {
+			events <- event
+		})
+
+		proxy := httptest.NewServer(http.HandlerFunc(pc.HandleRequestAndRedirect))
+
+		res, err := proxy.Client().Get(proxy.URL + "/events")
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, "text/event-stream; charset=utf-8", res.Header.Get("Content-Type"))
+
+		/* First event reaches client and hook while upstream is still holding the stream open. */
+		reader := bufio.NewReader(res.Body)
+		line, err := reader.ReadString('\n')
+		assert.NoError(t, err)
+		assert.Equal(t, "event: tick\n", line)
+		assert.Equal(t, ServerSentEvent{Event: "tick", Data: "first"}, <-events)
+
+		next <- struct{}{}
+		rest, err := io.ReadAll(reader)
+		assert.NoError(t, err)
+		assert.Equal(t, "data: first\n\nevent: tick\ndata: second\n\n", string(rest))
+		assert.Equal(t, ServerSentEvent{Event: "tick", Data: "second"}, <-events)
+
+		res.Body.Close()
+		proxy.Close()
+		assert.False(t, resRead)
+	}
+}
+
+func Test_Proxy_Chunked_Response(t *testing.T) {
+	next := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte("part-1;"))
+		w.(http.Flusher).Flush()
+		<-next
+		w.Write([]byte("part-2"))
+	}))
+	defer upstream.Close()
+
+	table, err := NewProxyRouteTable([]*ProxyRouteRule{NewProxyRouteRule(`GET`, `/report`)})
+	assert.NoError(t, err)
+
+	for _, streaming := range []bool{false, true} {
+		resBytes := make(chan []byte, 1)
+		pc := NewProxyClient(table, upstream.URL, upstream.Client(), gmhttp.NewResponseWriter(), nil, nil, nil,
+			func(ctx context.Context, b []byte) { resBytes <- b })
+		pc.SetStreaming(streaming, 10)
+
+		proxy := httptest.NewServer(http.HandlerFunc(pc.HandleRequestAndRedirect))
+
+		res, err := proxy.Client().Get(proxy.URL + "/report")
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusAccepted, res.StatusCode)
+
+		first := make([]byte, 7)
+		_, err = io.ReadFull(res.Body, first)
+		assert.NoError(t, err)
+		assert.Equal(t, "part-1;", string(first))
+
+		next <- struct{}{}
+		rest, err := io.ReadAll(res.Body)
+		assert.NoError(t, err)
+		assert.Equal(t, "part-2", string(rest))
+		res.Body.Close()
+
+		/* Whole body is delivered to hook in buffered mode, a capped one in streaming mode. */
+		if streaming {
+			assert.Equal(t, "part-1;par", string(<-resBytes))
+		} else {
+			assert.Equal(t, "part-1;part-2", string(<-resBytes))
+		}
+		proxy.Close()
+	}
+}
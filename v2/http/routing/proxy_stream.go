@@ -0,0 +1,148 @@
+package gmrouting
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// redirectStreaming pipes request and response bodies between client and upstream.
+// Only a capped copy of the bodies is kept in memory for onReqRead and onResRead hooks.
+func (pc *ProxyClient) redirectStreaming(w http.ResponseWriter, r *http.Request, call *proxyCall) {
+	reqCapture := newCappedBuffer(pc.maxHookBytes)
+
+	var body io.ReadCloser = http.NoBody
+	contentLength := int64(0)
+	if r.Body != nil && r.ContentLength != 0 {
+		body = &teeReadCloser{
+			Reader: io.TeeReader(r.Body, reqCapture),
+			Closer: r.Body,
+		}
+		contentLength = r.ContentLength
+	}
+	newBody := func() io.ReadCloser {
+		return body
+	}
+
+	/* Streamed request body can not be replayed, therefore only requests without body are retried. */
+	httpRes, err := pc.do(r, call, newBody, body == http.NoBody, contentLength)
+	call.trace.requestBytes = reqCapture.Total()
+	pc.emit(r.Context(), ProxyPhaseRequestRead, nil)
+	if pc.onReqRead != nil {
+		pc.onReqRead(r.Context(), reqCapture.Bytes())
+	}
+	if err != nil {
+		pc.writeUpstreamErr(w, r, err)
+		return
+	}
+	defer httpRes.Body.Close()
+
+	pc.respondStreaming(w, r, httpRes)
+}
+
+// respondStreaming pipes upstream response to client. Only a capped copy of the body is kept for onResRead hook.
+func (pc *ProxyClient) respondStreaming(w http.ResponseWriter, r *http.Request, httpRes *http.Response) {
+	if isStreamingResponse(httpRes) {
+		pc.flushResponse(w, r, httpRes, pc.maxHookBytes)
+		return
+	}
+
+	copyResponseHeader(w.Header(), httpRes.Header)
+	w.WriteHeader(httpRes.StatusCode)
+
+	resCapture := newCappedBuffer(pc.maxHookBytes)
+	_, err := io.Copy(w, io.TeeReader(httpRes.Body, resCapture))
+	if err != nil {
+		/* Response header is already sent, client can only be notified by the broken stream. */
+		pc.reportErr(r.Context(), fmt.Errorf("error streaming server response for client: %s", err.Error()))
+		return
+	}
+
+	resBytes := resCapture.Bytes()
+	if httpRes.Header.Get("Content-Encoding") == "gzip" {
+		resBytes, err = gunzipPrefix(resBytes, pc.maxHookBytes)
+		if err != nil {
+			pc.reportErr(r.Context(), fmt.Errorf("error reading from gzip reader: %s", err.Error()))
+			return
+		}
+	}
+	if pc.onResRead != nil {
+		pc.onResRead(r.Context(), resBytes)
+	}
+}
+
+// cappedBuffer keeps the first limit bytes written to it and silently discards the rest.
+//
+// It is safe for concurrent use since http.Client may still be reading request body after Do returns.
+type cappedBuffer struct {
+	mutex *sync.Mutex
+	buf   []byte
+	limit int
+	total int64
+}
+
+func newCappedBuffer(limit int) *cappedBuffer {
+	if limit < 0 {
+		limit = 0
+	}
+	return &cappedBuffer{
+		mutex: &sync.Mutex{},
+		limit: limit,
+	}
+}
+
+// Write never fails. Bytes past the limit are dropped but reported as written to keep io.TeeReader going.
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.total += int64(len(p))
+	remaining := b.limit - len(b.buf)
+	if remaining > 0 {
+		b.buf = append(b.buf, p[:min(remaining, len(p))]...)
+	}
+	return len(p), nil
+}
+
+// Bytes returns a COPY of the captured bytes.
+func (b *cappedBuffer) Bytes() []byte {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return bytes.Clone(b.buf)
+}
+
+// Total returns the number of bytes written including the discarded ones.
+func (b *cappedBuffer) Total() int64 {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.total
+}
+
+type teeReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// gunzipPrefix decompresses at most limit bytes from a gzip payload which may have been truncated.
+func gunzipPrefix(payload []byte, limit int) ([]byte, error) {
+	if len(payload) == 0 {
+		return payload, nil
+	}
+
+	gzipReader, err := gzip.NewReader(bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+
+	decompressed, err := io.ReadAll(io.LimitReader(gzipReader, int64(limit)))
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, err
+	}
+	return decompressed, nil
+}
@@ -0,0 +1,176 @@
+package gmrouting
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// ProxyTarget overrides where and how a request allowed by a ProxyRouteRule is redirected.
+type ProxyTarget struct {
+	// UpstreamUrl overrides routeUrl (and upstream pool) of ProxyClient for the rule.
+	// Left empty, ProxyClient defaults are used.
+	//
+	// E.g: http://10.0.0.1:8080
+	UpstreamUrl string
+	// PathRewrite replaces request path before redirecting. Query parameters are kept as is.
+	// Route parameters of the rule can be used within curly brackets.
+	//
+	// E.g: Rule path: `/api/transfers/{guid}` PathRewrite: `/v2/transfer/{guid}/detail`
+	PathRewrite string
+	// HeaderRewrites are applied to upstream request headers in order.
+	HeaderRewrites []HeaderRewrite
+}
+
+type HeaderRewriteAction int
+
+const (
+	// HeaderSet replaces all values of the header.
+	HeaderSet HeaderRewriteAction = iota
+	// HeaderAdd appends a value to the header.
+	HeaderAdd
+	// HeaderRemove deletes the header. Value is ignored.
+	HeaderRemove
+)
+
+// HeaderRewrite modifies a single upstream request header.
+//
+// Value can contain route parameters of the rule within curly brackets. E.g: `tenant-{tenantID}`
+type HeaderRewrite struct {
+	Action HeaderRewriteAction
+	Name   string
+	Value  string
+}
+
+var templateParamRegexp = regexp.MustCompile(`\{(\w+)\}`)
+
+// NewProxyRouteRuleWithTarget creates a single entry for RouteTable which is redirected according to target.
+//
+// Note that rules for paths with route parameters must be defined with curly brackets.
+//
+// E.g: /Transfer/{guid}
+func NewProxyRouteRuleWithTarget(method, path string, target *ProxyTarget) *ProxyRouteRule {
+	rule := NewProxyRouteRule(method, path)
+	rule.target = target
+	return rule
+}
+
+// validate checks target against route parameters available in the rule path.
+func (t *ProxyTarget) validate(paramNames []string) error {
+	if t.UpstreamUrl != "" {
+		parsed, err := url.Parse(t.UpstreamUrl)
+		if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+			return fmt.Errorf("invalid upstream url: '%s'", t.UpstreamUrl)
+		}
+	}
+
+	if t.PathRewrite != "" && !strings.HasPrefix(t.PathRewrite, "/") {
+		return fmt.Errorf("path rewrite must start with '/': '%s'", t.PathRewrite)
+	}
+
+	err := validateTemplateParams(t.PathRewrite, paramNames)
+	if err != nil {
+		return err
+	}
+
+	for _, h := range t.HeaderRewrites {
+		if h.Name == "" {
+			return fmt.Errorf("header rewrite requires a header name")
+		}
+		if h.Action < HeaderSet || h.Action > HeaderRemove {
+			return fmt.Errorf("unknown header rewrite action for header: '%s'", h.Name)
+		}
+
+		err = validateTemplateParams(h.Value, paramNames)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rewriteUri returns request uri which will be used for upstream request.
+//
+// Values of wildcard parameters are escaped per segment, so that their slashes are kept as path separators.
+// It returns error if a decoded value contains `.` or `..` segments, which would escape PathRewrite upstream.
+// E.g: `a%2F..%2Fadmin` of a wildcard parameter.
+func (t *ProxyTarget) rewriteUri(reqUrl *url.URL, routeParams map[string]string, wildcards map[string]bool) (string, error) {
+	if t.PathRewrite == "" {
+		return reqUrl.RequestURI(), nil
+	}
+
+	escaped := make(map[string]string, len(routeParams))
+	for name, value := range routeParams {
+		segments := []string{value}
+		if wildcards[name] {
+			segments = strings.Split(value, "/")
+		}
+		for _, s := range segments {
+			if s == "." || s == ".." {
+				return "", fmt.Errorf("route parameter: '%s' can not contain dot segments: '%s'", name, value)
+			}
+		}
+
+		if wildcards[name] {
+			escaped[name] = escapeSegments(value)
+		} else {
+			escaped[name] = url.PathEscape(value)
+		}
+	}
+
+	path := fillTemplate(t.PathRewrite, escaped)
+	if reqUrl.RawQuery != "" {
+		path += "?" + reqUrl.RawQuery
+	}
+	return path, nil
+}
+
+// rewriteHeader applies header rewrites to a COPY of input header.
+func (t *ProxyTarget) rewriteHeader(header http.Header, routeParams map[string]string) http.Header {
+	if len(t.HeaderRewrites) == 0 {
+		return header
+	}
+
+	rewritten := header.Clone()
+	if rewritten == nil {
+		rewritten = make(http.Header)
+	}
+
+	for _, h := range t.HeaderRewrites {
+		value := fillTemplate(h.Value, routeParams)
+		switch h.Action {
+		case HeaderSet:
+			rewritten.Set(h.Name, value)
+		case HeaderAdd:
+			rewritten.Add(h.Name, value)
+		case HeaderRemove:
+			rewritten.Del(h.Name)
+		}
+	}
+	return rewritten
+}
+
+func validateTemplateParams(template string, paramNames []string) error {
+	for _, m := range templateParamRegexp.FindAllStringSubmatch(template, -1) {
+		found := false
+		for _, name := range paramNames {
+			if name == m[1] {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("route parameter: '%s' of template: '%s' does not exist in rule path", m[1], template)
+		}
+	}
+	return nil
+}
+
+// fillTemplate replaces curly bracket route parameters in template with their values.
+func fillTemplate(template string, routeParams map[string]string) string {
+	return templateParamRegexp.ReplaceAllStringFunc(template, func(m string) string {
+		return routeParams[m[1:len(m)-1]]
+	})
+}
@@ -0,0 +1,180 @@
+package gmrouting
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SetUpgradeIdleTimeout closes tunnels of upgraded connections (e.g. WebSocket) which carry no data
+// in either direction for input duration. Zero disables the timeout, which is the default.
+func (pc *ProxyClient) SetUpgradeIdleTimeout(timeout time.Duration) {
+	pc.upgradeIdleTimeout = timeout
+}
+
+// isUpgradeRequest returns true if header asks for a connection upgrade. E.g: Connection: Upgrade, Upgrade: websocket
+func isUpgradeRequest(header http.Header) bool {
+	return header.Get("Upgrade") != "" && headerContainsToken(header, "Connection", "upgrade")
+}
+
+// redirectUpgrade sends upgrade request of the call to upstream. If upstream switches protocols,
+// client connection is hijacked and bytes are tunneled in both directions until either side closes.
+//
+// Upgrade requests are never retried. Bodies are not delivered to onReqRead and onResRead hooks,
+// byte counts are reported via completed event instead.
+func (pc *ProxyClient) redirectUpgrade(w http.ResponseWriter, r *http.Request, call *proxyCall) {
+	trace := call.trace
+	trace.attempts = 1
+	trace.upstreamUrl = call.baseUrl
+
+	start := time.Now()
+	httpRes, err := pc.send(r, call, http.NoBody, 0)
+	trace.upstreamLatency = time.Since(start)
+	if err != nil {
+		pc.writeUpstreamErr(w, r, err)
+		return
+	}
+	defer httpRes.Body.Close()
+
+	trace.upstreamStatus = httpRes.StatusCode
+	pc.emit(r.Context(), ProxyPhaseUpstreamResponse, nil)
+
+	if httpRes.StatusCode != http.StatusSwitchingProtocols {
+		/* Upstream declined the upgrade. Its response is passed along as a regular one. */
+		copyResponseHeader(w.Header(), httpRes.Header)
+		w.WriteHeader(httpRes.StatusCode)
+		_, err = io.Copy(w, httpRes.Body)
+		if err != nil {
+			pc.reportErr(r.Context(), fmt.Errorf("error streaming server response for client: %s", err.Error()))
+		}
+		return
+	}
+
+	backend, ok := upgradedBody(httpRes.Body)
+	if !ok {
+		pc.reportErr(r.Context(), fmt.Errorf("upstream connection is not writable after upgrade: %s", trace.uri))
+		pc.writeMessage(w, r, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	conn, brw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		pc.reportErr(r.Context(), fmt.Errorf("error hijacking client connection: %s", err.Error()))
+		pc.writeMessage(w, r, http.StatusInternalServerError, "internal error")
+		return
+	}
+	defer conn.Close()
+
+	/* Deadlines of the server are meant for regular requests. Tunnel is governed by idle timeout instead. */
+	conn.SetDeadline(time.Time{})
+
+	header := make(http.Header)
+	copyResponseHeader(header, httpRes.Header)
+	header.Set("Connection", "Upgrade")
+	header.Set("Upgrade", httpRes.Header.Get("Upgrade"))
+
+	fmt.Fprintf(brw, "HTTP/1.1 %d %s\r\n", http.StatusSwitchingProtocols, http.StatusText(http.StatusSwitchingProtocols))
+	header.Write(brw)
+	brw.WriteString("\r\n")
+	err = brw.Flush()
+	if err != nil {
+		pc.reportErr(r.Context(), fmt.Errorf("error writing upgrade response for client: %s", err.Error()))
+		return
+	}
+	trace.writer.status = http.StatusSwitchingProtocols
+	pc.emit(r.Context(), ProxyPhaseUpgraded, nil)
+
+	/* Client may have sent bytes right after the request, so it is read through the buffered reader. */
+	sent, received, err := pc.tunnel(conn, brw, backend)
+	trace.requestBytes = sent
+	trace.writer.written = received
+	if err != nil {
+		pc.reportErr(r.Context(), fmt.Errorf("tunnel error: %s: %s", trace.uri, err.Error()))
+	}
+}
+
+// tunnel copies bytes between client and upstream until either side closes or idle timeout passes.
+// It returns number of bytes sent to upstream and received from upstream.
+func (pc *ProxyClient) tunnel(conn net.Conn, client io.Reader, backend io.ReadWriteCloser) (int64, int64, error) {
+	once := &sync.Once{}
+	closeAll := func() {
+		once.Do(func() {
+			conn.Close()
+			backend.Close()
+		})
+	}
+
+	timeout := pc.upgradeIdleTimeout
+	timedOut := &atomic.Bool{}
+	var idle *time.Timer
+	if timeout > 0 {
+		idle = time.AfterFunc(timeout, func() {
+			timedOut.Store(true)
+			closeAll()
+		})
+		defer idle.Stop()
+	}
+	touch := func() {
+		if idle != nil {
+			idle.Reset(timeout)
+		}
+	}
+
+	var sent, received int64
+	errs := make(chan error, 2)
+	go func() {
+		errs <- copyTunnel(backend, client, &sent, touch)
+	}()
+	go func() {
+		errs <- copyTunnel(conn, backend, &received, touch)
+	}()
+
+	/* Either side finishing ends the tunnel. Error of the other side is caused by closing it. */
+	err := <-errs
+	closeAll()
+	<-errs
+
+	if timedOut.Load() {
+		return sent, received, errors.New("idle timeout exceeded")
+	}
+	return sent, received, err
+}
+
+// copyTunnel copies src to dst, counting written bytes and calling touch upon each read.
+// Reaching end of src is not an error.
+func copyTunnel(dst io.Writer, src io.Reader, written *int64, touch func()) error {
+	buf := make([]byte, 32*1024)
+	for {
+		n, readErr := src.Read(buf)
+		if n > 0 {
+			touch()
+			w, err := dst.Write(buf[:n])
+			*written += int64(w)
+			if err != nil {
+				return err
+			}
+		}
+		if readErr == io.EOF {
+			return nil
+		}
+		if readErr != nil {
+			return readErr
+		}
+	}
+}
+
+// upgradedBody returns writable connection of a 101 response body. In-flight tracking wrapper of upstream pool is skipped,
+// closing input body still releases it.
+func upgradedBody(body io.ReadCloser) (io.ReadWriteCloser, bool) {
+	inFlight, ok := body.(*inFlightBody)
+	if ok {
+		body = inFlight.ReadCloser
+	}
+	rwc, ok := body.(io.ReadWriteCloser)
+	return rwc, ok
+}
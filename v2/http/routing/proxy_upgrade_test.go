@@ -0,0 +1,173 @@
+package gmrouting
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	gmhttp "github.com/onuryurdupak/gomod/v2/http"
+	"github.com/stretchr/testify/assert"
+)
+
+// newEchoUpgradeServer switches to `echo` protocol and echoes everything back until client closes.
+func newEchoUpgradeServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") != "echo" || !strings.EqualFold(r.Header.Get("Connection"), "upgrade") {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("upgrade required"))
+			return
+		}
+
+		conn, brw, err := http.NewResponseController(w).Hijack()
+		assert.NoError(t, err)
+		defer conn.Close()
+
+		brw.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: echo\r\nX-Upstream: yes\r\n\r\n")
+		brw.Flush()
+		io.Copy(conn, brw)
+	}))
+}
+
+// dialUpgrade sends an upgrade request for input path to server and returns the connection along with the response.
+func dialUpgrade(t *testing.T, server *httptest.Server, path, protocol string) (net.Conn, *bufio.Reader, *http.Response) {
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	assert.NoError(t, err)
+
+	_, err = conn.Write([]byte("GET " + path + " HTTP/1.1\r\nHost: example.com\r\nConnection: Upgrade\r\nUpgrade: " + protocol + "\r\n\r\n"))
+	assert.NoError(t, err)
+
+	reader := bufio.NewReader(conn)
+	res, err := http.ReadResponse(reader, nil)
+	assert.NoError(t, err)
+	return conn, reader, res
+}
+
+func Test_Proxy_Upgrade_Tunnel(t *testing.T) {
+	upstream := newEchoUpgradeServer(t)
+	defer upstream.Close()
+
+	table, err := NewProxyRouteTable([]*ProxyRouteRule{NewProxyRouteRule(`GET`, `/ws`)})
+	assert.NoError(t, err)
+
+	mutex := &sync.Mutex{}
+	events := make([]ProxyEvent, 0)
+	completed := make(chan struct{}, 2)
+
+	pc := NewProxyClient(table, upstream.URL, upstream.Client(), gmhttp.NewResponseWriter(), nil, nil, nil, nil)
+	pc.SetObserver(ProxyObserverFunc(func(ctx context.Context, event ProxyEvent) {
+		mutex.Lock()
+		events = append(events, event)
+		mutex.Unlock()
+		if event.Phase == ProxyPhaseCompleted {
+			completed <- struct{}{}
+		}
+	}))
+
+	proxy := httptest.NewServer(http.HandlerFunc(pc.HandleRequestAndRedirect))
+	defer proxy.Close()
+
+	conn, reader, res := dialUpgrade(t, proxy, `/ws`, `echo`)
+	assert.Equal(t, http.StatusSwitchingProtocols, res.StatusCode)
+	assert.Equal(t, "echo", res.Header.Get("Upgrade"))
+	assert.Equal(t, "yes", res.Header.Get("X-Upstream"))
+
+	_, err = conn.Write([]byte("hello"))
+	assert.NoError(t, err)
+	echoed := make([]byte, 5)
+	_, err = io.ReadFull(reader, echoed)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", string(echoed))
+
+	_, err = conn.Write([]byte("world!"))
+	assert.NoError(t, err)
+	echoed = make([]byte, 6)
+	_, err = io.ReadFull(reader, echoed)
+	assert.NoError(t, err)
+	assert.Equal(t, "world!", string(echoed))
+
+	conn.Close()
+	<-completed
+
+	mutex.Lock()
+	last := events[len(events)-1]
+	phases := make([]ProxyPhase, 0)
+	for _, e := range events {
+		phases = append(phases, e.Phase)
+	}
+	mutex.Unlock()
+
+	assert.Equal(t, []ProxyPhase{ProxyPhaseUpstreamResponse, ProxyPhaseUpgraded, ProxyPhaseCompleted}, phases)
+	assert.Equal(t, http.StatusSwitchingProtocols, last.StatusCode)
+	assert.Equal(t, int64(11), last.RequestBytes)
+	assert.Equal(t, int64(11), last.ResponseBytes)
+	assert.NoError(t, last.Err)
+
+	/* Allow-list applies to upgrade requests as well. */
+	conn, _, res = dialUpgrade(t, proxy, `/other`, `echo`)
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	conn.Close()
+	<-completed
+
+	/* Declined upgrade is passed along as a regular response. */
+	conn, reader, res = dialUpgrade(t, proxy, `/ws`, `h2c`)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	body, err := io.ReadAll(io.LimitReader(res.Body, 16))
+	assert.NoError(t, err)
+	assert.Equal(t, "upgrade required", string(body))
+	conn.Close()
+}
+
+func Test_Proxy_Upgrade_Idle_Timeout(t *testing.T) {
+	upstream := newEchoUpgradeServer(t)
+	defer upstream.Close()
+
+	table, err := NewProxyRouteTable([]*ProxyRouteRule{NewProxyRouteRule(`GET`, `/ws`)})
+	assert.NoError(t, err)
+
+	errs := make(chan error, 1)
+	pc := NewProxyClient(table, upstream.URL, upstream.Client(), gmhttp.NewResponseWriter(), nil,
+		func(ctx context.Context, err error) { errs <- err }, nil, nil)
+	pc.SetUpgradeIdleTimeout(50 * time.Millisecond)
+
+	proxy := httptest.NewServer(http.HandlerFunc(pc.HandleRequestAndRedirect))
+	defer proxy.Close()
+
+	conn, reader, res := dialUpgrade(t, proxy, `/ws`, `echo`)
+	defer conn.Close()
+	assert.Equal(t, http.StatusSwitchingProtocols, res.StatusCode)
+
+	/* Tunnel is closed by proxy once it stays idle. */
+	_, err = reader.ReadByte()
+	assert.Equal(t, io.EOF, err)
+
+	select {
+	case err = <-errs:
+		assert.Contains(t, err.Error(), "idle timeout exceeded")
+	case <-time.After(time.Second):
+		assert.Fail(t, "idle timeout is not reported")
+	}
+}
+
+func Test_Proxy_Upgrade_Without_Hijacker(t *testing.T) {
+	upstream := newEchoUpgradeServer(t)
+	defer upstream.Close()
+
+	table, err := NewProxyRouteTable([]*ProxyRouteRule{NewProxyRouteRule(`GET`, `/ws`)})
+	assert.NoError(t, err)
+
+	pc := NewProxyClient(table, upstream.URL, upstream.Client(), gmhttp.NewResponseWriter(), nil, nil, nil, nil)
+
+	req := httptest.NewRequest(`GET`, `/ws`, nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "echo")
+	rec := httptest.NewRecorder()
+	pc.HandleRequestAndRedirect(rec, req)
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+}
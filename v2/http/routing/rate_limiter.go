@@ -0,0 +1,310 @@
+package gmrouting
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type RateLimitAlgorithm int
+
+const (
+	// TokenBucket refills tokens continuously and lets short bursts up to bucket capacity through.
+	TokenBucket RateLimitAlgorithm = iota
+	// SlidingWindow approximates the number of requests in the last window by weighting the previous fixed window.
+	SlidingWindow
+)
+
+// RateLimit defines the allowed request rate for a single key.
+type RateLimit struct {
+	// Requests allowed per Window.
+	Requests int
+	Window   time.Duration
+	// Burst is the bucket capacity for TokenBucket algorithm. Requests is used if left 0.
+	// It is ignored by SlidingWindow algorithm.
+	Burst int
+}
+
+func (l *RateLimit) validate() error {
+	if l.Requests < 1 || l.Window <= 0 || l.Burst < 0 {
+		return fmt.Errorf("invalid rate limit: %d requests per %s (burst: %d)", l.Requests, l.Window, l.Burst)
+	}
+	return nil
+}
+
+// RateLimitDecision is the result of a rate limit check.
+type RateLimitDecision struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is the duration until the quota is fully restored.
+	Reset time.Duration
+	// RetryAfter is the duration until the next request will be allowed. It is 0 for allowed requests.
+	RetryAfter time.Duration
+}
+
+type rateLimitState struct {
+	limit RateLimit
+
+	// Token bucket fields.
+	tokens     float64
+	lastRefill time.Time
+	// Sliding window fields.
+	windowStart   time.Time
+	currentCount  int
+	previousCount int
+
+	lastSeen time.Time
+}
+
+// rateLimitSweepInterval is the minimum duration between two removals of idle keys.
+const rateLimitSweepInterval = time.Minute
+
+// RateLimiter limits request rate per key. Keys are scoped per rule for rules which have their own limit.
+//
+// It can be registered to ProxyClient via SetRateLimiter, or used with Router matches via AllowMatch.
+type RateLimiter struct {
+	algorithm      RateLimitAlgorithm
+	keyFunc        RequestKeyFunc
+	defaultLimit   *RateLimit
+	responseWriter responseWriter
+
+	mutex     *sync.Mutex
+	states    map[string]*rateLimitState
+	lastSweep time.Time
+	// now returns current time. It is replaced by tests.
+	now func() time.Time
+}
+
+// NewRateLimiter creates a rate limiter.
+//
+// keyFunc decides which requests share the same quota. Requests for which keyFunc returns an empty value
+// are keyed by client IP. ClientIPKey is used if keyFunc is nil.
+//
+// defaultLimit applies to rules without their own limit and is shared among all of them.
+// Requests are not limited for such rules if defaultLimit is nil.
+func NewRateLimiter(algorithm RateLimitAlgorithm, keyFunc RequestKeyFunc, defaultLimit *RateLimit, responseWriter responseWriter) (*RateLimiter, error) {
+	if algorithm != TokenBucket && algorithm != SlidingWindow {
+		return nil, fmt.Errorf("unknown rate limit algorithm: %d", algorithm)
+	}
+	if defaultLimit != nil {
+		err := defaultLimit.validate()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if keyFunc == nil {
+		keyFunc = ClientIPKey()
+	}
+	return &RateLimiter{
+		algorithm:      algorithm,
+		keyFunc:        keyFunc,
+		defaultLimit:   defaultLimit,
+		responseWriter: responseWriter,
+		mutex:          &sync.Mutex{},
+		states:         make(map[string]*rateLimitState),
+		lastSweep:      time.Now(),
+		now:            time.Now,
+	}, nil
+}
+
+// AllowMatch checks input request which is matched by Router.
+// RouteRule.RateLimit of the match is used if set, default limit otherwise. (match can be nil.)
+//
+// If request is not allowed, it writes a 429 JSON response and returns false.
+// Rate limit headers are written in both cases.
+func (rl *RateLimiter) AllowMatch(w http.ResponseWriter, r *http.Request, match *RouteMatch) bool {
+	scope := ""
+	limit := rl.defaultLimit
+	var routeParams map[string]string
+	if match != nil {
+		routeParams = match.RouteParams
+		if match.Rule.RateLimit != nil {
+			scope = match.Rule.Method + " " + match.Rule.Path
+			limit = match.Rule.RateLimit
+		}
+	}
+
+	if limit == nil {
+		return true
+	}
+
+	decision := rl.Allow(scope+"|"+rl.requestKey(r, routeParams), *limit)
+	writeRateLimitHeaders(w, decision)
+	if decision.Allowed {
+		return true
+	}
+
+	rl.responseWriter.WriteCustomJsonResponse(w, http.StatusTooManyRequests, map[string]interface{}{
+		"message": "too many requests",
+	})
+	return false
+}
+
+// Allow consumes quota of input key. Each key must always be used with the same limit.
+func (rl *RateLimiter) Allow(key string, limit RateLimit) RateLimitDecision {
+	now := rl.now()
+
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+
+	rl.sweep(now)
+
+	state := rl.states[key]
+	if state == nil {
+		state = &rateLimitState{
+			limit:       limit,
+			tokens:      float64(burstOf(limit)),
+			lastRefill:  now,
+			windowStart: now,
+		}
+		rl.states[key] = state
+	}
+	state.lastSeen = now
+
+	if rl.algorithm == SlidingWindow {
+		return state.allowSlidingWindow(limit, now)
+	}
+	return state.allowTokenBucket(limit, now)
+}
+
+// checkProxy is the ProxyClient counterpart of AllowMatch. It leaves writing of the 429 response to proxy client.
+func (rl *RateLimiter) checkProxy(w http.ResponseWriter, r *http.Request, rule *ProxyRouteRule, routeParams map[string]string) bool {
+	scope := ""
+	limit := rl.defaultLimit
+	if rule.rateLimit != nil {
+		scope = rule.method + " " + rule.path
+		limit = rule.rateLimit
+	}
+
+	if limit == nil {
+		return true
+	}
+
+	decision := rl.Allow(scope+"|"+rl.requestKey(r, routeParams), *limit)
+	writeRateLimitHeaders(w, decision)
+	return decision.Allowed
+}
+
+func (rl *RateLimiter) requestKey(r *http.Request, routeParams map[string]string) string {
+	key := rl.keyFunc(r, routeParams)
+	if key == "" {
+		return remoteIP(r)
+	}
+	return key
+}
+
+// sweep removes keys which have been idle long enough to be back at full quota.
+// Must be called while holding the mutex.
+func (rl *RateLimiter) sweep(now time.Time) {
+	if now.Sub(rl.lastSweep) < rateLimitSweepInterval {
+		return
+	}
+	rl.lastSweep = now
+
+	for k, v := range rl.states {
+		if now.Sub(v.lastSeen) > v.idleTimeout() {
+			delete(rl.states, k)
+		}
+	}
+}
+
+// idleTimeout returns the idle duration after which the state is back at full quota and can be dropped.
+func (s *rateLimitState) idleTimeout() time.Duration {
+	window := s.limit.Window
+	if burstOf(s.limit) > s.limit.Requests {
+		window = window * time.Duration(burstOf(s.limit)) / time.Duration(s.limit.Requests)
+	}
+	return 2 * window
+}
+
+func (s *rateLimitState) allowTokenBucket(limit RateLimit, now time.Time) RateLimitDecision {
+	burst := burstOf(limit)
+	ratePerSecond := float64(limit.Requests) / limit.Window.Seconds()
+
+	s.tokens = math.Min(float64(burst), s.tokens+now.Sub(s.lastRefill).Seconds()*ratePerSecond)
+	s.lastRefill = now
+
+	decision := RateLimitDecision{
+		Limit: burst,
+	}
+
+	if s.tokens >= 1 {
+		s.tokens--
+		decision.Allowed = true
+	} else {
+		decision.RetryAfter = secondsToDuration((1 - s.tokens) / ratePerSecond)
+	}
+
+	decision.Remaining = int(s.tokens)
+	decision.Reset = secondsToDuration((float64(burst) - s.tokens) / ratePerSecond)
+	return decision
+}
+
+func (s *rateLimitState) allowSlidingWindow(limit RateLimit, now time.Time) RateLimitDecision {
+	elapsed := now.Sub(s.windowStart)
+	if elapsed >= limit.Window {
+		windowsPassed := int(elapsed / limit.Window)
+		if windowsPassed == 1 {
+			s.previousCount = s.currentCount
+		} else {
+			s.previousCount = 0
+		}
+		s.currentCount = 0
+		s.windowStart = s.windowStart.Add(time.Duration(windowsPassed) * limit.Window)
+		elapsed = now.Sub(s.windowStart)
+	}
+
+	previousWeight := 1 - float64(elapsed)/float64(limit.Window)
+	estimated := float64(s.previousCount)*previousWeight + float64(s.currentCount)
+
+	decision := RateLimitDecision{
+		Limit: limit.Requests,
+		Reset: limit.Window - elapsed,
+	}
+
+	if estimated+1 <= float64(limit.Requests) {
+		s.currentCount++
+		estimated++
+		decision.Allowed = true
+	} else if s.previousCount > 0 {
+		/* Previous window weight must drop enough to make room for one more request. */
+		excess := estimated + 1 - float64(limit.Requests)
+		wait := time.Duration(excess / float64(s.previousCount) * float64(limit.Window))
+		decision.RetryAfter = min(wait, limit.Window-elapsed)
+	} else {
+		decision.RetryAfter = limit.Window - elapsed
+	}
+
+	decision.Remaining = max(0, limit.Requests-int(math.Ceil(estimated)))
+	return decision
+}
+
+func burstOf(limit RateLimit) int {
+	if limit.Burst > 0 {
+		return limit.Burst
+	}
+	return limit.Requests
+}
+
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// writeRateLimitHeaders writes RateLimit-* headers and Retry-After header for rejected requests.
+// Durations are rounded up to whole seconds.
+func writeRateLimitHeaders(w http.ResponseWriter, decision RateLimitDecision) {
+	w.Header().Set("RateLimit-Limit", strconv.Itoa(decision.Limit))
+	w.Header().Set("RateLimit-Remaining", strconv.Itoa(decision.Remaining))
+	w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(decision.Reset)))
+	if !decision.Allowed {
+		w.Header().Set("Retry-After", strconv.Itoa(max(1, ceilSeconds(decision.RetryAfter))))
+	}
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
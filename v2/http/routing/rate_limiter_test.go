@@ -0,0 +1,123 @@
+package gmrouting
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	gmhttp "github.com/onuryurdupak/gomod/v2/http"
+	"github.com/stretchr/testify/assert"
+)
+
+// testClock is a manually advanced clock for components which read time via a now func.
+type testClock struct {
+	mutex *sync.Mutex
+	now   time.Time
+}
+
+func newTestClock() *testClock {
+	return &testClock{
+		mutex: &sync.Mutex{},
+		now:   time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC),
+	}
+}
+
+func (c *testClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.now
+}
+
+func (c *testClock) Advance(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.now = c.now.Add(d)
+}
+
+func Test_Token_Bucket(t *testing.T) {
+	rl, err := NewRateLimiter(TokenBucket, nil, nil, gmhttp.NewResponseWriter())
+	assert.NoError(t, err)
+	clock := newTestClock()
+	rl.now = clock.Now
+
+	limit := RateLimit{Requests: 10, Window: time.Second, Burst: 3}
+	for i := 0; i < 3; i++ {
+		decision := rl.Allow("key", limit)
+		assert.True(t, decision.Allowed)
+		assert.Equal(t, 2-i, decision.Remaining)
+	}
+
+	decision := rl.Allow("key", limit)
+	assert.False(t, decision.Allowed)
+	assert.Equal(t, 100*time.Millisecond, decision.RetryAfter)
+
+	clock.Advance(99 * time.Millisecond)
+	assert.False(t, rl.Allow("key", limit).Allowed)
+	clock.Advance(time.Millisecond)
+	assert.True(t, rl.Allow("key", limit).Allowed)
+	assert.True(t, rl.Allow("other", limit).Allowed)
+}
+
+func Test_Sliding_Window(t *testing.T) {
+	rl, err := NewRateLimiter(SlidingWindow, nil, nil, gmhttp.NewResponseWriter())
+	assert.NoError(t, err)
+	clock := newTestClock()
+	rl.now = clock.Now
+
+	limit := RateLimit{Requests: 2, Window: 50 * time.Millisecond}
+	assert.True(t, rl.Allow("key", limit).Allowed)
+	assert.True(t, rl.Allow("key", limit).Allowed)
+	decision := rl.Allow("key", limit)
+	assert.False(t, decision.Allowed)
+	assert.Equal(t, 0, decision.Remaining)
+
+	// Right after the window rolls over, previous window still weighs in.
+	clock.Advance(55 * time.Millisecond)
+	assert.False(t, rl.Allow("key", limit).Allowed)
+
+	clock.Advance(100 * time.Millisecond)
+	assert.True(t, rl.Allow("key", limit).Allowed)
+}
+
+func Test_Rate_Limiter_Router_Match(t *testing.T) {
+	routeRules := []*RouteRule{
+		{Method: `GET`, Path: `/api/accounts`, DynamicPath: false},
+		{Method: `GET`, Path: `/api/transfers/{id}`, DynamicPath: true, RateLimit: &RateLimit{Requests: 1, Window: time.Minute}},
+	}
+	router, err := NewRouter(routeRules)
+	assert.NoError(t, err)
+
+	rl, err := NewRateLimiter(TokenBucket, HeaderKey("X-Api-Key"), &RateLimit{Requests: 2, Window: time.Minute}, gmhttp.NewResponseWriter())
+	assert.NoError(t, err)
+
+	check := func(path, apiKey string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("X-Api-Key", apiKey)
+		rec := httptest.NewRecorder()
+		rl.AllowMatch(rec, req, router.FindMatch(req))
+		return rec
+	}
+
+	assert.Equal(t, http.StatusOK, check(`/api/transfers/1`, "a").Code)
+	rec := check(`/api/transfers/2`, "a")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "1", rec.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "0", rec.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "60", rec.Header().Get("Retry-After"))
+	assert.JSONEq(t, `{"message":"too many requests"}`, rec.Body.String())
+
+	// Rule limit and default limit keep separate quotas.
+	assert.Equal(t, http.StatusOK, check(`/api/accounts`, "a").Code)
+	assert.Equal(t, http.StatusOK, check(`/api/accounts`, "a").Code)
+	assert.Equal(t, http.StatusTooManyRequests, check(`/api/accounts`, "a").Code)
+	assert.Equal(t, http.StatusOK, check(`/api/accounts`, "b").Code)
+
+	_, err = NewRouter([]*RouteRule{
+		{Method: `GET`, Path: `/api/accounts`, RateLimit: &RateLimit{Requests: 0, Window: time.Minute}},
+	})
+	assert.Error(t, err)
+}
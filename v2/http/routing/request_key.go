@@ -0,0 +1,44 @@
+package gmrouting
+
+import (
+	"net"
+	"net/http"
+)
+
+// RequestKeyFunc extracts a value from the request which is used for grouping requests.
+// E.g: Consistent hash balancing and rate limiting.
+//
+// routeParams contains route parameters extracted from the matching rule.
+type RequestKeyFunc func(r *http.Request, routeParams map[string]string) string
+
+// HeaderKey returns a RequestKeyFunc which reads input header value of the request.
+func HeaderKey(header string) RequestKeyFunc {
+	return func(r *http.Request, routeParams map[string]string) string {
+		return r.Header.Get(header)
+	}
+}
+
+// RouteParamKey returns a RequestKeyFunc which reads input route parameter of the matching rule.
+//
+// E.g: RouteParamKey("guid") for rule path: /Transfer/{guid}
+func RouteParamKey(name string) RequestKeyFunc {
+	return func(r *http.Request, routeParams map[string]string) string {
+		return routeParams[name]
+	}
+}
+
+// ClientIPKey returns a RequestKeyFunc which reads IP address of the connected client.
+func ClientIPKey() RequestKeyFunc {
+	return func(r *http.Request, routeParams map[string]string) string {
+		return remoteIP(r)
+	}
+}
+
+// remoteIP returns host part of the request remote address.
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,493 @@
+package gmrouting
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type CacheStatus string
+
+const (
+	// CacheHit means response is served from cache without contacting upstream.
+	CacheHit CacheStatus = "hit"
+	// CacheRevalidated means a stale response is confirmed by upstream via 304 and served from cache.
+	CacheRevalidated CacheStatus = "revalidated"
+	// CacheMiss means response is received from upstream. It is stored if it is cacheable.
+	CacheMiss CacheStatus = "miss"
+	// CacheBypass means request is not allowed to use cache. E.g: Cache-Control: no-store
+	CacheBypass CacheStatus = "bypass"
+)
+
+// cacheableStatusCodes are heuristically cacheable status codes. (RFC 9110 15.1)
+var cacheableStatusCodes = map[int]bool{
+	http.StatusOK:                   true,
+	http.StatusNonAuthoritativeInfo: true,
+	http.StatusNoContent:            true,
+	http.StatusMultipleChoices:      true,
+	http.StatusMovedPermanently:     true,
+	http.StatusPermanentRedirect:    true,
+	http.StatusNotFound:             true,
+	http.StatusMethodNotAllowed:     true,
+	http.StatusGone:                 true,
+	http.StatusRequestURITooLong:    true,
+	http.StatusNotImplemented:       true,
+}
+
+// ResponseCache stores cacheable upstream responses of GET requests as a shared cache. (RFC 9111)
+//
+// Freshness is taken from Cache-Control (s-maxage, max-age) or Expires headers of the response,
+// unless matching ProxyRouteRule has a cache TTL. Stale responses which have ETag or Last-Modified
+// are revalidated with a conditional request. Responses with Vary are stored per variant.
+//
+// Responses with no-store, private, Set-Cookie or Vary: * are never stored,
+// neither are responses to requests with Authorization unless response explicitly allows it.
+type ResponseCache struct {
+	store        CacheStore
+	maxBodyBytes int64
+	// now returns current time. It is replaced by tests.
+	now func() time.Time
+}
+
+// NewResponseCache creates a cache to be registered via ProxyClient.SetResponseCache.
+//
+// store: Keeps the responses. See NewMemoryCacheStore and NewDiskCacheStore.
+//
+// maxBodyBytes: Responses with larger bodies are not stored. Defaults to 1 MiB if not positive.
+func NewResponseCache(store CacheStore, maxBodyBytes int64) *ResponseCache {
+	if maxBodyBytes <= 0 {
+		maxBodyBytes = 1 << 20
+	}
+	return &ResponseCache{
+		store:        store,
+		maxBodyBytes: maxBodyBytes,
+		now:          time.Now,
+	}
+}
+
+// Purge removes all stored responses of input path regardless of their query, host and variant.
+// It returns the number of removed entries.
+//
+// E.g: Purge("/api/accounts") removes responses of /api/accounts and /api/accounts?page=2
+func (c *ResponseCache) Purge(path string) int {
+	return c.store.DeleteFunc(func(key string) bool {
+		fields := strings.SplitN(key, "\n", 4)
+		return len(fields) >= 3 && strings.Split(fields[2], "?")[0] == path
+	})
+}
+
+// PurgeAll removes all stored responses and returns the number of removed entries.
+func (c *ResponseCache) PurgeAll() int {
+	return c.store.DeleteFunc(func(key string) bool {
+		return true
+	})
+}
+
+// SetResponseCache makes proxy client serve GET requests from cache when possible and store cacheable responses.
+//
+// Cache status of each request is reported via cache phase of ProxyEvent. ProxyRouteRule.SetCacheTTL can be used
+// for overriding freshness of rule responses, or excluding a rule from caching.
+//
+// Responses served from cache are also delivered to onResRead hook.
+func (pc *ProxyClient) SetResponseCache(cache *ResponseCache) {
+	pc.responseCache = cache
+}
+
+// SetCacheTTL overrides freshness lifetime of cacheable responses of the rule which is sent by upstream.
+// Negative ttl excludes the rule from response cache. Zero means upstream decides, which is the default.
+//
+// Must be called before the rule is passed to NewProxyRouteTable.
+func (rr *ProxyRouteRule) SetCacheTTL(ttl time.Duration) {
+	rr.cacheTTL = ttl
+}
+
+func (rr *ProxyRouteRule) CacheTTL() time.Duration {
+	return rr.cacheTTL
+}
+
+// cacheKey returns primary key of r. Key fields are separated by new lines, which can not occur in any of them.
+func cacheKey(r *http.Request) string {
+	return http.MethodGet + "\n" + r.Host + "\n" + r.URL.RequestURI()
+}
+
+// variantKey returns key of the variant of primary key which matches request header for input header names.
+func variantKey(primary string, vary []string, header http.Header) string {
+	values := make([]string, 0, len(vary))
+	for _, name := range vary {
+		values = append(values, name+"="+strings.Join(header.Values(name), ","))
+	}
+	return primary + "\n" + strings.Join(values, "&")
+}
+
+// lookup returns the key which response of r is stored under, along with the stored response if any.
+func (c *ResponseCache) lookup(r *http.Request) (string, *CachedResponse) {
+	key := cacheKey(r)
+	res, ok := c.store.Get(key)
+	if !ok {
+		return key, nil
+	}
+	if res.StatusCode != 0 {
+		return key, res
+	}
+
+	key = variantKey(key, res.Vary, r.Header)
+	res, ok = c.store.Get(key)
+	if !ok {
+		return key, nil
+	}
+	return key, res
+}
+
+// save keeps input response of r if it is cacheable. Body must be the complete response body.
+func (c *ResponseCache) save(r *http.Request, statusCode int, header http.Header, body []byte, ttl time.Duration) {
+	if !isStorable(r, statusCode, header) {
+		return
+	}
+
+	now := c.now()
+	lifetime, ok := freshnessLifetime(header, ttl, now)
+	if !ok {
+		return
+	}
+
+	res := &CachedResponse{
+		StatusCode: statusCode,
+		Header:     header.Clone(),
+		Body:       body,
+		StoredAt:   now,
+		ExpiresAt:  now.Add(lifetime),
+	}
+
+	key := cacheKey(r)
+	vary := varyNames(header)
+	if len(vary) > 0 {
+		c.store.Set(key, &CachedResponse{Vary: vary, StoredAt: now})
+		key = variantKey(key, vary, r.Header)
+	}
+	c.store.Set(key, res)
+}
+
+// revalidated stores stale response again with header fields of input 304 response and returns it.
+func (c *ResponseCache) revalidated(key string, stale *CachedResponse, notModified http.Header, ttl time.Duration) *CachedResponse {
+	header := stale.Header.Clone()
+	for k, v := range notModified {
+		if isHopByHop(k) || k == "Content-Length" {
+			continue
+		}
+		header[k] = v
+	}
+
+	now := c.now()
+	lifetime, ok := freshnessLifetime(header, ttl, now)
+	if !ok {
+		lifetime = 0
+	}
+
+	res := &CachedResponse{
+		StatusCode: stale.StatusCode,
+		Header:     header,
+		Body:       stale.Body,
+		StoredAt:   now,
+		ExpiresAt:  now.Add(lifetime),
+	}
+	c.store.Set(key, res)
+	return res
+}
+
+// bypassesCache returns true if r must neither be served from cache nor update it.
+func bypassesCache(r *http.Request) bool {
+	_, noStore := parseCacheControl(r.Header)["no-store"]
+	return noStore || r.ContentLength != 0
+}
+
+// requiresRevalidation returns true if r does not accept a stored response without asking upstream.
+func requiresRevalidation(r *http.Request) bool {
+	directives := parseCacheControl(r.Header)
+	_, noCache := directives["no-cache"]
+	return noCache || directives["max-age"] == "0" || headerContainsToken(r.Header, "Pragma", "no-cache")
+}
+
+func isStorable(r *http.Request, statusCode int, header http.Header) bool {
+	if !cacheableStatusCodes[statusCode] || header.Get("Set-Cookie") != "" || isEventStream(header) {
+		return false
+	}
+
+	directives := parseCacheControl(header)
+	_, noStore := directives["no-store"]
+	_, private := directives["private"]
+	if noStore || private {
+		return false
+	}
+
+	for _, name := range varyNames(header) {
+		if name == "*" {
+			return false
+		}
+	}
+
+	/* Shared caches store responses to authorized requests only if response explicitly allows it. (RFC 9111 3.5) */
+	if r.Header.Get("Authorization") != "" {
+		_, public := directives["public"]
+		_, sMaxAge := directives["s-maxage"]
+		_, mustRevalidate := directives["must-revalidate"]
+		if !public && !sMaxAge && !mustRevalidate {
+			return false
+		}
+	}
+	return true
+}
+
+// freshnessLifetime returns how long a response with input header stays fresh.
+// It returns false if response has neither a lifetime nor a validator, in which case it is not worth storing.
+func freshnessLifetime(header http.Header, ttl time.Duration, now time.Time) (time.Duration, bool) {
+	hasValidator := header.Get("ETag") != "" || header.Get("Last-Modified") != ""
+	directives := parseCacheControl(header)
+
+	if _, noCache := directives["no-cache"]; noCache {
+		return 0, hasValidator
+	}
+	if ttl > 0 {
+		return ttl, true
+	}
+
+	for _, d := range []string{"s-maxage", "max-age"} {
+		value, ok := directives[d]
+		if !ok {
+			continue
+		}
+		seconds, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || seconds < 0 {
+			return 0, hasValidator
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	expires := header.Get("Expires")
+	if expires != "" {
+		expiresAt, err := http.ParseTime(expires)
+		if err != nil {
+			return 0, hasValidator
+		}
+		date, err := http.ParseTime(header.Get("Date"))
+		if err != nil {
+			date = now
+		}
+		return max(expiresAt.Sub(date), 0), true
+	}
+
+	return 0, hasValidator
+}
+
+// parseCacheControl returns directives of Cache-Control header with lower case names. Directives without value map to empty string.
+func parseCacheControl(header http.Header) map[string]string {
+	result := make(map[string]string)
+	for _, v := range header.Values("Cache-Control") {
+		for _, d := range strings.Split(v, ",") {
+			name, value, _ := strings.Cut(strings.TrimSpace(d), "=")
+			if name == "" {
+				continue
+			}
+			result[strings.ToLower(name)] = strings.Trim(value, `"`)
+		}
+	}
+	return result
+}
+
+// varyNames returns sorted canonical header names listed in Vary header.
+func varyNames(header http.Header) []string {
+	result := make([]string, 0)
+	for _, v := range header.Values("Vary") {
+		for _, name := range strings.Split(v, ",") {
+			name = strings.TrimSpace(name)
+			if name != "" {
+				result = append(result, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// serveFromCache looks up response of the call in cache. It returns true if a fresh response is served to client.
+// Otherwise call is marked for redirectCached, unless request bypasses cache.
+func (pc *ProxyClient) serveFromCache(w http.ResponseWriter, r *http.Request, call *proxyCall) bool {
+	if bypassesCache(r) {
+		call.trace.cacheStatus = CacheBypass
+		pc.emit(r.Context(), ProxyPhaseCache, nil)
+		return false
+	}
+
+	call.useCache = true
+	call.cacheKey, call.cached = pc.responseCache.lookup(r)
+	if call.cached == nil {
+		return false
+	}
+
+	if pc.responseCache.now().Before(call.cached.ExpiresAt) && !requiresRevalidation(r) {
+		call.trace.cacheStatus = CacheHit
+		pc.emit(r.Context(), ProxyPhaseCache, nil)
+		pc.serveCached(w, r, call.cached)
+		return true
+	}
+
+	/* Stale response without validators can not be revalidated. It is replaced by the new response. */
+	if call.cached.Header.Get("ETag") == "" && call.cached.Header.Get("Last-Modified") == "" {
+		call.cached = nil
+	}
+	return false
+}
+
+// serveCached writes stored response to client along with its Age.
+func (pc *ProxyClient) serveCached(w http.ResponseWriter, r *http.Request, res *CachedResponse) {
+	pc.writeResponse(w, r, res.StatusCode, pc.responseCache.cachedHeader(res), res.Body)
+}
+
+// cachedHeader returns a copy of stored response header along with its Age.
+func (c *ResponseCache) cachedHeader(res *CachedResponse) http.Header {
+	header := res.Header.Clone()
+	header.Set("Age", strconv.Itoa(int(c.now().Sub(res.StoredAt).Seconds())))
+	return header
+}
+
+// redirectCached sends GET request of the call to upstream, revalidating stale response if it has validators,
+// and stores the response if it is cacheable.
+func (pc *ProxyClient) redirectCached(w http.ResponseWriter, r *http.Request, call *proxyCall) {
+	pc.readEmptyRequest(r)
+
+	fetched, err := pc.fetch(r, call, 0)
+	if err != nil {
+		pc.writeUpstreamErr(w, r, err)
+		return
+	}
+	pc.writeFetched(w, r, fetched)
+}
+
+// readEmptyRequest reports reading the request of a method without body, whose body is not read.
+func (pc *ProxyClient) readEmptyRequest(r *http.Request) {
+	pc.emit(r.Context(), ProxyPhaseRequestRead, nil)
+	if pc.onReqRead != nil {
+		pc.onReqRead(r.Context(), []byte{})
+	}
+}
+
+// fetchedResponse is an upstream response of a request without body.
+type fetchedResponse struct {
+	statusCode int
+	header     http.Header
+	body       []byte
+	// httpRes is set instead of body if body is not read as a whole. E.g: Event streams and bodies exceeding the limit.
+	// Bytes which are already read are put back in front of its body.
+	httpRes     *http.Response
+	cacheStatus CacheStatus
+}
+
+// fetch sends request of the call, which has no body, to upstream. If the call uses cache, stale response is revalidated
+// and cacheable response is stored.
+//
+// Body is read as a whole if it fits into maxBodyBytes, or into the limit of response cache if the response is storable.
+// Caller must close body of httpRes if it is set.
+func (pc *ProxyClient) fetch(r *http.Request, call *proxyCall, maxBodyBytes int64) (*fetchedResponse, error) {
+	ctx := r.Context()
+	cache := pc.responseCache
+
+	stale := call.cached
+	if stale != nil {
+		/* Validators of the client are replaced, since client gets the stored response if upstream confirms it. */
+		call.header = call.header.Clone()
+		call.header.Del("If-None-Match")
+		call.header.Del("If-Modified-Since")
+		if etag := stale.Header.Get("ETag"); etag != "" {
+			call.header.Set("If-None-Match", etag)
+		}
+		if lastModified := stale.Header.Get("Last-Modified"); lastModified != "" {
+			call.header.Set("If-Modified-Since", lastModified)
+		}
+	}
+
+	newBody := func() io.ReadCloser {
+		return http.NoBody
+	}
+	httpRes, err := pc.do(r, call, newBody, true, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if stale != nil && httpRes.StatusCode == http.StatusNotModified {
+		httpRes.Body.Close()
+		call.trace.cacheStatus = CacheRevalidated
+		pc.emit(ctx, ProxyPhaseCache, nil)
+		res := cache.revalidated(call.cacheKey, stale, httpRes.Header, call.rule.cacheTTL)
+		return &fetchedResponse{
+			statusCode:  res.StatusCode,
+			header:      cache.cachedHeader(res),
+			body:        res.Body,
+			cacheStatus: CacheRevalidated,
+		}, nil
+	}
+
+	storable := false
+	if call.useCache {
+		call.trace.cacheStatus = CacheMiss
+		pc.emit(ctx, ProxyPhaseCache, nil)
+		storable = isStorable(r, httpRes.StatusCode, httpRes.Header)
+		if storable {
+			maxBodyBytes = max(maxBodyBytes, cache.maxBodyBytes)
+		}
+	}
+
+	fetched := &fetchedResponse{
+		statusCode:  httpRes.StatusCode,
+		header:      httpRes.Header,
+		cacheStatus: call.trace.cacheStatus,
+	}
+	if maxBodyBytes <= 0 || isEventStream(httpRes.Header) || httpRes.ContentLength > maxBodyBytes {
+		fetched.httpRes = httpRes
+		return fetched, nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(httpRes.Body, maxBodyBytes+1))
+	if err != nil {
+		httpRes.Body.Close()
+		return nil, fmt.Errorf("error reading response payload: %s", err.Error())
+	}
+	if int64(len(body)) > maxBodyBytes {
+		/* Body of unknown length turned out to be too large. Bytes which are already read are passed along first. */
+		httpRes.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), httpRes.Body), httpRes.Body}
+		fetched.httpRes = httpRes
+		return fetched, nil
+	}
+	httpRes.Body.Close()
+
+	if storable && int64(len(body)) <= cache.maxBodyBytes {
+		cache.save(r, httpRes.StatusCode, httpRes.Header, body, call.rule.cacheTTL)
+	}
+	fetched.body = body
+	return fetched, nil
+}
+
+// writeFetched passes fetched response to client. Body of httpRes is closed if it is set.
+func (pc *ProxyClient) writeFetched(w http.ResponseWriter, r *http.Request, fetched *fetchedResponse) {
+	if fetched.httpRes != nil {
+		defer fetched.httpRes.Body.Close()
+		pc.respond(w, r, fetched.httpRes)
+		return
+	}
+	pc.writeResponse(w, r, fetched.statusCode, fetched.header, fetched.body)
+}
+
+// respond passes upstream response to client according to streaming mode.
+func (pc *ProxyClient) respond(w http.ResponseWriter, r *http.Request, httpRes *http.Response) {
+	if pc.streaming {
+		pc.respondStreaming(w, r, httpRes)
+		return
+	}
+	pc.respondBuffered(w, r, httpRes)
+}
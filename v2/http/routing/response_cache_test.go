@@ -0,0 +1,196 @@
+package gmrouting
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	gmhttp "github.com/onuryurdupak/gomod/v2/http"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Proxy_Response_Cache(t *testing.T) {
+	hits := make(map[string]int)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits[r.URL.Path]++
+		switch r.URL.Path {
+		case "/api/accounts":
+			w.Header().Set("Cache-Control", "max-age=60")
+			w.Header().Set("ETag", `"v1"`)
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Write([]byte("accounts"))
+		case "/api/greeting":
+			w.Header().Set("Cache-Control", "public, max-age=60")
+			w.Header().Set("Vary", "Accept-Language")
+			w.Write([]byte("greeting-" + r.Header.Get("Accept-Language")))
+		case "/api/rates":
+			w.Write([]byte("rates"))
+		case "/api/profile":
+			w.Header().Set("Cache-Control", "private, max-age=60")
+			w.Write([]byte("profile"))
+		case "/api/session":
+			w.Header().Set("Cache-Control", "max-age=60")
+			w.Header().Set("Set-Cookie", "id=1")
+			w.Write([]byte("session"))
+		case "/api/live":
+			w.Header().Set("Cache-Control", "max-age=60")
+			w.Write([]byte("live"))
+		}
+	}))
+	defer upstream.Close()
+
+	rates := NewProxyRouteRule(`GET`, `/api/rates`)
+	rates.SetCacheTTL(50 * time.Millisecond)
+	live := NewProxyRouteRule(`GET`, `/api/live`)
+	live.SetCacheTTL(-1)
+
+	table, err := NewProxyRouteTable([]*ProxyRouteRule{
+		NewProxyRouteRule(`GET`, `/api/accounts`),
+		NewProxyRouteRule(`GET`, `/api/greeting`),
+		NewProxyRouteRule(`GET`, `/api/profile`),
+		NewProxyRouteRule(`GET`, `/api/session`),
+		rates,
+		live,
+	})
+	assert.NoError(t, err)
+
+	var lastRes []byte
+	var lastCache CacheStatus
+	pc := NewProxyClient(table, upstream.URL, upstream.Client(), gmhttp.NewResponseWriter(), nil, nil, nil,
+		func(ctx context.Context, b []byte) { lastRes = b })
+	pc.SetObserver(ProxyObserverFunc(func(ctx context.Context, event ProxyEvent) {
+		if event.Phase == ProxyPhaseCompleted {
+			lastCache = event.Cache
+		}
+	}))
+
+	clock := newTestClock()
+	cache := NewResponseCache(NewMemoryCacheStore(1<<20, 0), 0)
+	cache.now = clock.Now
+	pc.SetResponseCache(cache)
+
+	send := func(target string, header map[string]string) *httptest.ResponseRecorder {
+		lastCache = ""
+		req := httptest.NewRequest(`GET`, target, nil)
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		pc.HandleRequestAndRedirect(rec, req)
+		return rec
+	}
+
+	rec := send(`/api/accounts`, nil)
+	assert.Equal(t, "accounts", rec.Body.String())
+	assert.Equal(t, CacheMiss, lastCache)
+
+	lastRes = nil
+	rec = send(`/api/accounts`, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "accounts", rec.Body.String())
+	assert.Equal(t, `"v1"`, rec.Header().Get("ETag"))
+	assert.Equal(t, "0", rec.Header().Get("Age"))
+	assert.Equal(t, CacheHit, lastCache)
+	assert.Equal(t, "accounts", string(lastRes))
+	assert.Equal(t, 1, hits["/api/accounts"])
+
+	clock.Advance(30 * time.Second)
+	rec = send(`/api/accounts`, nil)
+	assert.Equal(t, "30", rec.Header().Get("Age"))
+	assert.Equal(t, CacheHit, lastCache)
+
+	/* Query is a part of the key. */
+	send(`/api/accounts?page=2`, nil)
+	assert.Equal(t, CacheMiss, lastCache)
+	assert.Equal(t, 2, hits["/api/accounts"])
+
+	rec = send(`/api/accounts`, map[string]string{"Cache-Control": "no-cache"})
+	assert.Equal(t, "accounts", rec.Body.String())
+	assert.Equal(t, CacheRevalidated, lastCache)
+	assert.Equal(t, 3, hits["/api/accounts"])
+
+	send(`/api/accounts`, map[string]string{"Cache-Control": "no-store"})
+	assert.Equal(t, CacheBypass, lastCache)
+	assert.Equal(t, 4, hits["/api/accounts"])
+
+	for _, language := range []string{"en", "tr", "en", "tr"} {
+		rec = send(`/api/greeting`, map[string]string{"Accept-Language": language})
+		assert.Equal(t, "greeting-"+language, rec.Body.String())
+	}
+	assert.Equal(t, CacheHit, lastCache)
+	assert.Equal(t, 2, hits["/api/greeting"])
+
+	/* Rule TTL makes a response without freshness information cacheable. */
+	send(`/api/rates`, nil)
+	send(`/api/rates`, nil)
+	assert.Equal(t, CacheHit, lastCache)
+	assert.Equal(t, 1, hits["/api/rates"])
+	clock.Advance(50 * time.Millisecond)
+	send(`/api/rates`, nil)
+	assert.Equal(t, CacheMiss, lastCache)
+	assert.Equal(t, 2, hits["/api/rates"])
+
+	for _, path := range []string{`/api/profile`, `/api/session`} {
+		send(path, nil)
+		send(path, nil)
+		assert.Equal(t, CacheMiss, lastCache, path)
+		assert.Equal(t, 2, hits[path], path)
+	}
+
+	send(`/api/live`, nil)
+	send(`/api/live`, nil)
+	assert.Equal(t, CacheStatus(""), lastCache)
+	assert.Equal(t, 2, hits["/api/live"])
+
+	/* Shared cache does not store responses of authorized requests unless they are public. */
+	cache.PurgeAll()
+	send(`/api/accounts`, map[string]string{"Authorization": "Bearer abc"})
+	send(`/api/accounts`, nil)
+	assert.Equal(t, CacheMiss, lastCache)
+	send(`/api/greeting`, map[string]string{"Authorization": "Bearer abc"})
+	send(`/api/greeting`, nil)
+	assert.Equal(t, CacheHit, lastCache)
+
+	send(`/api/accounts?page=2`, nil)
+	assert.Equal(t, 2, cache.Purge(`/api/accounts`))
+	send(`/api/accounts`, nil)
+	assert.Equal(t, CacheMiss, lastCache)
+}
+
+func Test_Freshness_Lifetime(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	type testData struct {
+		header   map[string]string
+		ttl      time.Duration
+		lifetime time.Duration
+		ok       bool
+	}
+
+	data := []testData{
+		{header: map[string]string{"Cache-Control": "max-age=60"}, lifetime: time.Minute, ok: true},
+		{header: map[string]string{"Cache-Control": "max-age=60, s-maxage=10"}, lifetime: 10 * time.Second, ok: true},
+		{header: map[string]string{"Cache-Control": "max-age=60"}, ttl: time.Hour, lifetime: time.Hour, ok: true},
+		{header: map[string]string{"Cache-Control": "no-cache, max-age=60", "ETag": `"a"`}, ttl: time.Hour, ok: true},
+		{header: map[string]string{"Cache-Control": "no-cache"}},
+		{header: map[string]string{"Date": "Mon, 01 Jan 2024 12:00:00 GMT", "Expires": "Mon, 01 Jan 2024 12:05:00 GMT"}, lifetime: 5 * time.Minute, ok: true},
+		{header: map[string]string{"Expires": "0"}, lifetime: 0},
+		{header: map[string]string{"Last-Modified": "Mon, 01 Jan 2024 11:00:00 GMT"}, ok: true},
+		{header: map[string]string{}},
+	}
+
+	for _, td := range data {
+		header := http.Header{}
+		for k, v := range td.header {
+			header.Set(k, v)
+		}
+		lifetime, ok := freshnessLifetime(header, td.ttl, now)
+		assert.Equal(t, td.ok, ok, td.header)
+		assert.Equal(t, td.lifetime, lifetime, td.header)
+	}
+}
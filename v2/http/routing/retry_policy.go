@@ -0,0 +1,109 @@
+package gmrouting
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// RetryPolicy decides whether a failed upstream request is sent again.
+//
+// Requests are retried upon transport errors and responses with one of the StatusCodes.
+// Requests rejected by an open circuit are not retried on the same upstream.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts including the first one.
+	MaxAttempts int
+	// Methods which are allowed to be retried. Idempotent methods are used if left empty.
+	Methods []string
+	// StatusCodes which cause a retry. E.g: 502, 503, 504
+	StatusCodes []int
+	// BaseBackoff is the wait duration before the first retry. It is doubled for every following retry.
+	BaseBackoff time.Duration
+	// MaxBackoff caps the wait duration between retries.
+	MaxBackoff time.Duration
+	// Jitter randomizes wait durations between 0 and calculated backoff to avoid retry storms.
+	Jitter bool
+}
+
+var idempotentMethods = []string{
+	http.MethodGet,
+	http.MethodHead,
+	http.MethodOptions,
+	http.MethodTrace,
+	http.MethodPut,
+	http.MethodDelete,
+}
+
+// attemptsFor returns the number of attempts allowed for input request method.
+func (p *RetryPolicy) attemptsFor(method string) int {
+	if p == nil || p.MaxAttempts <= 1 {
+		return 1
+	}
+
+	methods := p.Methods
+	if len(methods) == 0 {
+		methods = idempotentMethods
+	}
+
+	for _, m := range methods {
+		if m == method {
+			return p.MaxAttempts
+		}
+	}
+	return 1
+}
+
+func (p *RetryPolicy) shouldRetry(httpRes *http.Response, err error) bool {
+	if err != nil {
+		return !errors.Is(err, context.Canceled)
+	}
+
+	for _, code := range p.StatusCodes {
+		if httpRes.StatusCode == code {
+			return true
+		}
+	}
+	return false
+}
+
+// backoff returns wait duration before input retry number. (First retry is 1.)
+func (p *RetryPolicy) backoff(retry int) time.Duration {
+	if p.BaseBackoff <= 0 {
+		return 0
+	}
+
+	wait := p.BaseBackoff
+	for i := 1; i < retry; i++ {
+		wait *= 2
+		if p.MaxBackoff > 0 && wait >= p.MaxBackoff {
+			break
+		}
+	}
+	if p.MaxBackoff > 0 && wait > p.MaxBackoff {
+		wait = p.MaxBackoff
+	}
+
+	if p.Jitter {
+		wait = time.Duration(rand.Int63n(int64(wait) + 1))
+	}
+	return wait
+}
+
+// sleep waits for d unless ctx is done first.
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,409 @@
+package gmrouting
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// RouteConfig is a declarative definition of Router rules and ProxyClient route table.
+// It can be loaded from YAML or JSON files via LoadRouteConfig.
+//
+// E.g:
+//
+//	routes:
+//	  - name: transfer
+//	    method: GET
+//	    path: /api/transfers/{id:int}
+//	    dynamic: true
+//	    handler: getTransfer
+//	    auth: authenticate
+//	    middlewares: [auditLog]
+//	proxyRoutes:
+//	  - method: GET
+//	    path: /api/accounts/{guid}
+//	    rateLimit: {requests: 10, window: 1s}
+//	    target:
+//	      upstreamUrl: http://10.0.0.1:8080
+//	      pathRewrite: /v2/accounts/{guid}
+//	      headerRewrites:
+//	        - {action: set, name: X-Account, value: "{guid}"}
+type RouteConfig struct {
+	Routes      []RouteRuleConfig      `json:"routes" yaml:"routes"`
+	ProxyRoutes []ProxyRouteRuleConfig `json:"proxyRoutes" yaml:"proxyRoutes"`
+}
+
+// RouteRuleConfig is the declarative definition of a RouteRule.
+// Handler, auth and middlewares are names which are resolved through a HandlerRegistry.
+type RouteRuleConfig struct {
+	Name        string           `json:"name,omitempty" yaml:"name,omitempty"`
+	Method      string           `json:"method" yaml:"method"`
+	Path        string           `json:"path" yaml:"path"`
+	Dynamic     bool             `json:"dynamic,omitempty" yaml:"dynamic,omitempty"`
+	Handler     string           `json:"handler" yaml:"handler"`
+	Auth        string           `json:"auth,omitempty" yaml:"auth,omitempty"`
+	Middlewares []string         `json:"middlewares,omitempty" yaml:"middlewares,omitempty"`
+	RateLimit   *RateLimitConfig `json:"rateLimit,omitempty" yaml:"rateLimit,omitempty"`
+}
+
+// ProxyRouteRuleConfig is the declarative definition of a ProxyRouteRule.
+type ProxyRouteRuleConfig struct {
+	Method    string             `json:"method" yaml:"method"`
+	Path      string             `json:"path" yaml:"path"`
+	Target    *ProxyTargetConfig `json:"target,omitempty" yaml:"target,omitempty"`
+	RateLimit *RateLimitConfig   `json:"rateLimit,omitempty" yaml:"rateLimit,omitempty"`
+}
+
+// ProxyTargetConfig is the declarative definition of a ProxyTarget.
+type ProxyTargetConfig struct {
+	UpstreamUrl    string                `json:"upstreamUrl,omitempty" yaml:"upstreamUrl,omitempty"`
+	PathRewrite    string                `json:"pathRewrite,omitempty" yaml:"pathRewrite,omitempty"`
+	HeaderRewrites []HeaderRewriteConfig `json:"headerRewrites,omitempty" yaml:"headerRewrites,omitempty"`
+}
+
+// HeaderRewriteConfig is the declarative definition of a HeaderRewrite. Action is one of: set, add, remove
+type HeaderRewriteConfig struct {
+	Action string `json:"action" yaml:"action"`
+	Name   string `json:"name" yaml:"name"`
+	Value  string `json:"value,omitempty" yaml:"value,omitempty"`
+}
+
+// RateLimitConfig is the declarative definition of a RateLimit. Window is a duration string. E.g: 1s, 5m
+type RateLimitConfig struct {
+	Requests int    `json:"requests" yaml:"requests"`
+	Window   string `json:"window" yaml:"window"`
+	Burst    int    `json:"burst,omitempty" yaml:"burst,omitempty"`
+}
+
+var headerRewriteActions = map[string]HeaderRewriteAction{
+	"set":    HeaderSet,
+	"add":    HeaderAdd,
+	"remove": HeaderRemove,
+}
+
+// LoadRouteConfig reads route config from input file. Format is decided by file extension: .yaml, .yml or .json
+func LoadRouteConfig(path string) (*RouteConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return ParseYAMLRouteConfig(data)
+	case ".json":
+		return ParseJSONRouteConfig(data)
+	}
+	return nil, fmt.Errorf("unsupported route config file extension: '%s'", filepath.Ext(path))
+}
+
+// ParseYAMLRouteConfig parses route config from YAML data. Unknown fields are rejected.
+func ParseYAMLRouteConfig(data []byte) (*RouteConfig, error) {
+	config := &RouteConfig{}
+	decoder := yaml.NewDecoder(strings.NewReader(string(data)))
+	decoder.KnownFields(true)
+	err := decoder.Decode(config)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse route config: %s", err.Error())
+	}
+	return config, nil
+}
+
+// ParseJSONRouteConfig parses route config from JSON data. Unknown fields are rejected.
+func ParseJSONRouteConfig(data []byte) (*RouteConfig, error) {
+	config := &RouteConfig{}
+	decoder := json.NewDecoder(strings.NewReader(string(data)))
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(config)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse route config: %s", err.Error())
+	}
+	return config, nil
+}
+
+// ValidationProblem is a single problem found in a RouteConfig.
+type ValidationProblem struct {
+	// Source points to the faulty entry. E.g: routes[2], proxyRoutes[0]
+	Source  string
+	Message string
+}
+
+// ValidationReport lists all problems found in a RouteConfig. It is returned as error.
+type ValidationReport struct {
+	Problems []ValidationProblem
+}
+
+func (vr *ValidationReport) Error() string {
+	lines := make([]string, 0, len(vr.Problems))
+	for _, p := range vr.Problems {
+		lines = append(lines, p.Source+": "+p.Message)
+	}
+	return fmt.Sprintf("route config has %d problem(s):\n%s", len(vr.Problems), strings.Join(lines, "\n"))
+}
+
+func (vr *ValidationReport) add(source string, format string, args ...interface{}) {
+	vr.Problems = append(vr.Problems, ValidationProblem{
+		Source:  source,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// err returns the report as error. It returns nil if there are no problems.
+func (vr *ValidationReport) err() error {
+	if len(vr.Problems) == 0 {
+		return nil
+	}
+	return vr
+}
+
+// RouteRules builds RouteRules of the config. Names of handlers, auths and middlewares are resolved through registry.
+//
+// All entries are validated before returning. If there are problems, returned error is a *ValidationReport which lists all of them.
+func (c *RouteConfig) RouteRules(registry *HandlerRegistry) ([]*RouteRule, error) {
+	if registry == nil {
+		registry = NewHandlerRegistry()
+	}
+
+	report := &ValidationReport{}
+	result := make([]*RouteRule, 0, len(c.Routes))
+
+	/* Scratch tree is used for finding conflicting dynamic paths. E.g: /a/{id} and /a/{guid} */
+	tree := newRouteNode()
+	paths := make(map[string]string)
+	names := make(map[string]string)
+
+	for i, e := range c.Routes {
+		source := fmt.Sprintf("routes[%d]", i)
+		problemCount := len(report.Problems)
+
+		rule := &RouteRule{
+			Name:        e.Name,
+			Method:      e.Method,
+			Path:        e.Path,
+			DynamicPath: e.Dynamic,
+		}
+
+		validateMethodAndPath(report, source, e.Method, e.Path)
+		if e.Dynamic {
+			_, err := compileRoute(e.Path)
+			if err != nil {
+				report.add(source, "invalid path definition: '%s': %s", e.Path, err.Error())
+			}
+		} else if strings.ContainsAny(e.Path, "{}") {
+			report.add(source, "path: '%s' has route parameters but is not dynamic", e.Path)
+		}
+
+		key := e.Method + " " + e.Path
+		if other, ok := paths[key]; ok {
+			report.add(source, "path: '%s' is registered multiple times to method: '%s' (see %s)", e.Path, e.Method, other)
+		} else {
+			paths[key] = source
+		}
+
+		if e.Name != "" {
+			if other, ok := names[e.Name]; ok {
+				report.add(source, "name: '%s' is registered multiple times (see %s)", e.Name, other)
+			} else {
+				names[e.Name] = source
+			}
+		}
+
+		if e.Handler == "" {
+			report.add(source, "handler is required")
+		} else if rule.RouteTo = registry.handlers[e.Handler]; rule.RouteTo == nil {
+			report.add(source, "unknown handler: '%s'", e.Handler)
+		}
+
+		if e.Auth != "" {
+			if rule.AuthWith = registry.auths[e.Auth]; rule.AuthWith == nil {
+				report.add(source, "unknown auth: '%s'", e.Auth)
+			}
+		}
+
+		for _, m := range e.Middlewares {
+			middleware := registry.middlewares[m]
+			if middleware == nil {
+				report.add(source, "unknown middleware: '%s'", m)
+				continue
+			}
+			rule.Middlewares = append(rule.Middlewares, middleware)
+		}
+
+		rule.RateLimit = buildRateLimit(report, source, e.RateLimit)
+
+		if len(report.Problems) == problemCount && e.Dynamic && canInsert(e.Path) {
+			err := tree.insert(rule, rule.Path, false)
+			if err != nil {
+				report.add(source, "%s", err.Error())
+			}
+		}
+
+		result = append(result, rule)
+	}
+
+	err := report.err()
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// ProxyRouteRules builds ProxyRouteRules of the config.
+//
+// All entries are validated before returning. If there are problems, returned error is a *ValidationReport which lists all of them.
+func (c *RouteConfig) ProxyRouteRules() ([]*ProxyRouteRule, error) {
+	report := &ValidationReport{}
+	result := make([]*ProxyRouteRule, 0, len(c.ProxyRoutes))
+
+	for i, e := range c.ProxyRoutes {
+		source := fmt.Sprintf("proxyRoutes[%d]", i)
+
+		validateMethodAndPath(report, source, e.Method, e.Path)
+
+		var paramNames []string
+		compiled, err := compileRoute(e.Path)
+		if err != nil {
+			report.add(source, "invalid path definition: '%s': %s", e.Path, err.Error())
+		} else {
+			paramNames = compiled.SubexpNames()
+		}
+
+		rule := NewProxyRouteRule(e.Method, e.Path)
+		rule.SetRateLimit(buildRateLimit(report, source, e.RateLimit))
+
+		if e.Target != nil {
+			rule.target = buildProxyTarget(report, source, e.Target)
+			if rule.target != nil && paramNames != nil {
+				err = rule.target.validate(paramNames)
+				if err != nil {
+					report.add(source, "invalid target: %s", err.Error())
+				}
+			}
+		}
+
+		result = append(result, rule)
+	}
+
+	err := report.err()
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// NewRouter builds RouteRules of the config and creates a Router from them.
+func (c *RouteConfig) NewRouter(registry *HandlerRegistry) (*Router, error) {
+	rules, err := c.RouteRules(registry)
+	if err != nil {
+		return nil, err
+	}
+	return NewRouter(rules)
+}
+
+// NewProxyRouteTable builds ProxyRouteRules of the config and creates a RouteTable from them.
+func (c *RouteConfig) NewProxyRouteTable() (*RouteTable, error) {
+	rules, err := c.ProxyRouteRules()
+	if err != nil {
+		return nil, err
+	}
+	return NewProxyRouteTable(rules)
+}
+
+func validateMethodAndPath(report *ValidationReport, source, method, path string) {
+	if method == "" {
+		report.add(source, "method is required")
+	} else if method != strings.ToUpper(method) {
+		report.add(source, "method must be upper case: '%s'", method)
+	}
+
+	if !strings.HasPrefix(path, "/") {
+		report.add(source, "path must start with '/': '%s'", path)
+	}
+}
+
+func buildRateLimit(report *ValidationReport, source string, config *RateLimitConfig) *RateLimit {
+	if config == nil {
+		return nil
+	}
+
+	window, err := time.ParseDuration(config.Window)
+	if err != nil {
+		report.add(source, "invalid rate limit window: '%s'", config.Window)
+		return nil
+	}
+
+	limit := &RateLimit{
+		Requests: config.Requests,
+		Window:   window,
+		Burst:    config.Burst,
+	}
+	err = limit.validate()
+	if err != nil {
+		report.add(source, "%s", err.Error())
+		return nil
+	}
+	return limit
+}
+
+func buildProxyTarget(report *ValidationReport, source string, config *ProxyTargetConfig) *ProxyTarget {
+	target := &ProxyTarget{
+		UpstreamUrl: config.UpstreamUrl,
+		PathRewrite: config.PathRewrite,
+	}
+
+	valid := true
+	for _, h := range config.HeaderRewrites {
+		action, ok := headerRewriteActions[strings.ToLower(h.Action)]
+		if !ok {
+			report.add(source, "unknown header rewrite action: '%s'", h.Action)
+			valid = false
+			continue
+		}
+		target.HeaderRewrites = append(target.HeaderRewrites, HeaderRewrite{
+			Action: action,
+			Name:   h.Name,
+			Value:  h.Value,
+		})
+	}
+
+	if !valid {
+		return nil
+	}
+	return target
+}
+
+// HandlerRegistry resolves handler, auth and middleware names of a RouteConfig to functions.
+type HandlerRegistry struct {
+	handlers    map[string]func(w http.ResponseWriter, r *http.Request, routeParams map[string]string)
+	auths       map[string]func(w http.ResponseWriter, r *http.Request) error
+	middlewares map[string]Middleware
+}
+
+func NewHandlerRegistry() *HandlerRegistry {
+	return &HandlerRegistry{
+		handlers:    make(map[string]func(w http.ResponseWriter, r *http.Request, routeParams map[string]string)),
+		auths:       make(map[string]func(w http.ResponseWriter, r *http.Request) error),
+		middlewares: make(map[string]Middleware),
+	}
+}
+
+// RegisterHandler registers a RouteTo function with input name. Registering the same name again replaces the previous one.
+func (hr *HandlerRegistry) RegisterHandler(name string, handler func(w http.ResponseWriter, r *http.Request, routeParams map[string]string)) {
+	hr.handlers[name] = handler
+}
+
+// RegisterAuth registers an AuthWith function with input name. Registering the same name again replaces the previous one.
+func (hr *HandlerRegistry) RegisterAuth(name string, auth func(w http.ResponseWriter, r *http.Request) error) {
+	hr.auths[name] = auth
+}
+
+// RegisterMiddleware registers a middleware with input name. Registering the same name again replaces the previous one.
+func (hr *HandlerRegistry) RegisterMiddleware(name string, middleware Middleware) {
+	hr.middlewares[name] = middleware
+}
@@ -0,0 +1,179 @@
+package gmrouting
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testYAMLRouteConfig = `
+routes:
+  - name: transfer
+    method: GET
+    path: /api/transfers/{id:int}
+    dynamic: true
+    handler: getTransfer
+    auth: authenticate
+    middlewares: [tag]
+    rateLimit: {requests: 10, window: 1s, burst: 20}
+  - method: GET
+    path: /api/accounts
+    handler: listAccounts
+proxyRoutes:
+  - method: GET
+    path: /api/accounts/{guid}
+    rateLimit: {requests: 5, window: 1m}
+    target:
+      upstreamUrl: http://10.0.0.1:8080
+      pathRewrite: /v2/accounts/{guid}
+      headerRewrites:
+        - {action: set, name: X-Account, value: "{guid}"}
+        - {action: remove, name: Cookie}
+`
+
+const testJSONRouteConfig = `{
+  "routes": [
+    {"method": "GET", "path": "/api/accounts", "handler": "listAccounts"}
+  ],
+  "proxyRoutes": [
+    {"method": "POST", "path": "/api/transfers"}
+  ]
+}`
+
+func testHandlerRegistry() *HandlerRegistry {
+	registry := NewHandlerRegistry()
+	registry.RegisterHandler("getTransfer", func(w http.ResponseWriter, r *http.Request, routeParams map[string]string) {
+		w.Write([]byte("transfer " + routeParams["id"]))
+	})
+	registry.RegisterHandler("listAccounts", func(w http.ResponseWriter, r *http.Request, routeParams map[string]string) {
+		w.Write([]byte("accounts"))
+	})
+	registry.RegisterAuth("authenticate", func(w http.ResponseWriter, r *http.Request) error {
+		if r.Header.Get("Authorization") == "" {
+			return ErrUnauthorized
+		}
+		return nil
+	})
+	registry.RegisterMiddleware("tag", func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Tag", "config")
+			next.ServeHTTP(w, r)
+		})
+	})
+	return registry
+}
+
+func Test_Route_Config_YAML(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "routes.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte(testYAMLRouteConfig), 0600))
+
+	config, err := LoadRouteConfig(path)
+	assert.NoError(t, err)
+
+	router, err := config.NewRouter(testHandlerRegistry())
+	assert.NoError(t, err)
+
+	req := httptest.NewRequest(`GET`, `/api/transfers/42`, nil)
+	req.Header.Set("Authorization", "token")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "transfer 42", rec.Body.String())
+	assert.Equal(t, "config", rec.Header().Get("X-Tag"))
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(`GET`, `/api/transfers/42`, nil))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	built, err := router.URLFor("transfer", map[string]string{"id": "7"}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, `/api/transfers/7`, built)
+
+	rules, err := config.RouteRules(testHandlerRegistry())
+	assert.NoError(t, err)
+	assert.Equal(t, &RateLimit{Requests: 10, Window: time.Second, Burst: 20}, rules[0].RateLimit)
+
+	proxyRules, err := config.ProxyRouteRules()
+	assert.NoError(t, err)
+	assert.Len(t, proxyRules, 1)
+	assert.Equal(t, &RateLimit{Requests: 5, Window: time.Minute}, proxyRules[0].RateLimit())
+	assert.Equal(t, &ProxyTarget{
+		UpstreamUrl: "http://10.0.0.1:8080",
+		PathRewrite: "/v2/accounts/{guid}",
+		HeaderRewrites: []HeaderRewrite{
+			{Action: HeaderSet, Name: "X-Account", Value: "{guid}"},
+			{Action: HeaderRemove, Name: "Cookie"},
+		},
+	}, proxyRules[0].Target())
+
+	_, err = config.NewProxyRouteTable()
+	assert.NoError(t, err)
+}
+
+func Test_Route_Config_JSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "routes.json")
+	assert.NoError(t, os.WriteFile(path, []byte(testJSONRouteConfig), 0600))
+
+	config, err := LoadRouteConfig(path)
+	assert.NoError(t, err)
+
+	_, err = config.NewRouter(testHandlerRegistry())
+	assert.NoError(t, err)
+
+	table, err := config.NewProxyRouteTable()
+	assert.NoError(t, err)
+	rule, _ := table.findRule(`POST`, `/api/transfers`, false)
+	assert.NotNil(t, rule)
+
+	_, err = ParseJSONRouteConfig([]byte(`{"routes": [{"method": "GET", "unknown": true}]}`))
+	assert.Error(t, err)
+
+	_, err = LoadRouteConfig(filepath.Join(t.TempDir(), "routes.toml"))
+	assert.Error(t, err)
+}
+
+func Test_Route_Config_Validation_Report(t *testing.T) {
+	config, err := ParseYAMLRouteConfig([]byte(`
+routes:
+  - {method: GET, path: "/api/transfers/{id}", dynamic: true, handler: getTransfer}
+  - {method: GET, path: "/api/transfers/{guid}", dynamic: true, handler: getTransfer}
+  - {method: get, path: "api/accounts", handler: missing}
+  - {method: GET, path: "/api/{id:[0-9}", dynamic: true, handler: getTransfer, auth: missing, middlewares: [missing]}
+  - {method: GET, path: "/api/accounts/{id}", handler: listAccounts, rateLimit: {requests: 0, window: 1s}}
+proxyRoutes:
+  - {method: GET, path: "/api/{id", rateLimit: {requests: 1, window: soon}}
+  - {method: GET, path: "/api/{id}", target: {pathRewrite: "/v2/{guid}", headerRewrites: [{action: rename, name: X}]}}
+  - {method: GET, path: "/api/{id}", target: {upstreamUrl: invalid}}
+`))
+	assert.NoError(t, err)
+
+	_, err = config.RouteRules(testHandlerRegistry())
+	var report *ValidationReport
+	if assert.True(t, errors.As(err, &report)) {
+		sources := make([]string, 0)
+		for _, p := range report.Problems {
+			sources = append(sources, p.Source)
+		}
+		assert.Equal(t, []string{
+			"routes[1]",
+			"routes[2]", "routes[2]", "routes[2]",
+			"routes[3]", "routes[3]", "routes[3]",
+			"routes[4]", "routes[4]",
+		}, sources)
+	}
+
+	_, err = config.ProxyRouteRules()
+	if assert.True(t, errors.As(err, &report)) {
+		sources := make([]string, 0)
+		for _, p := range report.Problems {
+			sources = append(sources, p.Source)
+		}
+		assert.Equal(t, []string{"proxyRoutes[0]", "proxyRoutes[0]", "proxyRoutes[1]", "proxyRoutes[2]"}, sources)
+	}
+}
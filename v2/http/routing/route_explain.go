@@ -0,0 +1,351 @@
+package gmrouting
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Outcomes of RouteExplanation.
+const (
+	OutcomeMatched          = "matched"
+	OutcomeNotFound         = "not found"
+	OutcomeMethodNotAllowed = "method not allowed"
+	OutcomeAllowed          = "allowed"
+	OutcomeNotAllowed       = "not allowed"
+	OutcomeIgnored          = "ignored"
+)
+
+// RouteInfo describes a registered rule of Router or RouteTable.
+type RouteInfo struct {
+	Name    string `json:"name,omitempty"`
+	Method  string `json:"method"`
+	Path    string `json:"path"`
+	Dynamic bool   `json:"dynamic,omitempty"`
+	// Auth is true for Router rules which have AuthWith.
+	Auth      bool   `json:"auth,omitempty"`
+	RateLimit string `json:"rateLimit,omitempty"`
+	// UpstreamUrl and PathRewrite are set for RouteTable rules which have a target.
+	UpstreamUrl string `json:"upstreamUrl,omitempty"`
+	PathRewrite string `json:"pathRewrite,omitempty"`
+}
+
+// RuleCandidate is a single rule which is considered while explaining a request.
+type RuleCandidate struct {
+	Rule RouteInfo `json:"rule"`
+	// Matched is true if method and path of the request match the rule.
+	Matched bool `json:"matched"`
+	// Selected is true for the rule which handles the request.
+	Selected bool `json:"selected"`
+	// Reason tells why the rule is selected or not.
+	Reason      string            `json:"reason"`
+	RouteParams map[string]string `json:"routeParams,omitempty"`
+}
+
+// RouteExplanation tells how a request is routed and why.
+type RouteExplanation struct {
+	Method  string `json:"method"`
+	Path    string `json:"path"`
+	Outcome string `json:"outcome"`
+	// Candidates contains every registered rule in registration order.
+	Candidates []RuleCandidate `json:"candidates"`
+}
+
+// Routes returns descriptions of all rules in registration order.
+func (sr *Router) Routes() []RouteInfo {
+	result := make([]RouteInfo, 0, len(sr.routeRules))
+	for _, r := range sr.routeRules {
+		result = append(result, routeRuleInfo(r))
+	}
+	return result
+}
+
+// Explain tells which rule handles input method and path, and why every other rule does not.
+//
+// Path is normalized the same way as requests. Explanation contains the normalized path.
+//
+// Outcome is one of: matched, method not allowed, not found. AuthWith and rate limits are not evaluated.
+func (sr *Router) Explain(method, path string) *RouteExplanation {
+	path = sr.normalizer.Normalize(strings.Split(path, "?")[0])
+	selected, _ := sr.find(method, path)
+
+	explanation := &RouteExplanation{
+		Method:     method,
+		Path:       path,
+		Outcome:    OutcomeNotFound,
+		Candidates: make([]RuleCandidate, 0, len(sr.routeRules)),
+	}
+
+	for _, r := range sr.routeRules {
+		routeParams := sr.matchRule(r, path)
+		pathReason := ""
+		if routeParams == nil {
+			pathReason = mismatchReason(sr.normalizer.normalizeRule(r.Path), r.DynamicPath, path, sr.normalizer.foldCase())
+		}
+
+		candidate := RuleCandidate{
+			Rule:    routeRuleInfo(r),
+			Matched: routeParams != nil && r.Method == method,
+		}
+		if len(routeParams) > 0 {
+			candidate.RouteParams = routeParams
+		}
+
+		switch {
+		case r == selected:
+			candidate.Selected = true
+			candidate.Reason = "selected"
+		case r.Method != method:
+			candidate.Reason = methodReason(r.Method, pathReason)
+		case pathReason != "":
+			candidate.Reason = pathReason
+		default:
+			candidate.Reason = fmt.Sprintf("rule: '%s %s' has higher precedence", selected.Method, selected.Path)
+		}
+		explanation.Candidates = append(explanation.Candidates, candidate)
+	}
+
+	if selected != nil {
+		explanation.Outcome = OutcomeMatched
+	} else if len(sr.allowedMethods(path)) > 0 {
+		explanation.Outcome = OutcomeMethodNotAllowed
+	}
+	return explanation
+}
+
+// HandleDebug can be registered to http.Handle() for inspecting the router.
+//
+// It lists all rules. If `path` query parameter is given, it explains the request with `method` (GET by default) and `path` instead.
+//
+// E.g: /debug/routes?method=POST&path=/api/transfers/42
+//
+// Note that it exposes route definitions. It should not be reachable publicly.
+func (sr *Router) HandleDebug(w http.ResponseWriter, r *http.Request) {
+	method, path, explain := debugQuery(r)
+	if explain {
+		sr.responseWriter.WriteCustomJsonResponse(w, http.StatusOK, sr.Explain(method, path))
+		return
+	}
+	sr.responseWriter.WriteCustomJsonResponse(w, http.StatusOK, map[string]interface{}{
+		"routes": sr.Routes(),
+	})
+}
+
+// Routes returns descriptions of all rules in registration order.
+func (t *RouteTable) Routes() []RouteInfo {
+	result := make([]RouteInfo, 0, len(t.routeRules))
+	for _, r := range t.routeRules {
+		result = append(result, proxyRouteRuleInfo(r))
+	}
+	return result
+}
+
+// Explain tells which rule allows input method and path, and why every other rule does not.
+//
+// Rules are evaluated in registration order and the first matching one is selected.
+// Outcome is one of: allowed, not allowed.
+func (t *RouteTable) Explain(method, path string) *RouteExplanation {
+	return t.explain(method, strings.Split(path, "?")[0], false)
+}
+
+func (t *RouteTable) explain(method, path string, foldCase bool) *RouteExplanation {
+	selected, _ := t.findRule(method, path, foldCase)
+
+	explanation := &RouteExplanation{
+		Method:     method,
+		Path:       path,
+		Outcome:    OutcomeNotAllowed,
+		Candidates: make([]RuleCandidate, 0, len(t.routeRules)),
+	}
+
+	for _, r := range t.routeRules {
+		routeParams := r.routeParams(path, foldCase)
+		pathReason := ""
+		if routeParams == nil {
+			pathReason = mismatchReason(r.path, true, path, foldCase)
+		}
+
+		candidate := RuleCandidate{
+			Rule:        proxyRouteRuleInfo(r),
+			Matched:     routeParams != nil && r.method == method,
+			RouteParams: routeParams,
+		}
+
+		switch {
+		case r == selected:
+			candidate.Selected = true
+			candidate.Reason = "selected"
+		case r.method != method:
+			candidate.Reason = methodReason(r.method, pathReason)
+		case pathReason != "":
+			candidate.Reason = pathReason
+		default:
+			candidate.Reason = fmt.Sprintf("earlier rule: '%s %s' is selected", selected.method, selected.path)
+		}
+		explanation.Candidates = append(explanation.Candidates, candidate)
+	}
+
+	if selected != nil {
+		explanation.Outcome = OutcomeAllowed
+	}
+	return explanation
+}
+
+// Explain tells how proxy client handles input method and request uri.
+//
+// Path of uri is normalized the same way as requests. Explanation contains the normalized path.
+//
+// Outcome is one of: ignored, allowed, not allowed. Requests which are not allowed are responded with 401.
+// Rate limits, validation and upstream availability are not evaluated.
+func (pc *ProxyClient) Explain(method, uri string) *RouteExplanation {
+	u, err := url.ParseRequestURI(uri)
+	if err != nil {
+		u = &url.URL{Path: strings.Split(uri, "?")[0]}
+	}
+	path := pc.normalizer.Normalize(u.EscapedPath())
+	explanation := pc.routeTable.Load().explain(method, path, pc.normalizer.foldCase())
+	if pc.isIgnored(u, withPath(u, path)) {
+		explanation.Outcome = OutcomeIgnored
+		for i := range explanation.Candidates {
+			explanation.Candidates[i].Selected = false
+			explanation.Candidates[i].Reason = "path is ignored"
+		}
+	}
+	return explanation
+}
+
+// HandleDebug can be registered to http.Handle() for inspecting the current route table of proxy client.
+//
+// It lists all rules. If `path` query parameter is given, it explains the request with `method` (GET by default) and `path` instead.
+//
+// E.g: /debug/routes?method=POST&path=/api/transfers/42
+//
+// Note that it exposes route definitions. It should not be reachable publicly, nor be registered under an allowed path.
+func (pc *ProxyClient) HandleDebug(w http.ResponseWriter, r *http.Request) {
+	method, path, explain := debugQuery(r)
+	if explain {
+		pc.responseWriter.WriteCustomJsonResponse(w, http.StatusOK, pc.Explain(method, path))
+		return
+	}
+
+	ignoredPaths := make([]string, 0, len(pc.ignoredPaths))
+	for path := range pc.ignoredPaths {
+		ignoredPaths = append(ignoredPaths, path)
+	}
+	sort.Strings(ignoredPaths)
+
+	pc.responseWriter.WriteCustomJsonResponse(w, http.StatusOK, map[string]interface{}{
+		"routes":       pc.routeTable.Load().Routes(),
+		"ignoredPaths": ignoredPaths,
+	})
+}
+
+func debugQuery(r *http.Request) (method, path string, explain bool) {
+	query := r.URL.Query()
+	path = query.Get("path")
+	method = strings.ToUpper(query.Get("method"))
+	if method == "" {
+		method = http.MethodGet
+	}
+	return method, path, path != ""
+}
+
+func methodReason(ruleMethod, pathReason string) string {
+	if pathReason == "" {
+		return fmt.Sprintf("path matches but method is: '%s'", ruleMethod)
+	}
+	return fmt.Sprintf("method is: '%s' and %s", ruleMethod, pathReason)
+}
+
+// mismatchReason tells why path does not match rule path. It is only meant for reporting,
+// rules are matched by Router.matchRule and ProxyRouteRule.routeParams.
+// Static parts are compared regardless of case if foldCase is true.
+func mismatchReason(rulePath string, dynamic bool, path string, foldCase bool) string {
+	if !dynamic {
+		return fmt.Sprintf("path differs from static path: '%s'", rulePath)
+	}
+	if !canInsert(rulePath) {
+		return fmt.Sprintf("path does not match pattern: '%s'", rulePath)
+	}
+
+	ruleSegments := splitPath(rulePath)
+	segments := splitPath(path)
+
+	for i, s := range ruleSegments {
+		var param *routeParam
+		if strings.ContainsAny(s, "{}") {
+			parts, err := parseRoute(s)
+			if err != nil {
+				return fmt.Sprintf("invalid path definition: %s", err.Error())
+			}
+			param = parts[0].param
+		}
+
+		if param != nil && param.wildcard {
+			if i >= len(segments) || strings.Join(segments[i:], "/") == "" {
+				return fmt.Sprintf("wildcard parameter: '%s' requires a non-empty rest of path", param.name)
+			}
+			return fmt.Sprintf("path does not match: '%s'", rulePath)
+		}
+
+		if i >= len(segments) {
+			return fmt.Sprintf("path is shorter than: '%s'", rulePath)
+		}
+
+		if param == nil {
+			if segments[i] != s && !(foldCase && strings.EqualFold(segments[i], s)) {
+				return fmt.Sprintf("segment %d: expected '%s', got '%s'", i+1, s, segments[i])
+			}
+			continue
+		}
+
+		if segments[i] == "" {
+			return fmt.Sprintf("segment %d: parameter: '%s' can not be empty", i+1, param.name)
+		}
+		if param.pattern != nil && !param.pattern.MatchString(segments[i]) {
+			return fmt.Sprintf("segment %d: '%s' does not satisfy constraint: '%s' of parameter: '%s'", i+1, segments[i], param.constraint, param.name)
+		}
+	}
+
+	if len(segments) > len(ruleSegments) {
+		return fmt.Sprintf("path is longer than: '%s'", rulePath)
+	}
+	return fmt.Sprintf("path does not match: '%s'", rulePath)
+}
+
+func routeRuleInfo(r *RouteRule) RouteInfo {
+	return RouteInfo{
+		Name:      r.Name,
+		Method:    r.Method,
+		Path:      r.Path,
+		Dynamic:   r.DynamicPath,
+		Auth:      r.AuthWith != nil,
+		RateLimit: rateLimitInfo(r.RateLimit),
+	}
+}
+
+func proxyRouteRuleInfo(r *ProxyRouteRule) RouteInfo {
+	info := RouteInfo{
+		Method:    r.method,
+		Path:      r.path,
+		Dynamic:   strings.Contains(r.path, "{"),
+		RateLimit: rateLimitInfo(r.rateLimit),
+	}
+	if r.target != nil {
+		info.UpstreamUrl = r.target.UpstreamUrl
+		info.PathRewrite = r.target.PathRewrite
+	}
+	return info
+}
+
+func rateLimitInfo(limit *RateLimit) string {
+	if limit == nil {
+		return ""
+	}
+	if limit.Burst > 0 {
+		return fmt.Sprintf("%d per %s (burst: %d)", limit.Requests, limit.Window, limit.Burst)
+	}
+	return fmt.Sprintf("%d per %s", limit.Requests, limit.Window)
+}
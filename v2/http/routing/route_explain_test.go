@@ -0,0 +1,154 @@
+package gmrouting
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	gmhttp "github.com/onuryurdupak/gomod/v2/http"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Router_Explain(t *testing.T) {
+	router, err := NewRouter([]*RouteRule{
+		{Method: `GET`, Path: `/api/accounts`},
+		{Method: `GET`, Path: `/api/transfers/{id:int}`, DynamicPath: true},
+		{Method: `GET`, Path: `/api/transfers/{name}`, DynamicPath: true},
+		{Method: `POST`, Path: `/api/transfers/{id:int}`, DynamicPath: true},
+		{Method: `GET`, Path: `/static/{path...}`, DynamicPath: true},
+	})
+	assert.NoError(t, err)
+
+	explanation := router.Explain(`GET`, `/api/transfers/42?expand=true`)
+	assert.Equal(t, OutcomeMatched, explanation.Outcome)
+	assert.Equal(t, `/api/transfers/42`, explanation.Path)
+
+	reasons := make([]string, 0)
+	for _, c := range explanation.Candidates {
+		reasons = append(reasons, c.Reason)
+	}
+	assert.Equal(t, []string{
+		"path differs from static path: '/api/accounts'",
+		"selected",
+		"rule: 'GET /api/transfers/{id:int}' has higher precedence",
+		"path matches but method is: 'POST'",
+		"segment 1: expected 'static', got 'api'",
+	}, reasons)
+	assert.True(t, explanation.Candidates[1].Selected)
+	assert.Equal(t, map[string]string{"id": "42"}, explanation.Candidates[1].RouteParams)
+	assert.True(t, explanation.Candidates[2].Matched)
+	assert.False(t, explanation.Candidates[2].Selected)
+	assert.False(t, explanation.Candidates[3].Matched)
+
+	explanation = router.Explain(`DELETE`, `/api/transfers/42`)
+	assert.Equal(t, OutcomeMethodNotAllowed, explanation.Outcome)
+
+	explanation = router.Explain(`GET`, `/api/transfers/42/extra`)
+	assert.Equal(t, OutcomeNotFound, explanation.Outcome)
+	assert.Equal(t, "path is longer than: '/api/transfers/{id:int}'", explanation.Candidates[1].Reason)
+
+	explanation = router.Explain(`POST`, `/api/transfers/abc`)
+	assert.Equal(t, "segment 3: 'abc' does not satisfy constraint: 'int' of parameter: 'id'", explanation.Candidates[3].Reason)
+
+	explanation = router.Explain(`GET`, `/static/`)
+	assert.Equal(t, "wildcard parameter: 'path' requires a non-empty rest of path", explanation.Candidates[4].Reason)
+
+	rec := httptest.NewRecorder()
+	router.HandleDebug(rec, httptest.NewRequest(`GET`, `/debug/routes`, nil))
+	routes := map[string][]RouteInfo{}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &routes))
+	assert.Len(t, routes["routes"], 5)
+
+	rec = httptest.NewRecorder()
+	router.HandleDebug(rec, httptest.NewRequest(`GET`, `/debug/routes?method=post&path=/api/transfers/1`, nil))
+	served := RouteExplanation{}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &served))
+	assert.Equal(t, `POST`, served.Method)
+	assert.Equal(t, OutcomeMatched, served.Outcome)
+}
+
+func Test_Router_Explain_Agrees_With_FindMatch(t *testing.T) {
+	router, err := NewRouter([]*RouteRule{
+		{Method: `GET`, Path: `/files/{path...}`, DynamicPath: true},
+		{Method: `GET`, Path: `/files/{id:int}`, DynamicPath: true},
+		{Method: `GET`, Path: `/files/{name}.json`, DynamicPath: true},
+		{Method: `GET`, Path: `/files/shared/{path...}`, DynamicPath: true},
+		{Method: `GET`, Path: `/files/latest`},
+	})
+	assert.NoError(t, err)
+
+	paths := []string{`/files/42`, `/files/report.json`, `/files/a%2Fb.json`, `/files/shared/report.json`,
+		`/files/latest`, `/files/2024/q1`, `/files/`, `/other`}
+	for _, path := range paths {
+		explanation := router.Explain(`GET`, path)
+		match := router.FindMatch(httptest.NewRequest(`GET`, path, nil))
+
+		var selected *RuleCandidate
+		for i, c := range explanation.Candidates {
+			if c.Selected {
+				selected = &explanation.Candidates[i]
+			}
+		}
+		if match == nil {
+			assert.Nil(t, selected, path)
+			assert.Equal(t, OutcomeNotFound, explanation.Outcome, path)
+			continue
+		}
+		if assert.NotNil(t, selected, path) {
+			assert.Equal(t, match.Rule.Path, selected.Rule.Path, path)
+			assert.True(t, selected.Matched, path)
+			if len(match.RouteParams) > 0 {
+				assert.Equal(t, match.RouteParams, selected.RouteParams, path)
+			}
+		}
+	}
+}
+
+func Test_Proxy_Explain(t *testing.T) {
+	limited := NewProxyRouteRule(`GET`, `/api/accounts/{guid}`)
+	limited.SetRateLimit(&RateLimit{Requests: 10, Window: time.Second})
+	table, err := NewProxyRouteTable([]*ProxyRouteRule{
+		limited,
+		NewProxyRouteRule(`GET`, `/api/accounts/{path...}`),
+		NewProxyRouteRuleWithTarget(`POST`, `/api/transfers`, &ProxyTarget{UpstreamUrl: "http://10.0.0.1:8080"}),
+	})
+	assert.NoError(t, err)
+
+	pc := NewProxyClient(table, "http://127.0.0.1:0", http.DefaultClient, gmhttp.NewResponseWriter(), []string{`/health`}, nil, nil, nil)
+
+	explanation := pc.Explain(`GET`, `/api/accounts/abc`)
+	assert.Equal(t, OutcomeAllowed, explanation.Outcome)
+	assert.True(t, explanation.Candidates[0].Selected)
+	assert.Equal(t, "earlier rule: 'GET /api/accounts/{guid}' is selected", explanation.Candidates[1].Reason)
+	assert.Equal(t, "method is: 'POST' and segment 2: expected 'transfers', got 'accounts'", explanation.Candidates[2].Reason)
+
+	explanation = pc.Explain(`GET`, `/api/transfers`)
+	assert.Equal(t, OutcomeNotAllowed, explanation.Outcome)
+	assert.Equal(t, "path matches but method is: 'POST'", explanation.Candidates[2].Reason)
+
+	explanation = pc.Explain(`GET`, `/health`)
+	assert.Equal(t, OutcomeIgnored, explanation.Outcome)
+
+	/* Ignored paths are checked after normalization as well, same as requests. */
+	for _, uri := range []string{`/api/../health`, `//health`} {
+		explanation = pc.Explain(`GET`, uri)
+		assert.Equal(t, OutcomeIgnored, explanation.Outcome, uri)
+
+		rec := httptest.NewRecorder()
+		pc.HandleRequestAndRedirect(rec, httptest.NewRequest(`GET`, uri, nil))
+		assert.Equal(t, http.StatusOK, rec.Code, uri)
+	}
+
+	rec := httptest.NewRecorder()
+	pc.HandleDebug(rec, httptest.NewRequest(`GET`, `/debug/routes`, nil))
+	res := struct {
+		Routes       []RouteInfo `json:"routes"`
+		IgnoredPaths []string    `json:"ignoredPaths"`
+	}{}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+	assert.Equal(t, []string{`/health`}, res.IgnoredPaths)
+	assert.Equal(t, RouteInfo{Method: `GET`, Path: `/api/accounts/{guid}`, Dynamic: true, RateLimit: "10 per 1s"}, res.Routes[0])
+	assert.Equal(t, "http://10.0.0.1:8080", res.Routes[2].UpstreamUrl)
+}
@@ -0,0 +1,125 @@
+package gmrouting
+
+import (
+	"net/http"
+	"strings"
+)
+
+// RouteGroup builds RouteRules which share a path prefix, AuthWith and middlewares.
+//
+// E.g:
+//
+//	api := NewRouteGroup("/api/v1", authenticate)
+//	api.Add(&RouteRule{Method: "GET", Path: "/accounts", RouteTo: listAccounts})
+//	admin := api.Group("/admin", requireAdmin, auditLog)
+//	admin.Add(&RouteRule{Method: "DELETE", Path: "/accounts/{id}", DynamicPath: true, RouteTo: deleteAccount})
+//	router, err := NewRouter(api.Rules())
+type RouteGroup struct {
+	prefix      string
+	authWith    func(w http.ResponseWriter, r *http.Request) error
+	middlewares []Middleware
+
+	rules    []*RouteRule
+	children []*RouteGroup
+}
+
+// NewRouteGroup creates a group whose rules will be prefixed with input prefix.
+//
+// authWith can be nil. Otherwise it is checked before AuthWith of each rule in the group.
+// middlewares run before RouteRule.Middlewares of each rule in the group.
+func NewRouteGroup(prefix string, authWith func(w http.ResponseWriter, r *http.Request) error, middlewares ...Middleware) *RouteGroup {
+	return &RouteGroup{
+		prefix:      strings.TrimSuffix(prefix, "/"),
+		authWith:    authWith,
+		middlewares: middlewares,
+	}
+}
+
+// Add registers rules to the group. Rule paths are relative to group prefix.
+//
+// Rules are not modified. Rules() returns prefixed copies of them.
+func (g *RouteGroup) Add(routeRules ...*RouteRule) {
+	g.rules = append(g.rules, routeRules...)
+}
+
+// Group creates a nested group whose prefix, AuthWith and middlewares are appended to the ones of g.
+func (g *RouteGroup) Group(prefix string, authWith func(w http.ResponseWriter, r *http.Request) error, middlewares ...Middleware) *RouteGroup {
+	child := NewRouteGroup(prefix, authWith, middlewares...)
+	g.children = append(g.children, child)
+	return child
+}
+
+// Mount registers all rules of router under input prefix.
+//
+// Router level middlewares of router (see Router.Use) are kept as group middlewares of the mounted rules.
+// Response writer and rate limiter of router are not carried over.
+func (g *RouteGroup) Mount(prefix string, router *Router) {
+	child := g.Group(prefix, nil, router.middlewares...)
+	child.Add(router.routeRules...)
+}
+
+// Rules returns prefixed copies of all rules in the group and its nested groups.
+// Output can be passed to NewRouter which also checks for duplicates.
+func (g *RouteGroup) Rules() []*RouteRule {
+	return g.build("", nil, nil)
+}
+
+func (g *RouteGroup) build(parentPrefix string, parentAuth []func(w http.ResponseWriter, r *http.Request) error, parentMiddlewares []Middleware) []*RouteRule {
+	prefix := parentPrefix + g.prefix
+
+	auths := append(append([]func(w http.ResponseWriter, r *http.Request) error{}, parentAuth...), g.authWith)
+	middlewares := append(append([]Middleware{}, parentMiddlewares...), g.middlewares...)
+
+	result := make([]*RouteRule, 0, len(g.rules))
+	for _, r := range g.rules {
+		path := prefix + r.Path
+		if r.Path == "/" && prefix != "" {
+			path = prefix
+		}
+
+		result = append(result, &RouteRule{
+			Name:        r.Name,
+			Method:      r.Method,
+			Path:        path,
+			DynamicPath: r.DynamicPath || strings.Contains(prefix, "{"),
+			AuthWith:    combineAuth(append(auths, r.AuthWith)),
+			RouteTo:     r.RouteTo,
+			RateLimit:   r.RateLimit,
+			Middlewares: append(append([]Middleware{}, middlewares...), r.Middlewares...),
+			Doc:         r.Doc,
+		})
+	}
+
+	for _, child := range g.children {
+		result = append(result, child.build(prefix, auths, middlewares)...)
+	}
+	return result
+}
+
+// combineAuth returns an AuthWith func which checks all non-nil input funcs in order and fails on the first error.
+// It returns nil if there is nothing to check.
+func combineAuth(auths []func(w http.ResponseWriter, r *http.Request) error) func(w http.ResponseWriter, r *http.Request) error {
+	nonNil := make([]func(w http.ResponseWriter, r *http.Request) error, 0, len(auths))
+	for _, a := range auths {
+		if a != nil {
+			nonNil = append(nonNil, a)
+		}
+	}
+
+	switch len(nonNil) {
+	case 0:
+		return nil
+	case 1:
+		return nonNil[0]
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) error {
+		for _, a := range nonNil {
+			err := a(w, r)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,76 @@
+package gmrouting
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Route_Group(t *testing.T) {
+	var calls []string
+	auth := func(name string, allow bool) func(w http.ResponseWriter, r *http.Request) error {
+		return func(w http.ResponseWriter, r *http.Request) error {
+			calls = append(calls, name)
+			if !allow {
+				return ErrForbidden
+			}
+			return nil
+		}
+	}
+	routeTo := func(w http.ResponseWriter, r *http.Request, routeParams map[string]string) {
+		calls = append(calls, "routeTo:"+routeParams["tenant"]+":"+routeParams["id"])
+	}
+
+	accounts, err := NewRouter([]*RouteRule{
+		{Method: `GET`, Path: `/`, RouteTo: routeTo},
+		{Method: `GET`, Path: `/{id}`, DynamicPath: true, RouteTo: routeTo},
+	})
+	assert.NoError(t, err)
+
+	api := NewRouteGroup("/api/{tenant}/", auth("api", true))
+	api.Add(&RouteRule{Method: `GET`, Path: `/transfers`, RouteTo: routeTo})
+	api.Mount("/accounts", accounts)
+	admin := api.Group("/admin", auth("admin", false))
+	admin.Add(&RouteRule{Method: `DELETE`, Path: `/transfers/{id}`, DynamicPath: true, RouteTo: routeTo})
+
+	rules := api.Rules()
+	paths := make([]string, len(rules))
+	for i, r := range rules {
+		paths[i] = r.Method + " " + r.Path
+		assert.True(t, r.DynamicPath)
+	}
+	assert.Equal(t, []string{
+		`GET /api/{tenant}/transfers`,
+		`GET /api/{tenant}/accounts`,
+		`GET /api/{tenant}/accounts/{id}`,
+		`DELETE /api/{tenant}/admin/transfers/{id}`,
+	}, paths)
+
+	router, err := NewRouter(rules)
+	assert.NoError(t, err)
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(`GET`, `/api/acme/accounts/5`, nil))
+	assert.Equal(t, []string{"api", "routeTo:acme:5"}, calls)
+
+	calls = nil
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(`DELETE`, `/api/acme/admin/transfers/5`, nil))
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Equal(t, []string{"api", "admin"}, calls)
+
+	// Duplicates created through groups are reported by NewRouter.
+	api.Add(&RouteRule{Method: `GET`, Path: `/accounts`})
+	_, err = NewRouter(api.Rules())
+	assert.Error(t, err)
+}
+
+func Test_Router_Duplicate_Detection(t *testing.T) {
+	_, err := NewRouter([]*RouteRule{
+		{Method: `GET`, Path: `/api/accounts`},
+		{Method: `POST`, Path: `/api/accounts`},
+		{Method: `GET`, Path: `/api/accounts`},
+	})
+	assert.Error(t, err)
+}
@@ -0,0 +1,101 @@
+package gmrouting
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+)
+
+// RouteMatch is the result of matching a single request to a RouteRule.
+//
+// A new RouteMatch is created for every request, so it can be used safely by concurrent requests of the same rule.
+type RouteMatch struct {
+	Rule *RouteRule
+	// RouteParams contains values of curly bracket definitions in rule path. It is empty for static paths.
+	RouteParams map[string]string
+}
+
+type routeMatchKey struct{}
+
+// Param returns value of the named route parameter. It returns an empty string if parameter does not exist.
+func (m *RouteMatch) Param(name string) string {
+	return m.RouteParams[name]
+}
+
+// ParamInt returns value of the named route parameter as int.
+// It returns error if parameter does not exist or is not a valid integer. E.g: {id:int}
+func (m *RouteMatch) ParamInt(name string) (int, error) {
+	value, err := m.param(name)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("route parameter: '%s' is not an integer: '%s'", name, value)
+	}
+	return result, nil
+}
+
+// ParamInt64 returns value of the named route parameter as int64.
+// It returns error if parameter does not exist or is not a valid integer.
+func (m *RouteMatch) ParamInt64(name string) (int64, error) {
+	value, err := m.param(name)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("route parameter: '%s' is not an integer: '%s'", name, value)
+	}
+	return result, nil
+}
+
+// ParamUUID returns value of the named route parameter as uuid.UUID.
+// It returns error if parameter does not exist or is not a valid UUID. E.g: {guid:uuid}
+func (m *RouteMatch) ParamUUID(name string) (uuid.UUID, error) {
+	value, err := m.param(name)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	result, err := uuid.Parse(value)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("route parameter: '%s' is not a UUID: '%s'", name, value)
+	}
+	return result, nil
+}
+
+func (m *RouteMatch) param(name string) (string, error) {
+	value, ok := m.RouteParams[name]
+	if !ok {
+		return "", fmt.Errorf("route parameter: '%s' does not exist", name)
+	}
+	return value, nil
+}
+
+// WithRequest returns a shallow copy of r whose context carries the match.
+//
+// Match can be read back from handlers via RouteMatchFromContext or RouteParamsFromContext.
+func (m *RouteMatch) WithRequest(r *http.Request) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), routeMatchKey{}, m))
+}
+
+// RouteMatchFromContext returns the match stored by RouteMatch.WithRequest. It returns nil if there is none.
+func RouteMatchFromContext(ctx context.Context) *RouteMatch {
+	match, _ := ctx.Value(routeMatchKey{}).(*RouteMatch)
+	return match
+}
+
+// RouteParamsFromContext returns route parameters of the match stored by RouteMatch.WithRequest.
+func RouteParamsFromContext(ctx context.Context) map[string]string {
+	match := RouteMatchFromContext(ctx)
+	if match == nil {
+		return nil
+	}
+	return match.RouteParams
+}
@@ -0,0 +1,232 @@
+package gmrouting
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Built-in parameter constraints which can be used as {name:constraint}.
+// Any other constraint is treated as a regular expression. E.g: {slug:[a-z-]+}
+var paramConstraints = map[string]string{
+	"int":   `-?[0-9]+`,
+	"uint":  `[0-9]+`,
+	"alpha": `[a-zA-Z]+`,
+	"alnum": `[a-zA-Z0-9]+`,
+	"uuid":  `[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`,
+}
+
+var paramNameRegexp = regexp.MustCompile(`^\w+$`)
+
+// routeParam is a curly bracket definition in a route path.
+//
+// Supported forms: {name}, {name:constraint}, {name...}
+type routeParam struct {
+	name string
+	// constraint is the definition as written in path. It is empty for unconstrained params.
+	constraint string
+	// pattern matches a whole parameter value. It is nil for unconstrained params.
+	pattern *regexp.Regexp
+	// expression is the regular expression of the value without anchors.
+	expression string
+	// wildcard params capture the rest of the path including slashes.
+	wildcard bool
+}
+
+// routePart is either a literal piece of a route path or a parameter.
+type routePart struct {
+	literal string
+	param   *routeParam
+}
+
+// parseRoute splits route path into literal and parameter parts.
+func parseRoute(path string) ([]routePart, error) {
+	parts := make([]routePart, 0)
+	literal := strings.Builder{}
+
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		if c == '}' {
+			return nil, fmt.Errorf("unexpected '}' at position %d", i)
+		}
+		if c != '{' {
+			literal.WriteByte(c)
+			continue
+		}
+
+		/* Find the matching bracket. Constraints can contain brackets themselves. E.g: {code:[0-9]{3}} */
+		depth := 0
+		end := -1
+		for j := i; j < len(path); j++ {
+			if path[j] == '{' {
+				depth++
+			} else if path[j] == '}' {
+				depth--
+				if depth == 0 {
+					end = j
+					break
+				}
+			}
+		}
+		if end == -1 {
+			return nil, fmt.Errorf("unclosed '{' at position %d", i)
+		}
+
+		param, err := parseParam(path[i+1 : end])
+		if err != nil {
+			return nil, err
+		}
+
+		if literal.Len() > 0 {
+			parts = append(parts, routePart{literal: literal.String()})
+			literal.Reset()
+		}
+		parts = append(parts, routePart{param: param})
+		i = end
+	}
+
+	if literal.Len() > 0 {
+		parts = append(parts, routePart{literal: literal.String()})
+	}
+
+	names := make(map[string]bool)
+	for i, p := range parts {
+		if p.param == nil {
+			continue
+		}
+		if names[p.param.name] {
+			return nil, fmt.Errorf("route parameter: '%s' is defined multiple times", p.param.name)
+		}
+		names[p.param.name] = true
+
+		if p.param.wildcard && i != len(parts)-1 {
+			return nil, fmt.Errorf("wildcard parameter: '%s' must be at the end of path", p.param.name)
+		}
+	}
+	return parts, nil
+}
+
+func parseParam(definition string) (*routeParam, error) {
+	if strings.HasSuffix(definition, "...") {
+		name := strings.TrimSuffix(definition, "...")
+		if !paramNameRegexp.MatchString(name) {
+			return nil, fmt.Errorf("invalid route parameter name: '%s'", name)
+		}
+		return &routeParam{
+			name:       name,
+			expression: `.+`,
+			wildcard:   true,
+		}, nil
+	}
+
+	name, constraint, hasConstraint := strings.Cut(definition, ":")
+	if !paramNameRegexp.MatchString(name) {
+		return nil, fmt.Errorf("invalid route parameter name: '%s'", name)
+	}
+	if !hasConstraint {
+		return &routeParam{
+			name:       name,
+			expression: `[^/]+`,
+		}, nil
+	}
+
+	if constraint == "" {
+		return nil, fmt.Errorf("empty constraint for route parameter: '%s'", name)
+	}
+	if strings.Contains(constraint, "/") {
+		return nil, fmt.Errorf("constraint of route parameter: '%s' can not contain '/'", name)
+	}
+
+	expression, ok := paramConstraints[constraint]
+	if !ok {
+		expression = constraint
+	}
+
+	pattern, err := regexp.Compile(`^(?:` + expression + `)$`)
+	if err != nil {
+		return nil, fmt.Errorf("invalid constraint for route parameter: '%s': %s", name, err.Error())
+	}
+	if pattern.NumSubexp() > 0 {
+		return nil, fmt.Errorf("constraint of route parameter: '%s' can not contain capturing groups", name)
+	}
+
+	return &routeParam{
+		name:       name,
+		constraint: constraint,
+		pattern:    pattern,
+		expression: expression,
+	}, nil
+}
+
+// compileRoute builds an anchored regular expression which matches the whole path.
+//
+// Parameters without a wildcard never match a slash, so `/api/transfers/{id}` does not match `/api/transfers/1/extra`.
+func compileRoute(path string) (*regexp.Regexp, error) {
+	return compileRouteCase(path, false)
+}
+
+// compileRouteCase is same as compileRoute, except static parts of path match regardless of case if foldCase is true.
+// Constraints of parameters are not affected.
+func compileRouteCase(path string, foldCase bool) (*regexp.Regexp, error) {
+	parts, err := parseRoute(path)
+	if err != nil {
+		return nil, err
+	}
+
+	regex := strings.Builder{}
+	regex.WriteString("^")
+	for _, p := range parts {
+		if p.param == nil && foldCase {
+			regex.WriteString(`(?i:` + regexp.QuoteMeta(p.literal) + `)`)
+			continue
+		}
+		if p.param == nil {
+			regex.WriteString(regexp.QuoteMeta(p.literal))
+			continue
+		}
+		regex.WriteString(`(?P<` + p.param.name + `>(?:` + p.param.expression + `))`)
+	}
+	regex.WriteString("$")
+
+	return regexp.Compile(regex.String())
+}
+
+// matchRoute matches path against a regular expression built by compileRoute and extracts route parameters.
+// It returns nil if path does not match.
+//
+// Values of parameters which are not wildcards are rejected if they contain a slash,
+// since custom constraints could otherwise match across segments.
+func matchRoute(regex *regexp.Regexp, wildcards map[string]bool, path string) map[string]string {
+	match := regex.FindStringSubmatch(path)
+	if match == nil {
+		return nil
+	}
+
+	result := make(map[string]string)
+	for i, name := range regex.SubexpNames() {
+		if i == 0 || name == "" {
+			continue
+		}
+		if !wildcards[name] && strings.Contains(match[i], "/") {
+			return nil
+		}
+		result[name] = match[i]
+	}
+	return result
+}
+
+// wildcardNames returns names of wildcard parameters in path.
+func wildcardNames(path string) map[string]bool {
+	parts, err := parseRoute(path)
+	if err != nil {
+		return nil
+	}
+
+	result := make(map[string]bool)
+	for _, p := range parts {
+		if p.param != nil && p.param.wildcard {
+			result[p.param.name] = true
+		}
+	}
+	return result
+}
@@ -0,0 +1,133 @@
+package gmrouting
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Route_Params_Constraints(t *testing.T) {
+	routeRules := []*RouteRule{
+		{Method: `GET`, Path: `/api/transfers/{name}`, DynamicPath: true},
+		{Method: `GET`, Path: `/api/transfers/{id:int}`, DynamicPath: true},
+		{Method: `GET`, Path: `/api/transfers/{guid:uuid}`, DynamicPath: true},
+		{Method: `GET`, Path: `/posts/{slug:[a-z-]+}`, DynamicPath: true},
+		{Method: `GET`, Path: `/codes/{code:[0-9]{3}}.json`, DynamicPath: true},
+		{Method: `GET`, Path: `/static/{rest...}`, DynamicPath: true},
+	}
+
+	router, err := NewRouter(routeRules)
+	assert.NoError(t, err)
+
+	type testData struct {
+		path           string
+		routeRuleIndex int
+		routeParams    map[string]string
+	}
+
+	data := []testData{
+		// Constrained parameters beat the unconstrained one regardless of registration order.
+		{path: `/api/transfers/42`, routeRuleIndex: 1, routeParams: map[string]string{"id": "42"}},
+		{path: `/api/transfers/-7`, routeRuleIndex: 1, routeParams: map[string]string{"id": "-7"}},
+		{path: `/api/transfers/6ba7b810-9dad-11d1-80b4-00c04fd430c8`, routeRuleIndex: 2, routeParams: map[string]string{"guid": "6ba7b810-9dad-11d1-80b4-00c04fd430c8"}},
+		{path: `/api/transfers/latest`, routeRuleIndex: 0, routeParams: map[string]string{"name": "latest"}},
+		{path: `/posts/hello-world`, routeRuleIndex: 3, routeParams: map[string]string{"slug": "hello-world"}},
+		{path: `/codes/404.json`, routeRuleIndex: 4, routeParams: map[string]string{"code": "404"}},
+		{path: `/static/css/site.css`, routeRuleIndex: 5, routeParams: map[string]string{"rest": "css/site.css"}},
+	}
+
+	for _, td := range data {
+		match := router.FindMatch(toHttpRequest(`GET`, td.path))
+		if assert.NotNil(t, match, td.path) {
+			assert.Equal(t, routeRules[td.routeRuleIndex], match.Rule, td.path)
+			assert.Equal(t, td.routeParams, match.RouteParams, td.path)
+		}
+	}
+
+	notFound := []string{
+		`/api/transfers/1/extra`,
+		`/posts/Hello_World`,
+		`/codes/4041.json`,
+		`/codes/404.json/extra`,
+		`/prefix/codes/404.json`,
+		`/static/`,
+	}
+	for _, path := range notFound {
+		assert.Nil(t, router.FindMatch(toHttpRequest(`GET`, path)), path)
+	}
+}
+
+func Test_Route_Params_Invalid(t *testing.T) {
+	paths := []string{
+		`/api/{id:}`,
+		`/api/{id:[0-9}`,
+		`/api/{id:(a|b)}`,
+		`/api/{id:a/b}`,
+		`/api/{id`,
+		`/api/id}`,
+		`/api/{id}/{id}`,
+		`/api/{rest...}/history`,
+		`/api/{-}`,
+	}
+
+	for _, path := range paths {
+		_, err := NewRouter([]*RouteRule{{Method: `GET`, Path: path, DynamicPath: true}})
+		assert.Error(t, err, path)
+
+		_, err = NewProxyRouteTable([]*ProxyRouteRule{NewProxyRouteRule(`GET`, path)})
+		assert.Error(t, err, path)
+	}
+}
+
+func Test_Route_Params_Proxy_Anchored(t *testing.T) {
+	table, err := NewProxyRouteTable([]*ProxyRouteRule{
+		NewProxyRouteRule(`GET`, `/api/accounts`),
+		NewProxyRouteRule(`GET`, `/api/transfers/{id:int}`),
+		NewProxyRouteRule(`GET`, `/files/{path...}`),
+	})
+	assert.NoError(t, err)
+
+	rule, routeParams := table.findRule(`GET`, `/api/transfers/42`, false)
+	assert.NotNil(t, rule)
+	assert.Equal(t, map[string]string{"id": "42"}, routeParams)
+
+	rule, routeParams = table.findRule(`GET`, `/files/a/b.txt`, false)
+	assert.NotNil(t, rule)
+	assert.Equal(t, map[string]string{"path": "a/b.txt"}, routeParams)
+
+	for _, path := range []string{`/api/transfers/1/extra`, `/api/transfers/abc`, `/api/accounts/1`, `/x/api/accounts`} {
+		rule, _ = table.findRule(`GET`, path, false)
+		assert.Nil(t, rule, path)
+	}
+}
+
+func Test_Route_Match_Typed_Params(t *testing.T) {
+	match := &RouteMatch{
+		RouteParams: map[string]string{
+			"id":   "42",
+			"guid": "6ba7b810-9dad-11d1-80b4-00c04fd430c8",
+			"name": "latest",
+		},
+	}
+
+	id, err := match.ParamInt("id")
+	assert.NoError(t, err)
+	assert.Equal(t, 42, id)
+
+	id64, err := match.ParamInt64("id")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(42), id64)
+
+	guid, err := match.ParamUUID("guid")
+	assert.NoError(t, err)
+	assert.Equal(t, "6ba7b810-9dad-11d1-80b4-00c04fd430c8", guid.String())
+
+	_, err = match.ParamInt("name")
+	assert.Error(t, err)
+
+	_, err = match.ParamUUID("name")
+	assert.Error(t, err)
+
+	_, err = match.ParamInt("missing")
+	assert.Error(t, err)
+}
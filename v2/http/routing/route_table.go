@@ -3,6 +3,7 @@ package gmrouting
 import (
 	"fmt"
 	"regexp"
+	"time"
 )
 
 type RouteTable struct {
@@ -12,31 +13,77 @@ type RouteTable struct {
 // NewProxyRouteTable checks validity of input routeRules.
 //
 // Note that rules for paths with route parameters must be defined with curly brackets.
+// Parameters can be constrained and the last segment can be a wildcard, same as RouteRule paths of Router.
 //
-// E.g: /Transfer/{guid}
+// E.g: /Transfer/{guid}, /Transfer/{id:int}, /static/{path...}
+//
+// Rules match the whole query stripped path. E.g: /Transfer/{guid} does not allow /Transfer/abc/extra
 func NewProxyRouteTable(routeRules []*ProxyRouteRule) (*RouteTable, error) {
 	table := &RouteTable{
 		routeRules: routeRules,
 	}
 
 	for _, e := range table.routeRules {
-		regexConv, err := RouteToRegExp(e.path)
+		var err error
+		e.regexp, err = compileRoute(e.path)
 		if err != nil {
-			return nil, fmt.Errorf("invalid path definition: '%s'", e.path)
+			return nil, fmt.Errorf("invalid path definition: '%s': %s", e.path, err.Error())
 		}
-
-		e.regexp, err = regexp.Compile(regexConv)
+		e.wildcards = wildcardNames(e.path)
+		e.foldRegexp, err = compileRouteCase(e.path, true)
 		if err != nil {
-			return nil, fmt.Errorf("can not compile: '%s': %s", e.path, err.Error())
+			return nil, fmt.Errorf("invalid path definition: '%s': %s", e.path, err.Error())
+		}
+
+		if e.rateLimit != nil {
+			err = e.rateLimit.validate()
+			if err != nil {
+				return nil, fmt.Errorf("invalid rate limit for: '%s': %s", e.path, err.Error())
+			}
+		}
+
+		if e.target != nil {
+			err = e.target.validate(e.regexp.SubexpNames())
+			if err != nil {
+				return nil, fmt.Errorf("invalid target for: '%s': %s", e.path, err.Error())
+			}
 		}
 	}
 	return table, nil
 }
 
+// findRule returns the first rule that allows input method and query stripped path along with its route parameters.
+// Static parts of rule paths are compared regardless of case if foldCase is true.
+// It returns nil if request is not allowed by any of the rules.
+func (t *RouteTable) findRule(method, path string, foldCase bool) (*ProxyRouteRule, map[string]string) {
+	for _, e := range t.routeRules {
+		if e.method != method {
+			continue
+		}
+
+		routeParams := e.routeParams(path, foldCase)
+		if routeParams != nil {
+			return e, routeParams
+		}
+	}
+	return nil, nil
+}
+
 type ProxyRouteRule struct {
 	method string
 	path   string
 	regexp *regexp.Regexp
+	// foldRegexp is same as regexp, except static parts of path match regardless of case.
+	foldRegexp *regexp.Regexp
+	// wildcards contains names of wildcard parameters which are allowed to match slashes.
+	wildcards map[string]bool
+	target    *ProxyTarget
+	// rateLimit overrides default limit of RateLimiter for this rule.
+	rateLimit *RateLimit
+	// doc describes the rule in OpenAPI documents.
+	doc *RouteDoc
+	// cacheTTL overrides freshness lifetime of cacheable responses. Negative value excludes the rule from response cache.
+	cacheTTL time.Duration
 }
 
 // NewProxyRouteRule creates a single entry for RouteTable.
@@ -62,3 +109,36 @@ func (rr *ProxyRouteRule) Path() string {
 func (rr *ProxyRouteRule) Regexp() regexp.Regexp {
 	return *rr.regexp
 }
+
+// Target returns redirect target overrides of the rule. It is nil for rules without overrides.
+func (rr *ProxyRouteRule) Target() *ProxyTarget {
+	return rr.target
+}
+
+// SetRateLimit overrides default limit of RateLimiter for this rule.
+// Must be called before the rule is passed to NewProxyRouteTable.
+func (rr *ProxyRouteRule) SetRateLimit(limit *RateLimit) {
+	rr.rateLimit = limit
+}
+
+func (rr *ProxyRouteRule) RateLimit() *RateLimit {
+	return rr.rateLimit
+}
+
+// SetDoc describes the rule in OpenAPI documents.
+func (rr *ProxyRouteRule) SetDoc(doc *RouteDoc) {
+	rr.doc = doc
+}
+
+func (rr *ProxyRouteRule) Doc() *RouteDoc {
+	return rr.doc
+}
+
+// routeParams extracts named route parameters of the rule from input query stripped path.
+// It returns nil if path does not match the rule.
+func (rr *ProxyRouteRule) routeParams(path string, foldCase bool) map[string]string {
+	if foldCase {
+		return matchRoute(rr.foldRegexp, rr.wildcards, path)
+	}
+	return matchRoute(rr.regexp, rr.wildcards, path)
+}
@@ -0,0 +1,244 @@
+package gmrouting
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// routeNode is a node of the segment tree which matches dynamic paths of Router.
+//
+// Precedence on each segment is deterministic: static segment beats constrained parameter,
+// constrained parameter beats unconstrained parameter, unconstrained parameter beats wildcard.
+// Constrained parameters of the same segment are tried in registration order.
+//
+// Rules which can not be represented by segments are matched via regular expressions by Router. They compete with
+// the tree match by segment ranks, so that `/files/{name}.json` beats `/files/{path...}`. See segmentRanks.
+type routeNode struct {
+	static map[string]*routeNode
+	// params match a single non-empty segment. E.g: {id:int}, {guid}
+	// Unconstrained parameter is always the last one.
+	params []*paramEdge
+	// wildcards match the rest of the path including slashes, keyed by method. E.g: {path...}
+	wildcards map[string]*routeLeaf
+	// leaves contain rules which end at this node, keyed by method.
+	leaves map[string]*routeLeaf
+}
+
+// paramEdge leads to the child node of a parameter segment.
+// Parameters with the same constraint share the same edge regardless of their names.
+type paramEdge struct {
+	constraint string
+	// pattern is nil for unconstrained parameters.
+	pattern *regexp.Regexp
+	node    *routeNode
+}
+
+type routeLeaf struct {
+	rule *RouteRule
+	// paramNames are in the order of parameter segments of the rule path.
+	paramNames []string
+}
+
+func newRouteNode() *routeNode {
+	return &routeNode{
+		static:    make(map[string]*routeNode),
+		wildcards: make(map[string]*routeLeaf),
+		leaves:    make(map[string]*routeLeaf),
+	}
+}
+
+// canInsert returns false for paths which can not be represented by segments.
+// E.g: Segments which mix static text with a parameter like `/files/{name}.json`.
+func canInsert(path string) bool {
+	for _, s := range splitPath(path) {
+		if !strings.ContainsAny(s, "{}") {
+			continue
+		}
+		parts, err := parseRoute(s)
+		if err != nil || len(parts) != 1 || parts[0].param == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// insert adds rule to the tree under input path, which is the normalized path of the rule.
+// Path must be checked via canInsert first. Static segments are stored in lower case if foldCase is true.
+func (n *routeNode) insert(rule *RouteRule, path string, foldCase bool) error {
+	segments := splitPath(path)
+	leaf := &routeLeaf{
+		rule: rule,
+	}
+
+	node := n
+	for _, s := range segments {
+		if !strings.ContainsAny(s, "{}") {
+			if foldCase {
+				s = strings.ToLower(s)
+			}
+			child := node.static[s]
+			if child == nil {
+				child = newRouteNode()
+				node.static[s] = child
+			}
+			node = child
+			continue
+		}
+
+		parts, err := parseRoute(s)
+		if err != nil {
+			return err
+		}
+		param := parts[0].param
+		leaf.paramNames = append(leaf.paramNames, param.name)
+
+		if param.wildcard {
+			return node.setLeaf(node.wildcards, rule.Method, leaf)
+		}
+		node = node.paramChild(param)
+	}
+
+	return node.setLeaf(node.leaves, rule.Method, leaf)
+}
+
+// paramChild returns the child node for input parameter, creating it if needed.
+func (n *routeNode) paramChild(param *routeParam) *routeNode {
+	for _, e := range n.params {
+		if e.constraint == param.constraint {
+			return e.node
+		}
+	}
+
+	edge := &paramEdge{
+		constraint: param.constraint,
+		pattern:    param.pattern,
+		node:       newRouteNode(),
+	}
+
+	/* Keep unconstrained parameter at the end. */
+	last := len(n.params) - 1
+	if param.pattern != nil && last >= 0 && n.params[last].pattern == nil {
+		n.params = append(n.params[:last], edge, n.params[last])
+	} else {
+		n.params = append(n.params, edge)
+	}
+	return edge.node
+}
+
+func (n *routeNode) setLeaf(leaves map[string]*routeLeaf, method string, leaf *routeLeaf) error {
+	existing := leaves[method]
+	if existing != nil {
+		return fmt.Errorf("path: '%s' conflicts with path: '%s' for method: '%s'", leaf.rule.Path, existing.rule.Path, method)
+	}
+	leaves[method] = leaf
+	return nil
+}
+
+// match finds the leaf for input path segments and method.
+// It backtracks to lower precedence branches if a higher precedence branch has no rule for the method.
+// Static segments are compared in lower case if foldCase is true. Parameter values keep their case.
+func (n *routeNode) match(segments []string, method string, values []string, foldCase bool) (*routeLeaf, []string) {
+	if len(segments) == 0 {
+		leaf := n.leaves[method]
+		if leaf == nil {
+			return nil, nil
+		}
+		return leaf, values
+	}
+
+	s := segments[0]
+
+	staticKey := s
+	if foldCase {
+		staticKey = strings.ToLower(s)
+	}
+	child := n.static[staticKey]
+	if child != nil {
+		leaf, found := child.match(segments[1:], method, values, foldCase)
+		if leaf != nil {
+			return leaf, found
+		}
+	}
+
+	if s != "" {
+		for _, e := range n.params {
+			if e.pattern != nil && !e.pattern.MatchString(s) {
+				continue
+			}
+			leaf, found := e.node.match(segments[1:], method, append(values, s), foldCase)
+			if leaf != nil {
+				return leaf, found
+			}
+		}
+	}
+
+	leaf := n.wildcards[method]
+	if leaf != nil {
+		rest := strings.Join(segments, "/")
+		if rest != "" {
+			return leaf, append(values, rest)
+		}
+	}
+
+	return nil, nil
+}
+
+// params maps matched values to parameter names of the leaf.
+func (l *routeLeaf) params(values []string) map[string]string {
+	result := make(map[string]string, len(values))
+	for i, name := range l.paramNames {
+		result[name] = values[i]
+	}
+	return result
+}
+
+// splitPath splits path into segments ignoring the leading slash.
+//
+// E.g: `/api/transfers/` will result in ["api", "transfers", ""].
+func splitPath(path string) []string {
+	return strings.Split(strings.TrimPrefix(path, "/"), "/")
+}
+
+// Ranks of path segments. A higher rank is more specific.
+const (
+	segmentWildcard = iota
+	segmentParam
+	segmentConstrained
+	// segmentMixed mixes static text with parameters. E.g: {name}.json
+	segmentMixed
+	segmentStatic
+)
+
+// segmentRanks returns the rank of each segment of a dynamic rule path.
+func segmentRanks(path string) []int {
+	segments := splitPath(path)
+	ranks := make([]int, len(segments))
+	for i, s := range segments {
+		parts, err := parseRoute(s)
+		switch {
+		case err != nil || !strings.ContainsAny(s, "{}"):
+			ranks[i] = segmentStatic
+		case parts[len(parts)-1].param != nil && parts[len(parts)-1].param.wildcard:
+			ranks[i] = segmentWildcard
+		case len(parts) > 1:
+			ranks[i] = segmentMixed
+		case parts[0].param.pattern != nil:
+			ranks[i] = segmentConstrained
+		default:
+			ranks[i] = segmentParam
+		}
+	}
+	return ranks
+}
+
+// moreSpecific returns true if ranks a are higher than ranks b at the first segment where they differ.
+// Same ranks are not more specific.
+func moreSpecific(a, b []int) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return a[i] > b[i]
+		}
+	}
+	return false
+}
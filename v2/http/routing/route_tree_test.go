@@ -0,0 +1,162 @@
+package gmrouting
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Route_Tree_Precedence(t *testing.T) {
+	routeRules := []*RouteRule{
+		// Registration order is intentionally reversed to show it does not affect precedence.
+		{Method: `GET`, Path: `/api/{path...}`, DynamicPath: true},
+		{Method: `GET`, Path: `/api/transfers/{id}`, DynamicPath: true},
+		{Method: `GET`, Path: `/api/transfers/latest`, DynamicPath: true},
+		{Method: `POST`, Path: `/api/transfers/latest/{action}`, DynamicPath: true},
+		{Method: `GET`, Path: `/api/{entity}/{id}/history`, DynamicPath: true},
+		{Method: `GET`, Path: `/files/{name}.json`, DynamicPath: true},
+	}
+
+	router, err := NewRouter(routeRules)
+	assert.NoError(t, err)
+
+	type testData struct {
+		method         string
+		path           string
+		routeRuleIndex int
+		routeParams    map[string]string
+	}
+
+	data := []testData{
+		{method: `GET`, path: `/api/transfers/latest`, routeRuleIndex: 2, routeParams: map[string]string{}},
+		{method: `GET`, path: `/api/transfers/42`, routeRuleIndex: 1, routeParams: map[string]string{"id": "42"}},
+		{method: `POST`, path: `/api/transfers/latest/cancel`, routeRuleIndex: 3, routeParams: map[string]string{"action": "cancel"}},
+		// Static branch "transfers" has no history rule, matcher backtracks to parameter branch.
+		{method: `GET`, path: `/api/transfers/42/history`, routeRuleIndex: 4, routeParams: map[string]string{"entity": "transfers", "id": "42"}},
+		{method: `GET`, path: `/api/transfers/42/unknown`, routeRuleIndex: 0, routeParams: map[string]string{"path": "transfers/42/unknown"}},
+		{method: `GET`, path: `/files/report.json`, routeRuleIndex: 5, routeParams: map[string]string{"name": "report"}},
+	}
+
+	for _, td := range data {
+		match := router.FindMatch(toHttpRequest(td.method, td.path))
+		assert.Equal(t, routeRules[td.routeRuleIndex], match.Rule, td.path)
+		assert.Equal(t, td.routeParams, match.RouteParams, td.path)
+	}
+
+	assert.Nil(t, router.FindMatch(toHttpRequest(`DELETE`, `/api/transfers/42`)))
+	assert.Nil(t, router.FindMatch(toHttpRequest(`GET`, `/api`)))
+}
+
+func Test_Router_Regex_Precedence(t *testing.T) {
+	routeRules := []*RouteRule{
+		{Method: `GET`, Path: `/files/{path...}`, DynamicPath: true},
+		{Method: `GET`, Path: `/files/{id:int}`, DynamicPath: true},
+		{Method: `GET`, Path: `/files/{name}.json`, DynamicPath: true},
+		{Method: `GET`, Path: `/files/{name}.{ext}`, DynamicPath: true},
+		{Method: `GET`, Path: `/files/{dir}/{name}.json`, DynamicPath: true},
+		{Method: `GET`, Path: `/files/shared/{path...}`, DynamicPath: true},
+	}
+
+	router, err := NewRouter(routeRules)
+	assert.NoError(t, err)
+
+	type testData struct {
+		path           string
+		routeRuleIndex int
+		routeParams    map[string]string
+	}
+
+	data := []testData{
+		{path: `/files/report.json`, routeRuleIndex: 2, routeParams: map[string]string{"name": "report"}},
+		{path: `/files/42`, routeRuleIndex: 1, routeParams: map[string]string{"id": "42"}},
+		{path: `/files/report`, routeRuleIndex: 0, routeParams: map[string]string{"path": "report"}},
+		// Mixed segments of the same rank are tried in registration order.
+		{path: `/files/report.txt`, routeRuleIndex: 3, routeParams: map[string]string{"name": "report", "ext": "txt"}},
+		{path: `/files/2024/report.json`, routeRuleIndex: 4, routeParams: map[string]string{"dir": "2024", "name": "report"}},
+		// Static segment of the tree beats the parameter of a regex rule.
+		{path: `/files/shared/report.json`, routeRuleIndex: 5, routeParams: map[string]string{"path": "report.json"}},
+		{path: `/files/2024/q1/report.json`, routeRuleIndex: 0, routeParams: map[string]string{"path": "2024/q1/report.json"}},
+	}
+
+	for _, td := range data {
+		match := router.FindMatch(toHttpRequest(`GET`, td.path))
+		assert.Equal(t, routeRules[td.routeRuleIndex], match.Rule, td.path)
+		assert.Equal(t, td.routeParams, match.RouteParams, td.path)
+	}
+}
+
+func Test_Route_Tree_Conflict(t *testing.T) {
+	_, err := NewRouter([]*RouteRule{
+		{Method: `GET`, Path: `/api/transfers/{id}`, DynamicPath: true},
+		{Method: `GET`, Path: `/api/transfers/{guid}`, DynamicPath: true},
+	})
+	assert.Error(t, err)
+}
+
+const benchmarkRouteCount = 500
+
+func benchmarkRouteRules() []*RouteRule {
+	routeRules := make([]*RouteRule, 0, benchmarkRouteCount)
+	for i := 0; i < benchmarkRouteCount; i++ {
+		routeRules = append(routeRules, &RouteRule{
+			Method:      `GET`,
+			Path:        fmt.Sprintf(`/api/resource%d/{id}/items/{item}`, i),
+			DynamicPath: true,
+		})
+	}
+	return routeRules
+}
+
+func Benchmark_Router_Tree(b *testing.B) {
+	router, err := NewRouter(benchmarkRouteRules())
+	if err != nil {
+		b.Fatal(err)
+	}
+	req := toHttpRequest(`GET`, fmt.Sprintf(`/api/resource%d/12345/items/abc`, benchmarkRouteCount-1))
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if router.FindMatch(req) == nil {
+			b.Fatal("no match")
+		}
+	}
+}
+
+// Benchmark_Router_Regex_Loop measures the previous matching strategy which runs every dynamic rule's regex in order.
+func Benchmark_Router_Regex_Loop(b *testing.B) {
+	routeRules := benchmarkRouteRules()
+	regexes := make([]*regexp.Regexp, len(routeRules))
+	for i, r := range routeRules {
+		regexConv, err := RouteToRegExp(r.Path)
+		if err != nil {
+			b.Fatal(err)
+		}
+		regexes[i] = regexp.MustCompile(regexConv)
+	}
+	req := toHttpRequest(`GET`, fmt.Sprintf(`/api/resource%d/12345/items/abc`, benchmarkRouteCount-1))
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		path := strings.Split(req.URL.RequestURI(), "?")[0]
+		found := false
+		for j, reg := range regexes {
+			if reg.MatchString(path) && routeRules[j].Method == req.Method {
+				match := reg.FindStringSubmatch(path)
+				result := make(map[string]string)
+				for k, name := range reg.SubexpNames() {
+					if k != 0 && name != "" {
+						result[name] = match[k]
+					}
+				}
+				found = true
+				break
+			}
+		}
+		if !found {
+			b.Fatal("no match")
+		}
+	}
+}
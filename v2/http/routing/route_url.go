@@ -0,0 +1,101 @@
+package gmrouting
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// URLFor builds the url of the rule registered with input name.
+// FindMatch of the built url returns the same rule, along with escaped forms of input routeParams
+// since Router keeps route parameter values escaped.
+//
+// Every route parameter of the rule path must be supplied in routeParams and satisfy its constraint.
+// Values are path escaped, wildcard values are escaped segment by segment. query is optional.
+// Constraints are checked against escaped values, as FindMatch does. E.g: `hello world` satisfies
+// `{slug:[a-z%0-9]+}`, but not `{slug:[a-z ]+}`.
+//
+// E.g: For rule path `/Transfer/{id:int}`, URLFor("transfer", map[string]string{"id": "42"}, url.Values{"expand": {"true"}})
+// will result in `/Transfer/42?expand=true`.
+func (sr *Router) URLFor(name string, routeParams map[string]string, query url.Values) (string, error) {
+	rule := sr.namedRules[name]
+	if rule == nil {
+		return "", fmt.Errorf("no route is registered with name: '%s'", name)
+	}
+
+	path := rule.Path
+	if rule.DynamicPath {
+		var err error
+		path, err = buildPath(rule.Path, routeParams)
+		if err != nil {
+			return "", fmt.Errorf("can not build url for: '%s': %s", name, err.Error())
+		}
+	} else if len(routeParams) > 0 {
+		return "", fmt.Errorf("can not build url for: '%s': static path does not have route parameters", name)
+	}
+
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	return path, nil
+}
+
+// buildPath fills route parameters of path definition with input values.
+func buildPath(definition string, routeParams map[string]string) (string, error) {
+	parts, err := parseRoute(definition)
+	if err != nil {
+		return "", err
+	}
+
+	used := make(map[string]bool, len(routeParams))
+	result := strings.Builder{}
+	for _, p := range parts {
+		if p.param == nil {
+			result.WriteString(p.literal)
+			continue
+		}
+
+		value, ok := routeParams[p.param.name]
+		if !ok || value == "" {
+			return "", fmt.Errorf("missing route parameter: '%s'", p.param.name)
+		}
+		used[p.param.name] = true
+
+		if p.param.wildcard {
+			result.WriteString(escapeSegments(value))
+			continue
+		}
+
+		if strings.Contains(value, "/") {
+			return "", fmt.Errorf("route parameter: '%s' can not contain '/': '%s'", p.param.name, value)
+		}
+		escaped := url.PathEscape(value)
+		if p.param.pattern != nil && !p.param.pattern.MatchString(escaped) {
+			return "", fmt.Errorf("route parameter: '%s' does not satisfy constraint: '%s': '%s'", p.param.name, p.param.constraint, escaped)
+		}
+		result.WriteString(escaped)
+	}
+
+	unknown := make([]string, 0)
+	for name := range routeParams {
+		if !used[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return "", fmt.Errorf("unknown route parameters: '%s'", strings.Join(unknown, "', '"))
+	}
+
+	return result.String(), nil
+}
+
+// escapeSegments path escapes each segment of input value while keeping slashes.
+func escapeSegments(value string) string {
+	segments := strings.Split(value, "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	return strings.Join(segments, "/")
+}
@@ -0,0 +1,81 @@
+package gmrouting
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Router_URLFor(t *testing.T) {
+	api := NewRouteGroup("/api", nil)
+	api.Add(
+		&RouteRule{Name: "accounts", Method: `GET`, Path: `/accounts`},
+		&RouteRule{Name: "transfer", Method: `GET`, Path: `/transfers/{id:int}`, DynamicPath: true},
+		&RouteRule{Name: "post", Method: `GET`, Path: `/posts/{slug}`, DynamicPath: true},
+		&RouteRule{Name: "file", Method: `GET`, Path: `/files/{path...}`, DynamicPath: true},
+		&RouteRule{Name: "tag", Method: `GET`, Path: `/tags/{name:[a-z%0-9]+}`, DynamicPath: true},
+		&RouteRule{Name: "label", Method: `GET`, Path: `/labels/{name:[a-z ]+}`, DynamicPath: true},
+	)
+
+	router, err := NewRouter(api.Rules())
+	assert.NoError(t, err)
+
+	type testData struct {
+		name        string
+		routeParams map[string]string
+		query       url.Values
+		expected    string
+	}
+
+	data := []testData{
+		{name: "accounts", expected: `/api/accounts`},
+		{name: "accounts", query: url.Values{"page": {"2"}, "size": {"10"}}, expected: `/api/accounts?page=2&size=10`},
+		{name: "transfer", routeParams: map[string]string{"id": "42"}, expected: `/api/transfers/42`},
+		{name: "post", routeParams: map[string]string{"slug": "hello world"}, expected: `/api/posts/hello%20world`},
+		{name: "post", routeParams: map[string]string{"slug": "100%"}, expected: `/api/posts/100%25`},
+		{name: "file", routeParams: map[string]string{"path": "css/site main.css"}, expected: `/api/files/css/site%20main.css`},
+		{name: "tag", routeParams: map[string]string{"name": "hello world"}, expected: `/api/tags/hello%20world`},
+	}
+
+	for _, td := range data {
+		built, err := router.URLFor(td.name, td.routeParams, td.query)
+		assert.NoError(t, err, td.name)
+		assert.Equal(t, td.expected, built, td.name)
+
+		/* Built url must match the same rule with the same parameters, which are kept escaped by Router. */
+		match := router.FindMatch(httptest.NewRequest(`GET`, built, nil))
+		if assert.NotNil(t, match, built) {
+			assert.Equal(t, td.name, match.Rule.Name)
+			assert.Len(t, match.RouteParams, len(td.routeParams))
+			for name, value := range td.routeParams {
+				unescaped, err := url.PathUnescape(match.RouteParams[name])
+				assert.NoError(t, err)
+				assert.Equal(t, value, unescaped, name)
+			}
+		}
+	}
+
+	invalid := []testData{
+		{name: "unknown"},
+		{name: "transfer"},
+		{name: "transfer", routeParams: map[string]string{"id": "abc"}},
+		{name: "transfer", routeParams: map[string]string{"id": "42", "extra": "1"}},
+		{name: "post", routeParams: map[string]string{"slug": "a/b"}},
+		// Escaped value does not satisfy the constraint, so FindMatch would not match the built url.
+		{name: "label", routeParams: map[string]string{"name": "hello world"}},
+		{name: "accounts", routeParams: map[string]string{"id": "42"}},
+	}
+
+	for _, td := range invalid {
+		_, err := router.URLFor(td.name, td.routeParams, td.query)
+		assert.Error(t, err, td.name)
+	}
+
+	_, err = NewRouter([]*RouteRule{
+		{Name: "accounts", Method: `GET`, Path: `/accounts`},
+		{Name: "accounts", Method: `POST`, Path: `/accounts`},
+	})
+	assert.Error(t, err)
+}
@@ -5,122 +5,239 @@ import (
 	"net/http"
 	"regexp"
 	"strings"
+
+	gmhttp "github.com/onuryurdupak/gomod/v2/http"
 )
 
 type Router struct {
 	// Contains static path definitions in mapping as follows: QueryStrippedPath -> Method -> *RouteRule
 	staticPaths map[string]map[string]*RouteRule
 	// Contains dynamic path definitions which have named route parameters in them.
-	dynamicPaths []*RouteRule
-	// Contains all route rules as key: path, value: method pairs.
+	dynamicTree *routeNode
+	// Contains dynamic path definitions which can not be represented by segments. They are matched via regular expressions.
+	// E.g: `/files/{name}.json`
+	regexPaths []*RouteRule
+	// Contains all route rules in mapping as follows: Path -> Method -> exists
 	// Meant to be used for checking duplicates during initialization.
-	allPaths map[string]string
+	allPaths map[string]map[string]bool
+	// Contains route rules in registration order. Meant to be used for mounting router into a RouteGroup.
+	routeRules []*RouteRule
+	// Contains all registered methods. Meant to be used for building Allow header of 405 responses.
+	methods map[string]bool
+	// Contains route rules which have a name in mapping as follows: Name -> *RouteRule
+	// Meant to be used for building urls via URLFor.
+	namedRules map[string]*RouteRule
+	// normalizer is applied to request paths before matching. Rules are indexed according to it.
+	normalizer *PathNormalizer
+
+	responseWriter responseWriter
+	rateLimiter    *RateLimiter
+	middlewares    []Middleware
 }
 
 // NewRouter creates http router from input routeRules.
 //
+// Router can be used as a http.Handler, or for matching requests manually via FindMatch.
+// Request paths are normalized via DefaultPathNormalizer before matching. See SetPathNormalizer.
+//
 // It will return error upon invalid data.
 func NewRouter(routeRules []*RouteRule) (*Router, error) {
 	router := &Router{
-		staticPaths:  make(map[string]map[string]*RouteRule, len(routeRules)),
-		dynamicPaths: make([]*RouteRule, 0, len(routeRules)),
-		allPaths:     make(map[string]string, len(routeRules)),
+		routeRules: routeRules,
+		normalizer: DefaultPathNormalizer(),
+
+		responseWriter: gmhttp.NewResponseWriter(),
+	}
+
+	err := router.build()
+	if err != nil {
+		return nil, err
+	}
+	return router, nil
+}
+
+// SetPathNormalizer replaces the normalizer which is applied to request paths before matching.
+// Nil normalizer matches raw escaped paths.
+//
+// Rules are indexed again according to the trailing slash policy and case sensitivity of the normalizer.
+// It returns error if rules conflict with each other under input normalizer, in which case the previous one is kept.
+//
+// It should be called before router starts serving requests.
+func (sr *Router) SetPathNormalizer(normalizer *PathNormalizer) error {
+	previous := sr.normalizer
+	sr.normalizer = normalizer
+
+	err := sr.build()
+	if err != nil {
+		sr.normalizer = previous
+		_ = sr.build()
+		return err
 	}
+	return nil
+}
+
+// build validates route rules and indexes them according to the normalizer of router.
+func (sr *Router) build() error {
+	sr.staticPaths = make(map[string]map[string]*RouteRule, len(sr.routeRules))
+	sr.dynamicTree = newRouteNode()
+	sr.regexPaths = make([]*RouteRule, 0)
+	sr.allPaths = make(map[string]map[string]bool, len(sr.routeRules))
+	sr.methods = make(map[string]bool)
+	sr.namedRules = make(map[string]*RouteRule)
 
-	for _, r := range routeRules {
-		path, ok := router.allPaths[r.Path]
-		if ok && path == r.Method {
-			return nil, fmt.Errorf("path: '%s' is registered multiple times to method: '%s'", r.Path, r.Method)
+	foldCase := sr.normalizer.foldCase()
+
+	for _, r := range sr.routeRules {
+		if r.RateLimit != nil {
+			err := r.RateLimit.validate()
+			if err != nil {
+				return fmt.Errorf("path: '%s' method: '%s': %s", r.Path, r.Method, err.Error())
+			}
 		}
-		router.allPaths[r.Path] = r.Method
 
+		path := sr.normalizer.normalizeRule(r.Path)
 		if !r.DynamicPath {
-			if router.staticPaths[r.Path] == nil {
-				router.staticPaths[r.Path] = make(map[string]*RouteRule)
+			path = sr.staticKey(path)
+		}
+
+		if sr.allPaths[path][r.Method] {
+			return fmt.Errorf("path: '%s' is registered multiple times to method: '%s'", r.Path, r.Method)
+		}
+		if sr.allPaths[path] == nil {
+			sr.allPaths[path] = make(map[string]bool)
+		}
+		sr.allPaths[path][r.Method] = true
+		sr.methods[r.Method] = true
+
+		if r.Name != "" {
+			if sr.namedRules[r.Name] != nil {
+				return fmt.Errorf("name: '%s' is registered multiple times", r.Name)
 			}
+			sr.namedRules[r.Name] = r
+		}
 
-			router.staticPaths[r.Path][r.Method] = r
-		} else {
-			regexConv, err := RouteToRegExp(r.Path)
-			if err != nil {
-				return nil, fmt.Errorf("invalid path definition: '%s'", r.Path)
+		if !r.DynamicPath {
+			if sr.staticPaths[path] == nil {
+				sr.staticPaths[path] = make(map[string]*RouteRule)
 			}
 
-			compiled, err := regexp.Compile(regexConv)
+			sr.staticPaths[path][r.Method] = r
+			continue
+		}
+
+		compiled, err := compileRouteCase(path, foldCase)
+		if err != nil {
+			return fmt.Errorf("invalid path definition: '%s': %s", r.Path, err.Error())
+		}
+		r.ranks = segmentRanks(path)
+		r.regex = compiled
+		r.wildcards = wildcardNames(path)
+
+		if canInsert(path) {
+			err = sr.dynamicTree.insert(r, path, foldCase)
 			if err != nil {
-				return nil, fmt.Errorf("unable parse dynamic path: '%s' error: %s", r.Path, err.Error())
+				return err
 			}
-			r.regex = compiled
-			router.dynamicPaths = append(router.dynamicPaths, r)
+		} else {
+			sr.regexPaths = append(sr.regexPaths, r)
 		}
 
 	}
-	return router, nil
+	return nil
 }
 
 // FindMatch can be used inside a http.Handle() to check if incoming request matches with any of the routing rules.
-// It returns routeTo func of the match.
-// It also extracts and returns route parameters from curly bracket definitions.
+// It returns the matched rule along with route parameters extracted from curly bracket definitions.
+// It returns nil if request does not match any rule.
 //
 // E.g: Input path: `/Transfer/{guid}`
 //
-// Request: `/Transfer/abcdef` will register as "guid"="abcdef" to routeParams.
-func (sr *Router) FindMatch(r *http.Request) *RouteRule {
-	queryStrippedPath := strings.Split(r.URL.RequestURI(), "?")[0]
-	staticPathRecord := sr.staticPaths[queryStrippedPath]
-	if staticPathRecord != nil {
-		staticRouteRule, ok := staticPathRecord[r.Method]
-		if ok {
-			return staticRouteRule
-		}
+// Request: `/Transfer/abcdef` will register as "guid"="abcdef" to RouteParams of the match.
+//
+// Escaped path of the request is normalized first. Route parameter values are kept escaped,
+// e.g. `hello%20world`, which can be decoded via url.PathUnescape. (ProxyClient passes them decoded instead.)
+//
+// Static paths are matched first. Dynamic paths are matched segment by segment where a static segment
+// beats a segment which mixes static text with parameters (`{name}.json`), which beats a constrained parameter.
+// A constrained parameter beats an unconstrained one and an unconstrained parameter beats a wildcard (`{path...}`).
+//
+// FindMatch is safe for concurrent use. Use RouteMatch.WithRequest to pass the match to handlers via request context.
+func (sr *Router) FindMatch(r *http.Request) *RouteMatch {
+	rule, routeParams := sr.find(r.Method, sr.normalizer.Normalize(r.URL.EscapedPath()))
+	if rule == nil {
+		return nil
 	}
-
-	for _, v := range sr.dynamicPaths {
-		matchDynamicPath := v.regex.MatchString(queryStrippedPath)
-		if matchDynamicPath && v.Method == r.Method {
-			result := make(map[string]string)
-			match := v.regex.FindStringSubmatch(queryStrippedPath)
-			for i, name := range v.regex.SubexpNames() {
-				if i != 0 && name != "" {
-					result[name] = match[i]
-				}
-			}
-
-			v.routeParams = result
-			return v
-		}
+	if routeParams == nil {
+		routeParams = make(map[string]string)
+	}
+	return &RouteMatch{
+		Rule:        rule,
+		RouteParams: routeParams,
 	}
-
-	return nil
 }
 
 // HasMatch returns true if input request matches with any of the registered routed rules.
 func (sr *Router) HasMatch(r *http.Request) bool {
-	queryStrippedPath := strings.Split(r.URL.RequestURI(), "?")[0]
-	staticPathRecord := sr.staticPaths[queryStrippedPath]
+	rule, _ := sr.find(r.Method, sr.normalizer.Normalize(r.URL.EscapedPath()))
+	return rule != nil
+}
+
+// find returns the rule matching input method and normalized query stripped path along with its route parameters.
+// Route parameters are nil for static paths.
+func (sr *Router) find(method, queryStrippedPath string) (*RouteRule, map[string]string) {
+	foldCase := sr.normalizer.foldCase()
+
+	staticPathRecord := sr.staticPaths[sr.staticKey(queryStrippedPath)]
 	if staticPathRecord != nil {
-		_, ok := staticPathRecord[r.Method]
+		staticRouteRule, ok := staticPathRecord[method]
 		if ok {
-			return true
+			return staticRouteRule, nil
 		}
 	}
 
-	for _, v := range sr.dynamicPaths {
-		matchDynamicPath := v.regex.MatchString(queryStrippedPath)
-		if matchDynamicPath && v.Method == r.Method {
-			result := make(map[string]string)
-			match := v.regex.FindStringSubmatch(queryStrippedPath)
-			for i, name := range v.regex.SubexpNames() {
-				if i != 0 && name != "" {
-					result[name] = match[i]
-				}
-			}
+	var best *RouteRule
+	var bestParams map[string]string
+
+	leaf, values := sr.dynamicTree.match(splitPath(queryStrippedPath), method, nil, foldCase)
+	if leaf != nil {
+		best, bestParams = leaf.rule, leaf.params(values)
+	}
 
-			return true
+	/* Regex rules replace the current match only if they are more specific. Ties keep the earlier one. */
+	for _, v := range sr.regexPaths {
+		if v.Method != method || best != nil && !moreSpecific(v.ranks, best.ranks) {
+			continue
+		}
+
+		result := matchRoute(v.regex, v.wildcards, queryStrippedPath)
+		if result != nil {
+			best, bestParams = v, result
 		}
 	}
 
-	return false
+	return best, bestParams
+}
+
+// staticKey returns the key of normalized path in static paths, which is in lower case if normalizer folds case.
+func (sr *Router) staticKey(path string) string {
+	if sr.normalizer.foldCase() {
+		return strings.ToLower(path)
+	}
+	return path
+}
+
+// matchRule matches normalized query stripped path against a single rule regardless of method and precedence.
+// It returns nil if path does not match, route parameters are empty for static paths.
+//
+// Matching a rule alone gives the same result as FindMatch, since tree matches a single rule like its regular expression.
+func (sr *Router) matchRule(r *RouteRule, queryStrippedPath string) map[string]string {
+	if r.DynamicPath {
+		return matchRoute(r.regex, r.wildcards, queryStrippedPath)
+	}
+	if sr.staticKey(sr.normalizer.normalizeRule(r.Path)) != sr.staticKey(queryStrippedPath) {
+		return nil
+	}
+	return make(map[string]string)
 }
 
 // RouteRule is used for registering rules to Router.
@@ -129,9 +246,23 @@ func (sr *Router) HasMatch(r *http.Request) bool {
 //
 // Example path:  `/Transfer/{guid}`
 //
+// Route parameters can be constrained. Requests whose values do not satisfy the constraint do not match the rule.
+// Built-in constraints are int, uint, alpha, alnum and uuid. Any other constraint is used as a regular expression
+// which must match the whole value.
+//
+// Example paths:  `/Transfer/{id:int}`, `/Transfer/{guid:uuid}`, `/Post/{slug:[a-z-]+}`
+//
+// The last segment of a dynamic path can be a wildcard which captures the rest of the path including slashes.
+//
+// Example path:  `/static/{path...}`
+//
+// Paths are matched as a whole. Parameters other than wildcards never match a slash.
+//
 // Query parameters in a url are ignored during checking.
 // Therefore, request paths that have query parameters in it (but have no route parameters) should be registered as DynamicPath=false.
 type RouteRule struct {
+	// Name is optional. Named rules can be used for building urls via Router.URLFor.
+	Name   string
 	Method string
 	Path   string
 	// DynamicPath should be set to true if endpoint has route parameters in it.
@@ -139,12 +270,16 @@ type RouteRule struct {
 	DynamicPath bool
 	AuthWith    func(w http.ResponseWriter, r *http.Request) error
 	RouteTo     func(w http.ResponseWriter, r *http.Request, routeParams map[string]string)
+	// RateLimit overrides default limit of RateLimiter for this rule. It is optional.
+	RateLimit *RateLimit
+	// Middlewares wrap RouteTo of this rule when Router is used as http.Handler. First one runs first.
+	Middlewares []Middleware
+	// Doc describes the rule in OpenAPI documents. It is optional.
+	Doc *RouteDoc
 
-	regex *regexp.Regexp
-
-	routeParams map[string]string
-}
-
-func (r *RouteRule) GetRouteParams() map[string]string {
-	return r.routeParams
+	// regex matches normalized path of a dynamic rule. Rules in dynamic tree are matched by it only for explaining requests.
+	regex     *regexp.Regexp
+	wildcards map[string]bool
+	// ranks are segment ranks of dynamic path, used for picking the most specific match.
+	ranks []int
 }
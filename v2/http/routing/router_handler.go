@@ -0,0 +1,115 @@
+package gmrouting
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+var (
+	// ErrUnauthorized can be returned from RouteRule.AuthWith to respond with 401. It is the default for any other error.
+	ErrUnauthorized = errors.New("unauthorized")
+	// ErrForbidden can be returned (or wrapped) from RouteRule.AuthWith to respond with 403.
+	ErrForbidden = errors.New("forbidden")
+)
+
+// SetResponseWriter replaces the writer which is used for JSON error responses of ServeHTTP.
+func (sr *Router) SetResponseWriter(responseWriter responseWriter) {
+	sr.responseWriter = responseWriter
+}
+
+// SetRateLimiter makes ServeHTTP respond with 429 to requests which exceed their rate limit.
+func (sr *Router) SetRateLimiter(rateLimiter *RateLimiter) {
+	sr.rateLimiter = rateLimiter
+}
+
+// ServeHTTP lets Router be registered to http.Handle() directly.
+//
+// Matched requests are checked with AuthWith of the rule before RouteTo is called.
+// AuthWith errors result in 401, or 403 if error is ErrForbidden.
+//
+// Requests with no matching path result in 404.
+// Requests with a matching path but another method result in 405 with an Allow header.
+// Requests with a trailing slash are redirected if normalizer of router has TrailingSlashRedirect policy
+// and the path without the slash matches.
+//
+// Match is also passed to middlewares and RouteTo via request context. See RouteMatchFromContext.
+func (sr *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var handler http.Handler = http.HandlerFunc(sr.serveNoMatch)
+
+	match := sr.FindMatch(r)
+	if match != nil {
+		r = match.WithRequest(r)
+		handler = chain(http.HandlerFunc(sr.serveMatch), match.Rule.Middlewares)
+	}
+
+	chain(handler, sr.middlewares).ServeHTTP(w, r)
+}
+
+func (sr *Router) serveMatch(w http.ResponseWriter, r *http.Request) {
+	match := RouteMatchFromContext(r.Context())
+
+	if sr.rateLimiter != nil && !sr.rateLimiter.AllowMatch(w, r, match) {
+		return
+	}
+
+	if match.Rule.AuthWith != nil {
+		err := match.Rule.AuthWith(w, r)
+		if errors.Is(err, ErrForbidden) {
+			sr.writeMessage(w, http.StatusForbidden, "forbidden")
+			return
+		}
+		if err != nil {
+			sr.writeMessage(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+	}
+
+	if match.Rule.RouteTo == nil {
+		sr.writeMessage(w, http.StatusNotImplemented, "not implemented")
+		return
+	}
+
+	match.Rule.RouteTo(w, r, match.RouteParams)
+}
+
+func (sr *Router) serveNoMatch(w http.ResponseWriter, r *http.Request) {
+	path := sr.normalizer.Normalize(r.URL.EscapedPath())
+
+	target, redirect := sr.normalizer.redirectTarget(path)
+	if redirect {
+		rule, _ := sr.find(r.Method, target)
+		if rule != nil {
+			writeRedirect(w, r, target)
+			return
+		}
+	}
+
+	allowed := sr.allowedMethods(path)
+	if len(allowed) > 0 {
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		sr.writeMessage(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	sr.writeMessage(w, http.StatusNotFound, "not found")
+}
+
+// allowedMethods returns sorted methods of the rules matching input query stripped path.
+func (sr *Router) allowedMethods(queryStrippedPath string) []string {
+	allowed := make([]string, 0)
+	for method := range sr.methods {
+		rule, _ := sr.find(method, queryStrippedPath)
+		if rule != nil {
+			allowed = append(allowed, method)
+		}
+	}
+	sort.Strings(allowed)
+	return allowed
+}
+
+func (sr *Router) writeMessage(w http.ResponseWriter, statusCode int, message string) {
+	sr.responseWriter.WriteCustomJsonResponse(w, statusCode, map[string]interface{}{
+		"message": message,
+	})
+}
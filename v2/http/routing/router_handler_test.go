@@ -0,0 +1,62 @@
+package gmrouting
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Router_ServeHTTP(t *testing.T) {
+	routeTo := func(w http.ResponseWriter, r *http.Request, routeParams map[string]string) {
+		fmt.Fprintf(w, "%s %s", r.Method, routeParams["id"])
+	}
+	authWith := func(w http.ResponseWriter, r *http.Request) error {
+		switch r.Header.Get("Authorization") {
+		case "":
+			return ErrUnauthorized
+		case "guest":
+			return fmt.Errorf("guest access: %w", ErrForbidden)
+		}
+		return nil
+	}
+
+	router, err := NewRouter([]*RouteRule{
+		{Method: `GET`, Path: `/api/transfers/{id}`, DynamicPath: true, RouteTo: routeTo},
+		{Method: `DELETE`, Path: `/api/transfers/{id}`, DynamicPath: true, RouteTo: routeTo, AuthWith: authWith},
+		{Method: `PUT`, Path: `/api/transfers/{id}`, DynamicPath: true},
+	})
+	assert.NoError(t, err)
+
+	serve := func(method, path, authorization string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := serve(`GET`, `/api/transfers/7`, "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "GET 7", rec.Body.String())
+
+	rec = serve(`DELETE`, `/api/transfers/7`, "")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.JSONEq(t, `{"message":"unauthorized"}`, rec.Body.String())
+
+	assert.Equal(t, http.StatusForbidden, serve(`DELETE`, `/api/transfers/7`, "guest").Code)
+	assert.Equal(t, "DELETE 7", serve(`DELETE`, `/api/transfers/7`, "admin").Body.String())
+	assert.Equal(t, http.StatusNotImplemented, serve(`PUT`, `/api/transfers/7`, "").Code)
+
+	rec = serve(`POST`, `/api/transfers/7`, "")
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	assert.Equal(t, "DELETE, GET, PUT", rec.Header().Get("Allow"))
+
+	rec = serve(`GET`, `/api/accounts`, "")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.JSONEq(t, `{"message":"not found"}`, rec.Body.String())
+}
@@ -1,9 +1,11 @@
 package gmrouting
 
 import (
+	"fmt"
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -43,15 +45,15 @@ func Test_Route_Rules(t *testing.T) {
 	for _, td := range data {
 		req := toHttpRequest(td.method, td.fullPath)
 
-		foundRouteRule := router.FindMatch(req)
+		match := router.FindMatch(req)
 
 		if td.match {
-			assert.Equal(t, routeRules[td.routeRuleIndex], foundRouteRule)
+			assert.Equal(t, routeRules[td.routeRuleIndex], match.Rule)
 		} else {
-			assert.NotEqual(t, routeRules[td.routeRuleIndex], foundRouteRule)
+			assert.NotEqual(t, routeRules[td.routeRuleIndex], match.Rule)
 		}
 
-		foundRuleRouteParams := foundRouteRule.GetRouteParams()
+		foundRuleRouteParams := match.RouteParams
 
 		for k, v := range foundRuleRouteParams {
 			assert.Equal(t, v, td.routeParams[k])
@@ -86,3 +88,45 @@ func toHttpRequest(method, path string) *http.Request {
 		RequestURI: path,
 	}
 }
+
+func Test_Concurrent_FindMatch(t *testing.T) {
+	routeRules := []*RouteRule{
+		{Method: `GET`, Path: `/api/accounts`, DynamicPath: false},
+		{Method: `GET`, Path: `/api/transfers/{uniqueID}`, DynamicPath: true},
+		{Method: `GET`, Path: `/api/entity/{id}/reference/{ref}`, DynamicPath: true},
+		{Method: `GET`, Path: `/files/{name}.json`, DynamicPath: true},
+	}
+
+	router, err := NewRouter(routeRules)
+	assert.NoError(t, err)
+
+	const workers = 16
+	const iterations = 500
+
+	wg := &sync.WaitGroup{}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for i := 0; i < iterations; i++ {
+				id := fmt.Sprintf("%d-%d", worker, i)
+
+				match := router.FindMatch(toHttpRequest(`GET`, `/api/transfers/`+id))
+				if !assert.NotNil(t, match) {
+					return
+				}
+				assert.Equal(t, id, match.Param("uniqueID"))
+
+				match = router.FindMatch(toHttpRequest(`GET`, `/api/entity/`+id+`/reference/r`+id))
+				assert.Equal(t, map[string]string{"id": id, "ref": "r" + id}, match.RouteParams)
+
+				match = router.FindMatch(toHttpRequest(`GET`, `/files/`+id+`.json`))
+				assert.Equal(t, id, match.Param("name"))
+
+				req := match.WithRequest(toHttpRequest(`GET`, `/files/`+id+`.json`))
+				assert.Equal(t, id, RouteParamsFromContext(req.Context())["name"])
+			}
+		}(w)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,177 @@
+package gmrouting
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Upstream represents a single target server of an UpstreamPool.
+type Upstream struct {
+	url    string
+	weight int
+
+	inFlight int64
+
+	// Fields below are guarded by UpstreamPool mutex.
+	consecutiveFailures int
+	ejectedUntil        time.Time
+}
+
+// NewUpstream creates an upstream entry for UpstreamPool.
+//
+// url must be in the same format with routeUrl of NewProxyClient. E.g: http://10.0.0.1:8080
+//
+// weight is only taken into account by weighted balancers. Values lower than 1 are treated as 1.
+func NewUpstream(url string, weight int) *Upstream {
+	if weight < 1 {
+		weight = 1
+	}
+	return &Upstream{
+		url:    strings.TrimSuffix(url, "/"),
+		weight: weight,
+	}
+}
+
+func (u *Upstream) URL() string {
+	return u.url
+}
+
+func (u *Upstream) Weight() int {
+	return u.weight
+}
+
+// InFlight returns the number of requests which are currently being proxied to upstream.
+func (u *Upstream) InFlight() int64 {
+	return atomic.LoadInt64(&u.inFlight)
+}
+
+func (u *Upstream) begin() {
+	atomic.AddInt64(&u.inFlight, 1)
+}
+
+func (u *Upstream) end() {
+	atomic.AddInt64(&u.inFlight, -1)
+}
+
+// UpstreamPool holds upstreams of a ProxyClient and passively tracks their health.
+//
+// An upstream is ejected from balancing for ejectFor duration after maxFailures consecutive failures.
+// Transport errors and 5xx responses are counted as failures.
+type UpstreamPool struct {
+	mutex       *sync.Mutex
+	upstreams   []*Upstream
+	balancer    Balancer
+	maxFailures int
+	ejectFor    time.Duration
+}
+
+// NewUpstreamPool creates a pool which distributes requests among upstreams via input balancer.
+//
+// maxFailures <= 0 disables passive health tracking.
+func NewUpstreamPool(upstreams []*Upstream, balancer Balancer, maxFailures int, ejectFor time.Duration) (*UpstreamPool, error) {
+	if len(upstreams) == 0 {
+		return nil, fmt.Errorf("upstream pool requires at least one upstream")
+	}
+	if balancer == nil {
+		return nil, fmt.Errorf("upstream pool requires a balancer")
+	}
+
+	seen := make(map[string]bool, len(upstreams))
+	for _, u := range upstreams {
+		parsed, err := url.Parse(u.url)
+		if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+			return nil, fmt.Errorf("invalid upstream url: '%s'", u.url)
+		}
+		if seen[u.url] {
+			return nil, fmt.Errorf("upstream: '%s' is registered multiple times", u.url)
+		}
+		seen[u.url] = true
+	}
+
+	return &UpstreamPool{
+		mutex:       &sync.Mutex{},
+		upstreams:   upstreams,
+		balancer:    balancer,
+		maxFailures: maxFailures,
+		ejectFor:    ejectFor,
+	}, nil
+}
+
+// Upstreams returns all upstreams of the pool including ejected ones.
+func (p *UpstreamPool) Upstreams() []*Upstream {
+	return p.upstreams
+}
+
+// IsEjected returns true if upstream is currently excluded from balancing due to consecutive failures.
+func (p *UpstreamPool) IsEjected(u *Upstream) bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return time.Now().Before(u.ejectedUntil)
+}
+
+// Pick selects an upstream for input request among available upstreams.
+// It returns nil if every upstream is ejected.
+func (p *UpstreamPool) Pick(r *http.Request, routeParams map[string]string) *Upstream {
+	return p.pick(r, routeParams, nil)
+}
+
+// pick works like Pick but also skips upstreams for which isUsable returns false.
+func (p *UpstreamPool) pick(r *http.Request, routeParams map[string]string, isUsable func(upstreamUrl string) bool) *Upstream {
+	available := p.available()
+	if isUsable != nil {
+		usable := available[:0]
+		for _, u := range available {
+			if isUsable(u.url) {
+				usable = append(usable, u)
+			}
+		}
+		available = usable
+	}
+
+	if len(available) == 0 {
+		return nil
+	}
+	return p.balancer.Pick(r, routeParams, available)
+}
+
+func (p *UpstreamPool) available() []*Upstream {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	now := time.Now()
+	available := make([]*Upstream, 0, len(p.upstreams))
+	for _, u := range p.upstreams {
+		if now.Before(u.ejectedUntil) {
+			continue
+		}
+		available = append(available, u)
+	}
+	return available
+}
+
+// report records the outcome of a single request made to upstream.
+func (p *UpstreamPool) report(u *Upstream, success bool) {
+	if p.maxFailures <= 0 {
+		return
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if success {
+		u.consecutiveFailures = 0
+		return
+	}
+
+	u.consecutiveFailures++
+	if u.consecutiveFailures >= p.maxFailures {
+		u.consecutiveFailures = 0
+		u.ejectedUntil = time.Now().Add(p.ejectFor)
+	}
+}
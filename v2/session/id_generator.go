@@ -9,19 +9,19 @@ import (
 )
 
 var shortIDGenerator *shortid.Shortid
+var initGenMutex sync.Mutex
 var fallbackGenMutex sync.Mutex
 
 // NewID creates a new ID value to represent a unique session.
+//
+// It is safe for concurrent use.
 func NewID() string {
-	var err error
-	if shortIDGenerator == nil {
-		shortIDGenerator, err = shortid.New(1, shortid.DefaultABC, 2342)
-		if err != nil {
-			return generateFallbackID()
-		}
+	generator, err := getGenerator()
+	if err != nil {
+		return generateFallbackID()
 	}
 
-	generatedID, err := shortIDGenerator.Generate()
+	generatedID, err := generator.Generate()
 	if err != nil {
 		return generateFallbackID()
 	}
@@ -29,6 +29,22 @@ func NewID() string {
 	return generatedID
 }
 
+func getGenerator() (*shortid.Shortid, error) {
+	initGenMutex.Lock()
+	defer initGenMutex.Unlock()
+
+	if shortIDGenerator != nil {
+		return shortIDGenerator, nil
+	}
+
+	generator, err := shortid.New(1, shortid.DefaultABC, 2342)
+	if err != nil {
+		return nil, err
+	}
+	shortIDGenerator = generator
+	return generator, nil
+}
+
 func generateFallbackID() string {
 	// Return unix timestamp upon error to always have a generated ID.
 	fallbackGenMutex.Lock()
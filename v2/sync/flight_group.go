@@ -0,0 +1,127 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrFlightPanicked is returned to callers which wait for a function that panicked.
+var ErrFlightPanicked = errors.New("function of the key panicked")
+
+// FlightGroup runs a function at most once at a time per key.
+// Callers which arrive while the function of their key is running wait for it and share its result instead of running it again.
+//
+// Keys are forgotten once their function returns, so later callers run it again.
+type FlightGroup[K comparable, V any] struct {
+	mutex   *sync.Mutex
+	flights map[K]*flight[V]
+}
+
+type flight[V any] struct {
+	done  chan struct{}
+	value V
+	err   error
+	// waiters is the number of callers waiting for the result. Guarded by group mutex.
+	waiters int
+	// callers is the number of callers, including the one which runs fn, that have not given up yet. Guarded by group mutex.
+	callers int
+	// cancel cancels context of fn.
+	cancel context.CancelFunc
+}
+
+func NewFlightGroup[K comparable, V any]() *FlightGroup[K, V] {
+	return &FlightGroup[K, V]{
+		mutex:   &sync.Mutex{},
+		flights: make(map[K]*flight[V]),
+	}
+}
+
+// Do runs fn unless a call of the same key is in progress, in which case it waits for that call and returns its result.
+// shared is true if the result is produced by fn of another caller.
+//
+// If fn panics, panic propagates to its caller and waiting callers receive ErrFlightPanicked.
+func (g *FlightGroup[K, V]) Do(key K, fn func() (V, error)) (value V, shared bool, err error) {
+	return g.DoContext(context.Background(), key, func(ctx context.Context) (V, error) {
+		return fn()
+	})
+}
+
+// DoContext is same as Do, except callers give up once their ctx is done.
+//
+// A waiting caller which gives up returns the error of its ctx immediately.
+// The caller which runs fn returns once fn returns. fn receives a context which is not cancelled along with ctx
+// of its caller, but once every caller of the key gave up. Callers which arrive after that run fn again.
+// It is not cancelled when fn returns, so that its result can keep using it.
+func (g *FlightGroup[K, V]) DoContext(ctx context.Context, key K, fn func(ctx context.Context) (V, error)) (value V, shared bool, err error) {
+	g.mutex.Lock()
+	f := g.flights[key]
+	if f != nil {
+		f.waiters++
+		f.callers++
+		g.mutex.Unlock()
+
+		select {
+		case <-f.done:
+			return f.value, true, f.err
+		case <-ctx.Done():
+			g.leave(key, f, true)
+			return value, true, ctx.Err()
+		}
+	}
+
+	/* Error is replaced by the result of fn unless it panics. */
+	fnCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	f = &flight[V]{done: make(chan struct{}), err: ErrFlightPanicked, callers: 1, cancel: cancel}
+	g.flights[key] = f
+	g.mutex.Unlock()
+
+	stop := context.AfterFunc(ctx, func() {
+		g.leave(key, f, false)
+	})
+	defer func() {
+		stop()
+		g.mutex.Lock()
+		if g.flights[key] == f {
+			delete(g.flights, key)
+		}
+		g.mutex.Unlock()
+		close(f.done)
+	}()
+
+	f.value, f.err = fn(fnCtx)
+	return f.value, false, f.err
+}
+
+// leave records that a caller of input flight gave up. Context of fn is cancelled once no caller is left.
+func (g *FlightGroup[K, V]) leave(key K, f *flight[V], waiting bool) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if waiting {
+		f.waiters--
+	}
+	f.callers--
+	if f.callers > 0 {
+		return
+	}
+
+	/* Callers which arrive later must not share the cancelled call. */
+	f.cancel()
+	if g.flights[key] == f {
+		delete(g.flights, key)
+	}
+}
+
+// Waiters returns the number of callers which wait for the in-flight call of input key.
+// It returns 0 if no call of the key is in progress.
+func (g *FlightGroup[K, V]) Waiters(key K) int {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	f := g.flights[key]
+	if f == nil {
+		return 0
+	}
+	return f.waiters
+}
@@ -0,0 +1,147 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Flight_Group(t *testing.T) {
+	group := NewFlightGroup[string, int]()
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var calls atomic.Int32
+	var sharedCount atomic.Int32
+
+	do := func(wg *sync.WaitGroup) {
+		defer wg.Done()
+		value, shared, err := group.Do("a", func() (int, error) {
+			calls.Add(1)
+			close(started)
+			<-release
+			return 42, nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 42, value)
+		if shared {
+			sharedCount.Add(1)
+		}
+	}
+
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	go do(wg)
+	<-started
+
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go do(wg)
+	}
+	assert.Eventually(t, func() bool { return group.Waiters("a") == 4 }, time.Second, time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), calls.Load())
+	assert.Equal(t, int32(4), sharedCount.Load())
+	assert.Equal(t, 0, group.Waiters("a"))
+
+	/* Key is forgotten once fn returns. */
+	_, shared, err := group.Do("a", func() (int, error) {
+		return 0, errors.New("failed")
+	})
+	assert.False(t, shared)
+	assert.EqualError(t, err, "failed")
+
+	assert.Panics(t, func() {
+		group.Do("b", func() (int, error) {
+			panic("boom")
+		})
+	})
+	value, _, err := group.Do("b", func() (int, error) { return 1, nil })
+	assert.NoError(t, err)
+	assert.Equal(t, 1, value)
+}
+
+func Test_Flight_Group_Context(t *testing.T) {
+	group := NewFlightGroup[string, int]()
+	started := make(chan struct{})
+	fnCancelled := make(chan struct{})
+
+	leaderCtx, cancelLeader := context.WithCancel(context.Background())
+	leaderDone := make(chan error)
+	go func() {
+		_, _, err := group.DoContext(leaderCtx, "a", func(ctx context.Context) (int, error) {
+			close(started)
+			<-ctx.Done()
+			close(fnCancelled)
+			return 0, ctx.Err()
+		})
+		leaderDone <- err
+	}()
+	<-started
+
+	/* Waiting caller gives up without waiting for fn. */
+	waiterCtx, cancelWaiter := context.WithCancel(context.Background())
+	waiterDone := make(chan error)
+	go func() {
+		_, shared, err := group.DoContext(waiterCtx, "a", func(ctx context.Context) (int, error) {
+			return 1, nil
+		})
+		assert.True(t, shared)
+		waiterDone <- err
+	}()
+	assert.Eventually(t, func() bool { return group.Waiters("a") == 1 }, time.Second, time.Millisecond)
+	cancelWaiter()
+	assert.ErrorIs(t, <-waiterDone, context.Canceled)
+	assert.Equal(t, 0, group.Waiters("a"))
+
+	select {
+	case <-fnCancelled:
+		assert.Fail(t, "fn is cancelled while its caller is waiting")
+	default:
+	}
+
+	/* fn is cancelled once no caller is left. */
+	cancelLeader()
+	<-fnCancelled
+	assert.ErrorIs(t, <-leaderDone, context.Canceled)
+
+	/* fn keeps running for waiting callers after the caller which runs it gives up. */
+	started = make(chan struct{})
+	release := make(chan struct{})
+	leaderCtx, cancelLeader = context.WithCancel(context.Background())
+	go func() {
+		value, _, err := group.DoContext(leaderCtx, "b", func(ctx context.Context) (int, error) {
+			close(started)
+			select {
+			case <-ctx.Done():
+				return 0, ctx.Err()
+			case <-release:
+				return 42, nil
+			}
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 42, value)
+		leaderDone <- err
+	}()
+	<-started
+
+	go func() {
+		value, shared, err := group.DoContext(context.Background(), "b", func(ctx context.Context) (int, error) {
+			return 1, nil
+		})
+		assert.True(t, shared)
+		assert.Equal(t, 42, value)
+		waiterDone <- err
+	}()
+	assert.Eventually(t, func() bool { return group.Waiters("b") == 1 }, time.Second, time.Millisecond)
+	cancelLeader()
+	close(release)
+	assert.NoError(t, <-waiterDone)
+	assert.NoError(t, <-leaderDone)
+}